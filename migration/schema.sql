@@ -12,6 +12,46 @@ CREATE TABLE pages (
     html TEXT NOT NULL,
     metadata JSONB NOT NULL DEFAULT '{}',
     indexed BOOLEAN NOT NULL DEFAULT FALSE,
+    content_hash TEXT,                     -- hex SHA-256 of the normalized text
+    language TEXT,                         -- BCP-47 tag, NULL when unknown
+    warc_file TEXT,
+    warc_offset BIGINT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- URLs serving the same content as an existing page
+CREATE TABLE page_aliases (
+    url_id UUID PRIMARY KEY REFERENCES urls(id) ON DELETE CASCADE,
+    page_id UUID NOT NULL REFERENCES pages(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE hosts (
+    name TEXT PRIMARY KEY,
+    allow TEXT[] NOT NULL DEFAULT '{}',
+    disallow TEXT[] NOT NULL DEFAULT '{}',
+    sitemaps TEXT[] NOT NULL DEFAULT '{}',
+    crawl_delay INTEGER NOT NULL,
+    max_retry INTEGER NOT NULL,
+    max_pages INTEGER NOT NULL,
+    pages_crawled INTEGER NOT NULL DEFAULT 0,
+    error_count INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    last_error_at TIMESTAMP,
+    robots_fetched_at TIMESTAMP,
+    robots_expires_at TIMESTAMP,
+    robots_status INTEGER NOT NULL DEFAULT 0,
+    disallow_all BOOLEAN NOT NULL DEFAULT FALSE,
+    probed_at TIMESTAMP,                   -- last request for a nonexistent path
+    probe_status INTEGER NOT NULL DEFAULT 0,
+    probe_url TEXT,                        -- where the nonexistent path led
+    probe_title TEXT,
+    probe_hash BIGINT NOT NULL DEFAULT 0,  -- simhash of the page served for it
+    soft_404 BOOLEAN NOT NULL DEFAULT FALSE,  -- nonexistent paths are served with 200 OK
+    soft_404_pages INTEGER NOT NULL DEFAULT 0,
+    parked BOOLEAN NOT NULL DEFAULT FALSE,    -- parking or for-sale placeholder
     created_at TIMESTAMP NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP NOT NULL DEFAULT NOW()
 );
@@ -37,6 +77,90 @@ CREATE TABLE graph_edges (
     UNIQUE (from_url, to_url)
 );
 
+CREATE TABLE fetch_log (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    url_id UUID REFERENCES urls(id) ON DELETE SET NULL, -- NULL for robots.txt, sitemaps, feeds and probes
+    host TEXT NOT NULL,
+    fetched_at TIMESTAMP NOT NULL,
+    status INTEGER,                -- NULL when no response was received
+    latency_ms INTEGER NOT NULL,
+    bytes BIGINT NOT NULL,
+    content_type TEXT,
+    error_class TEXT,              -- NULL on success
+    worker_id INTEGER,             -- NULL for background fetches
+    instance TEXT NOT NULL
+);
+
+-- Running totals per host, incremented by every batch the spider writes
+CREATE TABLE host_stats (
+    host TEXT PRIMARY KEY,
+    fetches BIGINT NOT NULL DEFAULT 0,        -- requests, robots.txt and feeds included
+    bytes BIGINT NOT NULL DEFAULT 0,
+    latency_ms BIGINT NOT NULL DEFAULT 0,     -- sum, divide by fetches for the average
+    status_2xx BIGINT NOT NULL DEFAULT 0,
+    status_3xx BIGINT NOT NULL DEFAULT 0,
+    status_4xx BIGINT NOT NULL DEFAULT 0,
+    status_5xx BIGINT NOT NULL DEFAULT 0,
+    errors BIGINT NOT NULL DEFAULT 0,         -- fetches without a response
+    pages BIGINT NOT NULL DEFAULT 0,          -- pages crawled, duplicates and unchanged included
+    duplicates BIGINT NOT NULL DEFAULT 0,     -- new URLs with the content of another page
+    unchanged BIGINT NOT NULL DEFAULT 0,      -- recrawled pages with the same content
+    outlinks BIGINT NOT NULL DEFAULT 0,       -- links found on the host's pages
+    deferrals BIGINT NOT NULL DEFAULT 0,      -- fetches put off by the crawl delay
+    wait_ms BIGINT NOT NULL DEFAULT 0,        -- crawl delay left at those deferrals, summed
+    last_success_at TIMESTAMP,
+    last_failure_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE crawl_jobs (
+    name TEXT PRIMARY KEY,
+    namespace TEXT UNIQUE NOT NULL,          -- prefix of the job's Redis keys
+    seeds TEXT[] NOT NULL DEFAULT '{}',
+    scope TEXT[] NOT NULL DEFAULT '{}',      -- hosts or URL prefixes, empty for no limit
+    max_pages BIGINT NOT NULL DEFAULT 0,     -- 0 for no limit
+    time_limit_seconds BIGINT NOT NULL DEFAULT 0,
+    crawlers INTEGER NOT NULL DEFAULT 0,     -- 0 for MAX_CRAWLERS
+    status TEXT NOT NULL DEFAULT 'running'
+        CHECK (status IN ('running', 'paused', 'completed', 'cancelled')),
+    finish_reason TEXT,
+    pages_crawled BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE feeds (
+    job TEXT NOT NULL REFERENCES crawl_jobs(name) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    host TEXT NOT NULL,
+    probe BOOLEAN NOT NULL DEFAULT FALSE,    -- common path not yet confirmed as a feed
+    interval_seconds BIGINT NOT NULL,        -- adapted to how often the feed has new items
+    next_poll_at TIMESTAMP NOT NULL,
+    last_polled_at TIMESTAMP,
+    last_item_at TIMESTAMP,                  -- newest publication date seen
+    seen_items TEXT[] NOT NULL DEFAULT '{}', -- guids or URLs of the items of the last poll
+    etag TEXT,
+    last_modified TEXT,
+    items_found BIGINT NOT NULL DEFAULT 0,
+    error_count INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (job, url)
+);
+
+-- Page and graph events waiting to be relayed to the Redis event stream
+CREATE TABLE event_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    type TEXT NOT NULL,                      -- page.created, page.updated, page.deleted or edges.added
+    version INTEGER NOT NULL,                -- schema version of the payload
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
 CREATE TABLE page_rank (
     url_id UUID PRIMARY KEY REFERENCES urls(id) ON DELETE CASCADE,
     score   DOUBLE PRECISION NOT NULL,
@@ -61,6 +185,9 @@ CREATE TABLE IF NOT EXISTS monitor_state (
 -- Indexes
 CREATE UNIQUE INDEX idx_words_word ON words(word);
 CREATE UNIQUE INDEX idx_pages_url_id ON pages(url_id);
+CREATE INDEX idx_pages_content_hash ON pages(content_hash);
+CREATE INDEX idx_pages_language ON pages(language);
+CREATE INDEX idx_page_aliases_page_id ON page_aliases(page_id);
 CREATE INDEX idx_page_word_page_id ON page_word(page_id);
 CREATE INDEX idx_page_word_word_id ON page_word(word_id);
 CREATE UNIQUE INDEX idx_page_word_word_page ON page_word(word_id, page_id);
@@ -69,6 +196,13 @@ CREATE INDEX idx_graph_edges_to_page ON graph_edges(to_url);
 CREATE UNIQUE INDEX idx_graph_edges_unique ON graph_edges(from_url, to_url);
 CREATE UNIQUE INDEX idx_graph_edges_unique_revese ON graph_edges(to_url, from_url);
 CREATE INDEX idx_page_rank_score ON page_rank(score DESC);
+CREATE INDEX idx_fetch_log_fetched_at ON fetch_log(fetched_at);
+CREATE INDEX idx_fetch_log_url ON fetch_log(url, fetched_at DESC);
+CREATE INDEX idx_fetch_log_url_id ON fetch_log(url_id);
+CREATE INDEX idx_fetch_log_host ON fetch_log(host, fetched_at);
+CREATE INDEX idx_host_stats_pages ON host_stats(pages DESC);
+CREATE INDEX idx_feeds_next_poll_at ON feeds(next_poll_at);
+CREATE INDEX idx_feeds_host ON feeds(host);
 
 -- CREATE INDEX idx_image_page_image_url ON image_page(image_url);
 --
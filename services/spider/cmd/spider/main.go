@@ -1,21 +1,82 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/Hassan-ach/boogle/services/spider/internal/config"
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
 	"github.com/Hassan-ach/boogle/services/spider/internal/spider"
+	"github.com/Hassan-ach/boogle/services/spider/internal/store"
 )
 
 type Spider struct {
 	Config *config.Config
 }
 
+const usage = `usage: spider [command] [flags]
+
+commands:
+  crawl                  crawl the web until interrupted (default)
+  replay --warc <dir>    rebuild pages, urls and graph_edges from WARC files
+  fetch-log <command>    query and prune the fetch log:
+      prune [--older-than 720h]               delete old entries (default FETCH_LOG_RETENTION_DAYS)
+      hosts [--since 24h] [--min 10] [--limit 20]
+                                              hosts with the highest error rate
+      statuses [--since 168h]                 fetch outcomes per day
+      url [--limit 20] <url>                  latest fetches of a URL
+  hosts <command>        per-host crawl statistics:
+      top [--by pages] [--limit 20]           hosts ranking first by pages, fetches, bytes,
+                                              failures, duplicates, latency, outlinks,
+                                              deferrals or wait
+      show <host>                             every statistic of a host
+  jobs <command>         manage crawl jobs; running spiders apply changes on their next poll:
+      list                                    every job with its status and progress
+      create --seeds <urls> [--scope <hosts or URL prefixes>] [--max-pages 0]
+             [--time-limit 0] [--crawlers 0] [--namespace <name>] <name>
+                                              register a job, comma-separated lists
+      pause <name> | resume <name> | cancel <name>
+  events <command>       inspect the event stream (EVENT_STREAM):
+      groups                                  consumer groups with their pending events and lag
+      replay [--from 0 | --since 24h] <group> deliver events to a group again from a stream id
+`
+
 func main() {
-	conf, _ := config.LoadConfig()
+	cmd := "crawl"
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "crawl":
+		crawl()
+	case "replay":
+		replay(args)
+	case "fetch-log":
+		fetchLog(args)
+	case "hosts":
+		hosts(args)
+	case "jobs":
+		jobs(args)
+	case "events":
+		events(args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func crawl() {
+	conf := loadConfig()
 
 	spider := spider.NewSpider(conf)
 	defer func() {
@@ -30,3 +91,398 @@ func main() {
 
 	spider.Stop()
 }
+
+func replay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	dir := fs.String("warc", "", "directory containing .warc.gz files")
+	_ = fs.Parse(args)
+
+	if *dir == "" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	conf := loadConfig()
+
+	spider := spider.NewSpider(conf)
+	defer func() {
+		spider.Close()
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	stats, err := spider.Replay(ctx, *dir)
+	fmt.Printf("Replay: files=%d records=%d pages=%d robots=%d probes=%d skipped=%d errors=%d\n",
+		stats.Files, stats.Records, stats.Pages, stats.Robots, stats.Probes, stats.Skipped, stats.Errors)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay failed: %v\n", err)
+		spider.Close()
+		os.Exit(1)
+	}
+}
+
+func fetchLog(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	sub, args := args[0], args[1:]
+
+	conf := loadConfig()
+	fs := flag.NewFlagSet("fetch-log "+sub, flag.ExitOnError)
+
+	var run func(ctx context.Context, db *store.SQLClient, w *tabwriter.Writer) error
+	switch sub {
+	case "prune":
+		olderThan := fs.Duration("older-than", conf.App.FetchLogRetention, "delete entries older than this")
+		run = func(ctx context.Context, db *store.SQLClient, w *tabwriter.Writer) error {
+			n, err := db.PruneFetchLog(ctx, time.Now().Add(-*olderThan))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "deleted %d entries older than %s\n", n, *olderThan)
+			return nil
+		}
+	case "hosts":
+		since := fs.Duration("since", 24*time.Hour, "only count fetches this recent")
+		min := fs.Int("min", 10, "ignore hosts with fewer fetches")
+		limit := fs.Int("limit", 20, "number of hosts to show")
+		run = func(ctx context.Context, db *store.SQLClient, w *tabwriter.Writer) error {
+			stats, err := db.HostErrorRates(ctx, time.Now().Add(-*since), *min, *limit)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(w, "HOST\tFETCHES\tERRORS\tERROR RATE\tAVG LATENCY")
+			for _, h := range stats {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t%s\n",
+					h.Host, h.Fetches, h.Errors, 100*h.ErrorRate(), h.AvgLatency)
+			}
+			return nil
+		}
+	case "statuses":
+		since := fs.Duration("since", 7*24*time.Hour, "only count fetches this recent")
+		run = func(ctx context.Context, db *store.SQLClient, w *tabwriter.Writer) error {
+			stats, err := db.StatusByDay(ctx, time.Now().Add(-*since))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(w, "DAY\tOUTCOME\tCOUNT")
+			for _, d := range stats {
+				fmt.Fprintf(w, "%s\t%s\t%d\n", d.Day.Format(time.DateOnly), d.Outcome, d.Count)
+			}
+			return nil
+		}
+	case "url":
+		limit := fs.Int("limit", 20, "number of fetches to show")
+		run = func(ctx context.Context, db *store.SQLClient, w *tabwriter.Writer) error {
+			if fs.NArg() != 1 {
+				return fmt.Errorf("fetch-log url takes exactly one URL")
+			}
+			fetches, err := db.URLFetches(ctx, fs.Arg(0), *limit)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(w, "TIME\tSTATUS\tERROR\tLATENCY\tBYTES\tCONTENT TYPE\tWORKER\tINSTANCE")
+			for _, f := range fetches {
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%d\t%s\t%d\t%s\n",
+					f.FetchedAt.Format(time.RFC3339), f.Status, f.ErrorClass, f.Latency,
+					f.Bytes, f.ContentType, f.Worker, f.Instance)
+			}
+			return nil
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	_ = fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db := store.NewDbClient(conf.Store.DB)
+	defer db.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	err := run(ctx, db, w)
+	_ = w.Flush()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fetch-log %s failed: %v\n", sub, err)
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+func hosts(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	sub, args := args[0], args[1:]
+
+	conf := loadConfig()
+	fs := flag.NewFlagSet("hosts "+sub, flag.ExitOnError)
+
+	var run func(ctx context.Context, db *store.SQLClient, w *tabwriter.Writer) error
+	switch sub {
+	case "top":
+		by := fs.String("by", "pages", "statistic hosts are ranked by")
+		limit := fs.Int("limit", 20, "number of hosts to show")
+		run = func(ctx context.Context, db *store.SQLClient, w *tabwriter.Writer) error {
+			stats, err := db.TopHosts(ctx, *by, *limit)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(w, "HOST\tPAGES\tFETCHES\tBYTES\tFAILURES\tAVG LATENCY\tDUPLICATES\tOUTLINKS\tDEFERRALS\tWAIT\tLAST SUCCESS\tLAST FAILURE")
+			for _, h := range stats {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%dms\t%.1f%%\t%d\t%d\t%.0fs\t%s\t%s\n",
+					h.Host, h.Pages, h.Fetches, h.Bytes, h.Failures(), h.AvgLatencyMs,
+					100*h.DuplicateRatio, h.Outlinks, h.Deferrals, h.WaitSeconds,
+					formatTime(h.LastSuccessAt), formatTime(h.LastFailureAt))
+			}
+			return nil
+		}
+	case "show":
+		run = func(ctx context.Context, db *store.SQLClient, w *tabwriter.Writer) error {
+			if fs.NArg() != 1 {
+				return fmt.Errorf("hosts show takes exactly one host")
+			}
+			h, ok, err := db.HostStats(ctx, fs.Arg(0))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("no statistics for host %s", fs.Arg(0))
+			}
+			fmt.Fprintf(w, "host\t%s\n", h.Host)
+			fmt.Fprintf(w, "fetches\t%d\n", h.Fetches)
+			fmt.Fprintf(w, "bytes\t%d\n", h.Bytes)
+			fmt.Fprintf(w, "avg latency\t%dms\n", h.AvgLatencyMs)
+			fmt.Fprintf(w, "status 2xx / 3xx / 4xx / 5xx\t%d / %d / %d / %d\n",
+				h.Status2xx, h.Status3xx, h.Status4xx, h.Status5xx)
+			fmt.Fprintf(w, "no response\t%d\n", h.Errors)
+			fmt.Fprintf(w, "pages\t%d\n", h.Pages)
+			fmt.Fprintf(w, "duplicates\t%d (%.1f%%)\n", h.Duplicates, 100*h.DuplicateRatio)
+			fmt.Fprintf(w, "unchanged\t%d\n", h.Unchanged)
+			fmt.Fprintf(w, "outlinks\t%d\n", h.Outlinks)
+			fmt.Fprintf(w, "politeness deferrals\t%d\n", h.Deferrals)
+			fmt.Fprintf(w, "politeness wait\t%.1fs\n", h.WaitSeconds)
+			fmt.Fprintf(w, "last success\t%s\n", formatTime(h.LastSuccessAt))
+			fmt.Fprintf(w, "last failure\t%s\n", formatTime(h.LastFailureAt))
+			fmt.Fprintf(w, "updated\t%s\n", formatTime(h.UpdatedAt))
+			return nil
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	_ = fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db := store.NewDbClient(conf.Store.DB)
+	defer db.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	err := run(ctx, db, w)
+	_ = w.Flush()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hosts %s failed: %v\n", sub, err)
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+func jobs(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	sub, args := args[0], args[1:]
+
+	conf := loadConfig()
+	fs := flag.NewFlagSet("jobs "+sub, flag.ExitOnError)
+
+	// setStatus returns a command moving the named job to status
+	setStatus := func(status entity.JobStatus) func(ctx context.Context, db *store.SQLClient, w *tabwriter.Writer) error {
+		return func(ctx context.Context, db *store.SQLClient, w *tabwriter.Writer) error {
+			if fs.NArg() != 1 {
+				return fmt.Errorf("jobs %s takes exactly one job name", sub)
+			}
+			if err := db.SetJobStatus(ctx, fs.Arg(0), status, ""); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "job %s is now %s\n", fs.Arg(0), status)
+			return nil
+		}
+	}
+
+	var run func(ctx context.Context, db *store.SQLClient, w *tabwriter.Writer) error
+	switch sub {
+	case "list":
+		run = func(ctx context.Context, db *store.SQLClient, w *tabwriter.Writer) error {
+			jobs, err := db.ListJobs(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(w, "NAME\tSTATUS\tREASON\tPAGES\tMAX PAGES\tTIME LIMIT\tSTARTED\tFINISHED\tSCOPE")
+			for _, j := range jobs {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
+					j.Name, j.Status, j.FinishReason, j.PagesCrawled, j.MaxPages, j.TimeLimit,
+					formatTime(j.StartedAt), formatTime(j.FinishedAt), strings.Join(j.Scope, ","))
+			}
+			return nil
+		}
+	case "create":
+		seeds := fs.String("seeds", "", "comma-separated start URLs")
+		scope := fs.String("scope", "", "comma-separated hosts or URL prefixes links must match")
+		maxPages := fs.Int64("max-pages", 0, "stop after this many pages, 0 for no limit")
+		timeLimit := fs.Duration("time-limit", 0, "stop this long after the job started, 0 for no limit")
+		crawlers := fs.Int("crawlers", 0, "crawler goroutines per instance, 0 for MAX_CRAWLERS")
+		namespace := fs.String("namespace", "", "prefix of the job's Redis keys, defaults to the name")
+		run = func(ctx context.Context, db *store.SQLClient, w *tabwriter.Writer) error {
+			if fs.NArg() != 1 {
+				return fmt.Errorf("jobs create takes exactly one job name")
+			}
+			j := &entity.Job{
+				Name:      fs.Arg(0),
+				Namespace: *namespace,
+				Seeds:     splitList(*seeds),
+				Scope:     splitList(*scope),
+				MaxPages:  *maxPages,
+				TimeLimit: *timeLimit,
+				Crawlers:  *crawlers,
+			}
+			if err := spider.NormalizeJob(j); err != nil {
+				return err
+			}
+			if err := db.CreateJob(ctx, j); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "created job %s with %d seeds in namespace %s\n", j.Name, len(j.Seeds), j.Namespace)
+			return nil
+		}
+	case "pause":
+		run = setStatus(entity.JobPaused)
+	case "resume":
+		run = setStatus(entity.JobRunning)
+	case "cancel":
+		run = setStatus(entity.JobCancelled)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	_ = fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db := store.NewDbClient(conf.Store.DB)
+	defer db.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	err := run(ctx, db, w)
+	_ = w.Flush()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jobs %s failed: %v\n", sub, err)
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+func events(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	sub, args := args[0], args[1:]
+
+	conf := loadConfig()
+	stream := conf.Store.Events.Stream
+	fs := flag.NewFlagSet("events "+sub, flag.ExitOnError)
+
+	var run func(ctx context.Context, rd *store.RedisClient, w *tabwriter.Writer) error
+	switch sub {
+	case "groups":
+		run = func(ctx context.Context, rd *store.RedisClient, w *tabwriter.Writer) error {
+			groups, err := rd.EventGroups(ctx, stream)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(w, "GROUP	CONSUMERS	PENDING	LAST DELIVERED	LAG")
+			for _, g := range groups {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\n", g.Name, g.Consumers, g.Pending, g.LastDelivered, g.Lag)
+			}
+			return nil
+		}
+	case "replay":
+		from := fs.String("from", "0", "stream id after which events are delivered again, 0 for the first event")
+		since := fs.Duration("since", 0, "deliver again the events of this last period, instead of --from")
+		run = func(ctx context.Context, rd *store.RedisClient, w *tabwriter.Writer) error {
+			if fs.NArg() != 1 {
+				return fmt.Errorf("events replay takes exactly one group name")
+			}
+			offset := *from
+			if *since > 0 {
+				// stream ids start with their time in milliseconds
+				offset = strconv.FormatInt(time.Now().Add(-*since).UnixMilli(), 10) + "-0"
+			}
+			if err := rd.SetGroupOffset(ctx, stream, fs.Arg(0), offset); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "group %s reads %s again after %s\n", fs.Arg(0), stream, offset)
+			return nil
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	_ = fs.Parse(args)
+
+	if stream == "" {
+		fmt.Fprintln(os.Stderr, "events are disabled: EVENT_STREAM is not set")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	rd := store.NewRedisClient(conf.Store.Cache)
+	defer rd.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	err := run(ctx, rd, w)
+	_ = w.Flush()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "events %s failed: %v\n", sub, err)
+		rd.Close()
+		os.Exit(1)
+	}
+}
+
+func splitList(s string) []string {
+	var l []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func loadConfig() *config.Config {
+	conf, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load config: %v\n", err)
+		os.Exit(1)
+	}
+	return conf
+}
@@ -0,0 +1,356 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+	"github.com/Hassan-ach/boogle/services/spider/internal/store"
+	"github.com/Hassan-ach/boogle/services/spider/internal/trap"
+	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
+)
+
+// Controller is the set of runtime operations the admin API exposes.
+// It is implemented by spider.Spider.
+type Controller interface {
+	Pause()
+	Resume()
+	Status(ctx context.Context) Status
+	SetMaxCrawlers(n int) error
+	SetMaxConcurrentFetch(n int) error
+	AddSeeds(ctx context.Context, job string, urls []string) (int, error)
+	HostInfo(ctx context.Context, host string) (*HostInfo, bool, error)
+	TopHosts(ctx context.Context, order string, limit int) ([]store.HostStats, error)
+	PurgeHost(ctx context.Context, host string) (int64, error)
+	Traps() []trap.Report
+	Jobs(ctx context.Context) ([]JobStatus, error)
+	CreateJob(ctx context.Context, j *entity.Job) error
+	PauseJob(ctx context.Context, name string) error
+	ResumeJob(ctx context.Context, name string) error
+	CancelJob(ctx context.Context, name string) error
+}
+
+type Status struct {
+	InstanceID         string      `json:"instance_id"`
+	Paused             bool        `json:"paused"`
+	MaxCrawlers        int         `json:"max_crawlers"`
+	MaxConcurrentFetch int         `json:"max_concurrent_fetch"`
+	FetchesInFlight    int         `json:"fetches_in_flight"`
+	FrontierSize       int64       `json:"frontier_size"`
+	VisitedCount       int64       `json:"visited_count"`
+	Jobs               []JobStatus `json:"jobs"`
+}
+
+// JobStatus is a crawl job as stored in Postgres, with this instance's
+// share of it when the job runs here.
+type JobStatus struct {
+	Job          *entity.Job `json:"job"`
+	Running      bool        `json:"running"` // the job runs in this instance
+	Partitions   []int       `json:"partitions,omitempty"`
+	Crawlers     int         `json:"crawlers,omitempty"`
+	FrontierSize int64       `json:"frontier_size"`
+	VisitedCount int64       `json:"visited_count"`
+}
+
+type HostError struct {
+	Time  time.Time `json:"time"`
+	URL   string    `json:"url"`
+	Error string    `json:"error"`
+}
+
+type HostInfo struct {
+	Host         *entity.Host     `json:"host"`
+	QueueSize    int64            `json:"queue_size"`
+	RecentErrors []HostError      `json:"recent_errors"`
+	Feeds        []*entity.Feed   `json:"feeds"`
+	Stats        *store.HostStats `json:"stats"` // nil until a batch of the host is written
+}
+
+type configRequest struct {
+	MaxCrawlers        *int `json:"max_crawlers"`
+	MaxConcurrentFetch *int `json:"max_concurrent_fetch"`
+}
+
+type seedsRequest struct {
+	Job  string   `json:"job"` // empty for the default job
+	URLs []string `json:"urls"`
+}
+
+type jobRequest struct {
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace"`
+	Seeds     []string `json:"seeds"`
+	Scope     []string `json:"scope"`
+	MaxPages  int64    `json:"max_pages"`
+	TimeLimit string   `json:"time_limit"` // Go duration, e.g. "2h30m"
+	Crawlers  int      `json:"crawlers"`
+}
+
+type Server struct {
+	srv   *http.Server
+	ctrl  Controller
+	token string
+	log   *slog.Logger
+}
+
+// NewServer returns the admin HTTP server. Every request must carry
+// "Authorization: Bearer <token>".
+func NewServer(addr, token string, ctrl Controller, logger *utils.Logger) *Server {
+	s := &Server{
+		ctrl:  ctrl,
+		token: token,
+		log:   logger.With("component", "admin"),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("POST /pause", s.handlePause)
+	mux.HandleFunc("POST /resume", s.handleResume)
+	mux.HandleFunc("PUT /config", s.handleConfig)
+	mux.HandleFunc("POST /seeds", s.handleSeeds)
+	mux.HandleFunc("GET /hosts", s.handleHosts)
+	mux.HandleFunc("GET /hosts/{host}", s.handleHost)
+	mux.HandleFunc("DELETE /hosts/{host}/frontier", s.handlePurgeHost)
+	mux.HandleFunc("GET /traps", s.handleTraps)
+	mux.HandleFunc("GET /jobs", s.handleJobs)
+	mux.HandleFunc("POST /jobs", s.handleCreateJob)
+	mux.HandleFunc("POST /jobs/{name}/pause", s.handleJobAction(Controller.PauseJob, "paused"))
+	mux.HandleFunc("POST /jobs/{name}/resume", s.handleJobAction(Controller.ResumeJob, "resumed"))
+	mux.HandleFunc("POST /jobs/{name}/cancel", s.handleJobAction(Controller.CancelJob, "cancelled"))
+
+	s.srv = &http.Server{
+		Addr:              addr,
+		Handler:           s.authenticate(mux),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+func (s *Server) Start() {
+	s.log.Info("Starting admin server", "addr", s.srv.Addr)
+	go func() {
+		if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Error("admin server stopped", "error", err)
+		}
+	}()
+}
+
+func (s *Server) Shutdown(ctx context.Context) {
+	if err := s.srv.Shutdown(ctx); err != nil {
+		s.log.Warn("shutdown admin server", "error", err)
+	}
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.ctrl.Status(r.Context()))
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	s.ctrl.Pause()
+	s.log.Info("Crawlers paused")
+	writeJSON(w, http.StatusOK, s.ctrl.Status(r.Context()))
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	s.ctrl.Resume()
+	s.log.Info("Crawlers resumed")
+	writeJSON(w, http.StatusOK, s.ctrl.Status(r.Context()))
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	var req configRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+
+	if req.MaxCrawlers != nil {
+		if err := s.ctrl.SetMaxCrawlers(*req.MaxCrawlers); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.MaxConcurrentFetch != nil {
+		if err := s.ctrl.SetMaxConcurrentFetch(*req.MaxConcurrentFetch); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, s.ctrl.Status(r.Context()))
+}
+
+func (s *Server) handleSeeds(w http.ResponseWriter, r *http.Request) {
+	var req seedsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+
+	n, err := s.ctrl.AddSeeds(r.Context(), req.Job, req.URLs)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+
+	s.log.Info("Seeds injected", "job", req.Job, "received", len(req.URLs), "added", n)
+	writeJSON(w, http.StatusOK, map[string]int{"added": n})
+}
+
+// handleHosts lists the hosts ranking first by ?order= (pages by default),
+// one of store.HostStatsOrders, up to ?limit= (20 by default).
+func (s *Server) handleHosts(w http.ResponseWriter, r *http.Request) {
+	order := r.URL.Query().Get("order")
+	if order == "" {
+		order = "pages"
+	}
+	if _, ok := store.HostStatsOrders[order]; !ok {
+		writeError(w, http.StatusBadRequest, "unknown order "+order)
+		return
+	}
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	stats, err := s.ctrl.TopHosts(r.Context(), order, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (s *Server) handleHost(w http.ResponseWriter, r *http.Request) {
+	info, ok, err := s.ctrl.HostInfo(r.Context(), r.PathValue("host"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown host")
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (s *Server) handlePurgeHost(w http.ResponseWriter, r *http.Request) {
+	host := r.PathValue("host")
+	n, err := s.ctrl.PurgeHost(r.Context(), host)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.log.Info("Host purged from frontier", "host", host, "removed", n)
+	writeJSON(w, http.StatusOK, map[string]int64{"removed": n})
+}
+
+func (s *Server) handleTraps(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.ctrl.Traps())
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.ctrl.Jobs(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+
+	j := &entity.Job{
+		Name:      req.Name,
+		Namespace: req.Namespace,
+		Seeds:     req.Seeds,
+		Scope:     req.Scope,
+		MaxPages:  req.MaxPages,
+		Crawlers:  req.Crawlers,
+	}
+	if req.TimeLimit != "" {
+		d, err := time.ParseDuration(req.TimeLimit)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid time_limit: "+err.Error())
+			return
+		}
+		j.TimeLimit = d
+	}
+
+	if err := s.ctrl.CreateJob(r.Context(), j); err != nil {
+		writeJobError(w, err)
+		return
+	}
+
+	s.log.Info("Crawl job created", "job", j.Name, "seeds", len(j.Seeds))
+	writeJSON(w, http.StatusCreated, j)
+}
+
+func (s *Server) handleJobAction(
+	action func(Controller, context.Context, string) error,
+	done string,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if err := action(s.ctrl, r.Context(), name); err != nil {
+			writeJobError(w, err)
+			return
+		}
+
+		s.log.Info("Crawl job "+done, "job", name)
+		writeJSON(w, http.StatusOK, map[string]string{"job": name, "result": done})
+	}
+}
+
+// writeJobError maps crawl job errors to HTTP statuses.
+func writeJobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrInvalidJob):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, store.ErrJobNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, store.ErrJobExists), errors.Is(err, store.ErrJobFinished):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -4,16 +4,21 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type RedisConfig struct {
 	Addr     string
-	Password string
+	Password Secret
 	DB       int
 	Port     int
 	Delay    int
 	MaxRetry int
+
+	// Partitions is the number of host partitions the frontier is split
+	// into. It must be the same on every instance sharing this Redis.
+	Partitions int
 }
 
 type PSQLConfig struct {
@@ -21,18 +26,39 @@ type PSQLConfig struct {
 	Port     int
 	User     string
 	DBname   string
-	Password string
+	Password Secret
 
 	MaxOpenConns    int
 	MaxIdleConns    int
 	MaxConnLifetime time.Duration
 
-	BatchSize int
+	BatchSize     int           // pages written per transaction
+	FlushInterval time.Duration // longest a page waits before its batch is written
+}
+
+// FrontierConfig selects how discovered URLs are prioritized.
+type FrontierConfig struct {
+	Strategy        string        // inlinks, bfs, opic, diversity or freshness
+	SitemapWeight   float64       // weight of sitemap <priority> in seed scores
+	RecrawlAfter    time.Duration // freshness: minimum age before a recrawl
+	FreshnessWeight float64       // freshness: score per RecrawlAfter of age
+}
+
+// EventConfig controls the stream of page and graph events for downstream
+// services.
+type EventConfig struct {
+	Stream        string        // Redis stream key, empty disables events
+	MaxLen        int64         // events kept in the stream once every group acknowledged them
+	Groups        []string      // consumer groups created from the start of the stream
+	RelayInterval time.Duration // how often the outbox is relayed to the stream
+	RelayBatch    int           // events moved per relay round trip
 }
 
 type StoreConfig struct {
-	Cache RedisConfig
-	DB    PSQLConfig
+	Cache    RedisConfig
+	DB       PSQLConfig
+	Frontier FrontierConfig
+	Events   EventConfig
 }
 
 type AppConfig struct {
@@ -45,19 +71,112 @@ type AppConfig struct {
 
 	HttpTimeout    int
 	CrawlerTimeout int
+
+	MetricsAddr string // empty disables the /metrics endpoint
+
+	AdminAddr  string // empty disables the admin API
+	AdminToken Secret
+
+	StripParams []string // query parameters removed during URL canonicalization
+	HTTPSHosts  []string // hosts whose http links are upgraded to https
+
+	WarcDir     string // empty disables WARC archiving
+	WarcMaxSize int64  // bytes per WARC file before rotating
+
+	InstanceID        string        // unique per spider process sharing a Redis
+	HeartbeatInterval time.Duration // how often leases and liveness are renewed
+	LeaseTTL          time.Duration // how long a dead instance keeps its partitions
+
+	RobotsTTL      time.Duration // how long fetched robots.txt rules are trusted
+	RobotsErrorTTL time.Duration // retry delay after a 5xx or unreachable robots.txt
+	RobotsMaxSize  int64         // bytes of robots.txt parsed, the rest is ignored
+
+	FetchLogRetention time.Duration // default age past which "fetch-log prune" deletes entries
+
+	JobPollInterval time.Duration // how often crawl job status is synced with Postgres
+
+	Languages []string // BCP-47 tags of the languages crawled and indexed, empty for all
+}
+
+// TrapConfig holds the crawler trap heuristics. A zero limit disables the
+// corresponding check.
+type TrapConfig struct {
+	MaxURLLength       int // drop longer URLs
+	MaxDepth           int // drop paths with more segments
+	MaxSegmentRepeats  int // drop paths repeating a segment (run) more often
+	MaxYearsBack       int // demote dates further in the past
+	MaxYearsAhead      int // demote dates further in the future
+	MaxQueryVariants   int // demote once a host path has more distinct queries
+	MaxNumericVariants int // demote once a numeric URL template has more variants
+}
+
+// ParserConfig bounds the work spent on a page. A zero limit disables the
+// corresponding check.
+type ParserConfig struct {
+	MaxBodySize int64         // bytes of a response parsed and stored
+	MaxNodes    int           // elements and text nodes parsed
+	MaxDepth    int           // element nesting depth, deeper elements are skipped
+	Timeout     time.Duration // parse time
+}
+
+// Soft404Config controls the detection of soft 404s, error pages served
+// with 200 OK.
+type Soft404Config struct {
+	ProbeTTL    time.Duration // how long a host's answer to a nonexistent path is trusted, 0 disables probing
+	MaxDistance int           // simhash bits a page may differ in from that answer to be a soft 404
+}
+
+// FocusConfig enables focused crawling when Keywords or Examples are set.
+type FocusConfig struct {
+	Keywords     []string // topic keywords or phrases
+	Examples     []string // paths of plain-text example documents
+	Threshold    float64  // minimum relevance for a page to count as on-topic
+	MaxHops      int      // off-topic pages followed in a row before expansion stops
+	AnchorWeight float64  // share of a link's score taken from its anchor text
+}
+
+// FeedConfig controls feed discovery and polling.
+type FeedConfig struct {
+	PollInterval time.Duration // how often due feeds are polled, 0 disables polling
+	MinInterval  time.Duration // shortest time between two polls of a feed
+	MaxInterval  time.Duration // longest time between two polls of a feed
+	BatchSize    int           // feeds polled per round by an instance
+	ProbePaths   []string      // common feed paths tried on every new host
+	Weight       float64       // frontier score added to new feed items
+	MaxSize      int64         // bytes of a feed parsed, the rest is ignored
 }
 
 type Config struct {
-	App   AppConfig
-	Store StoreConfig
+	App     AppConfig
+	Store   StoreConfig
+	Trap    TrapConfig
+	Parser  ParserConfig
+	Soft404 Soft404Config
+	Focus   FocusConfig
+	Feed    FeedConfig
+
+	// Profiles are per-host request settings, matched in order
+	Profiles []FetchProfile
 }
 
 func LoadConfig() (*Config, error) {
+	profiles, err := loadFetchProfiles(getWithDefault("FETCH_PROFILES", ""))
+	if err != nil {
+		return nil, err
+	}
+
 	c := &Config{
-		App:   loadAppConfig(),
-		Store: loadStoreConfig(),
+		App:      loadAppConfig(),
+		Store:    loadStoreConfig(),
+		Trap:     loadTrapConfig(),
+		Parser:   loadParserConfig(),
+		Soft404:  loadSoft404Config(),
+		Focus:    loadFocusConfig(),
+		Feed:     loadFeedConfig(),
+		Profiles: profiles,
 	}
 
+	// credentials are Secrets and print redacted
 	fmt.Printf("%+v\n", c)
 
 	return c, nil
@@ -65,8 +184,29 @@ func LoadConfig() (*Config, error) {
 
 func loadStoreConfig() StoreConfig {
 	return StoreConfig{
-		Cache: loadRedisConfig(),
-		DB:    loadDatabaseConfig(),
+		Cache:    loadRedisConfig(),
+		DB:       loadDatabaseConfig(),
+		Frontier: loadFrontierConfig(),
+		Events:   loadEventConfig(),
+	}
+}
+
+func loadEventConfig() EventConfig {
+	return EventConfig{
+		Stream:        getWithDefault("EVENT_STREAM", ""),
+		MaxLen:        int64(getIntWithDefault("EVENT_STREAM_MAXLEN", 1_000_000)),
+		Groups:        getListWithDefault("EVENT_GROUPS", []string{"indexer", "ranker"}),
+		RelayInterval: time.Millisecond * time.Duration(getIntWithDefault("EVENT_RELAY_INTERVAL_MS", 500)),
+		RelayBatch:    getIntWithDefault("EVENT_RELAY_BATCH", 500),
+	}
+}
+
+func loadFrontierConfig() FrontierConfig {
+	return FrontierConfig{
+		Strategy:        getWithDefault("FRONTIER_STRATEGY", "inlinks"),
+		SitemapWeight:   getFloatWithDefault("SITEMAP_PRIORITY_WEIGHT", 1),
+		RecrawlAfter:    time.Hour * time.Duration(getIntWithDefault("RECRAWL_AFTER_HOURS", 168)),
+		FreshnessWeight: getFloatWithDefault("FRESHNESS_WEIGHT", 1),
 	}
 }
 
@@ -80,17 +220,19 @@ func loadDatabaseConfig() PSQLConfig {
 	maxIdleConns := getIntWithDefault("PG_MAX_IDLE_CONNS", 20)
 	maxConnLifetime := getIntWithDefault("PG_MAX_CONN_LIFETIME", 0)
 	batchSize := getIntWithDefault("PG_BATCH_SIZE", 30)
+	flushInterval := getIntWithDefault("PG_FLUSH_INTERVAL_MS", 1000)
 
 	return PSQLConfig{
 		Host:            host,
 		Port:            port,
 		User:            user,
 		DBname:          dbname,
-		Password:        password,
+		Password:        Secret(password),
 		MaxOpenConns:    maxOpenConns,
 		MaxIdleConns:    maxIdleConns,
 		MaxConnLifetime: time.Second * time.Duration(maxConnLifetime),
 		BatchSize:       batchSize,
+		FlushInterval:   time.Millisecond * time.Duration(flushInterval),
 	}
 }
 
@@ -101,14 +243,72 @@ func loadRedisConfig() RedisConfig {
 	port := getIntWithDefault("REDIS_PORT", 6379)
 	delay := getIntWithDefault("REDIS_DELAY", 5)
 	maxRetry := getIntWithDefault("REDIS_MAX_RETRY", 10)
+	partitions := getIntWithDefault("FRONTIER_PARTITIONS", 64)
 
 	return RedisConfig{
-		Addr:     addr,
-		Password: password,
-		Port:     port,
-		DB:       db,
-		Delay:    delay,
-		MaxRetry: maxRetry,
+		Addr:       addr,
+		Password:   Secret(password),
+		Port:       port,
+		DB:         db,
+		Delay:      delay,
+		MaxRetry:   maxRetry,
+		Partitions: partitions,
+	}
+}
+
+func loadTrapConfig() TrapConfig {
+	return TrapConfig{
+		MaxURLLength:       getIntWithDefault("TRAP_MAX_URL_LENGTH", 1024),
+		MaxDepth:           getIntWithDefault("TRAP_MAX_DEPTH", 12),
+		MaxSegmentRepeats:  getIntWithDefault("TRAP_MAX_SEGMENT_REPEATS", 2),
+		MaxYearsBack:       getIntWithDefault("TRAP_MAX_YEARS_BACK", 0),
+		MaxYearsAhead:      getIntWithDefault("TRAP_MAX_YEARS_AHEAD", 2),
+		MaxQueryVariants:   getIntWithDefault("TRAP_MAX_QUERY_VARIANTS", 100),
+		MaxNumericVariants: getIntWithDefault("TRAP_MAX_NUMERIC_VARIANTS", 1000),
+	}
+}
+
+func loadParserConfig() ParserConfig {
+	return ParserConfig{
+		MaxBodySize: int64(getIntWithDefault("MAX_BODY_SIZE_MB", 10)) << 20,
+		MaxNodes:    getIntWithDefault("PARSE_MAX_NODES", 500_000),
+		MaxDepth:    getIntWithDefault("PARSE_MAX_DEPTH", 256),
+		Timeout:     time.Millisecond * time.Duration(getIntWithDefault("PARSE_TIMEOUT_MS", 5000)),
+	}
+}
+
+func loadSoft404Config() Soft404Config {
+	return Soft404Config{
+		ProbeTTL:    time.Hour * time.Duration(getIntWithDefault("SOFT404_PROBE_TTL_HOURS", 168)),
+		MaxDistance: getIntWithDefault("SOFT404_MAX_DISTANCE", 6),
+	}
+}
+
+func loadFocusConfig() FocusConfig {
+	return FocusConfig{
+		Keywords:     getListWithDefault("FOCUS_KEYWORDS", nil),
+		Examples:     getListWithDefault("FOCUS_EXAMPLES", nil),
+		Threshold:    getFloatWithDefault("FOCUS_THRESHOLD", 0.1),
+		MaxHops:      getIntWithDefault("FOCUS_MAX_HOPS", 2),
+		AnchorWeight: getFloatWithDefault("FOCUS_ANCHOR_WEIGHT", 0.3),
+	}
+}
+
+func loadFeedConfig() FeedConfig {
+	probePaths := getListWithDefault("FEED_PROBE_PATHS",
+		[]string{"/feed", "/rss.xml", "/atom.xml", "/feed.xml", "/index.xml", "/feed.json"})
+	if len(probePaths) == 1 && probePaths[0] == "none" {
+		probePaths = nil
+	}
+
+	return FeedConfig{
+		PollInterval: time.Second * time.Duration(getIntWithDefault("FEED_POLL_INTERVAL", 30)),
+		MinInterval:  time.Minute * time.Duration(getIntWithDefault("FEED_MIN_INTERVAL_MINUTES", 15)),
+		MaxInterval:  time.Hour * time.Duration(getIntWithDefault("FEED_MAX_INTERVAL_HOURS", 24)),
+		BatchSize:    getIntWithDefault("FEED_BATCH_SIZE", 20),
+		ProbePaths:   probePaths,
+		Weight:       getFloatWithDefault("FEED_PRIORITY_WEIGHT", 5),
+		MaxSize:      int64(getIntWithDefault("FEED_MAX_SIZE_KB", 2048)) << 10,
 	}
 }
 
@@ -119,6 +319,25 @@ func loadAppConfig() AppConfig {
 	maxConcurrentFetch := getIntWithDefault("MAX_CONCURRENT_FETCH", 200)
 	logsPath := getWithDefault("LOGS_PATH", "./logs.json")
 	clawlerDelay := getIntWithDefault("CRAWLER_DELAY", 200)
+	metricsAddr := getWithDefault("METRICS_ADDR", "")
+	adminAddr := getWithDefault("ADMIN_ADDR", "")
+	adminToken := getWithDefault("ADMIN_TOKEN", "")
+	stripParams := getListWithDefault("URL_STRIP_PARAMS", nil)
+	httpsHosts := getListWithDefault("HTTPS_HOSTS", nil)
+	warcDir := getWithDefault("WARC_DIR", "")
+	warcMaxSize := getIntWithDefault("WARC_MAX_SIZE_MB", 1024)
+	instanceID := getWithDefault("INSTANCE_ID", defaultInstanceID())
+	heartbeatInterval := max(getIntWithDefault("HEARTBEAT_INTERVAL", 10), 1) // a ticker interval
+	// a lease outlives the crawls started under it, so a host is never
+	// fetched by two instances at once
+	leaseTTL := max(getIntWithDefault("LEASE_TTL", 90), crawlerTimeout+heartbeatInterval)
+	robotsTTL := getIntWithDefault("ROBOTS_TTL_HOURS", 24)
+	robotsErrorTTL := getIntWithDefault("ROBOTS_ERROR_TTL_MINUTES", 60)
+	robotsMaxSize := getIntWithDefault("ROBOTS_MAX_SIZE_KB", 500)
+	fetchLogRetention := getIntWithDefault("FETCH_LOG_RETENTION_DAYS", 30)
+	// tickers need a positive interval
+	jobPollInterval := max(getIntWithDefault("JOB_POLL_INTERVAL", 10), 1)
+	languages := getListWithDefault("LANGUAGES", nil)
 	return AppConfig{
 		MaxCrawlers:        maxCrawlers,
 		CrawlerTimeout:     crawlerTimeout,
@@ -126,9 +345,33 @@ func loadAppConfig() AppConfig {
 		MaxConcurrentFetch: maxConcurrentFetch,
 		LogsPath:           logsPath,
 		ClawlerDelay:       clawlerDelay,
+		MetricsAddr:        metricsAddr,
+		AdminAddr:          adminAddr,
+		AdminToken:         Secret(adminToken),
+		StripParams:        stripParams,
+		HTTPSHosts:         httpsHosts,
+		WarcDir:            warcDir,
+		WarcMaxSize:        int64(warcMaxSize) << 20,
+		InstanceID:         instanceID,
+		HeartbeatInterval:  time.Second * time.Duration(heartbeatInterval),
+		LeaseTTL:           time.Second * time.Duration(leaseTTL),
+		RobotsTTL:          time.Hour * time.Duration(robotsTTL),
+		RobotsErrorTTL:     time.Minute * time.Duration(robotsErrorTTL),
+		RobotsMaxSize:      int64(robotsMaxSize) << 10,
+		FetchLogRetention:  24 * time.Hour * time.Duration(fetchLogRetention),
+		JobPollInterval:    time.Second * time.Duration(jobPollInterval),
+		Languages:          languages,
 	}
 }
 
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "spider"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
 func getWithDefault(key, defaultValue string) string {
 	k := os.Getenv(key)
 	if k == "" {
@@ -137,6 +380,22 @@ func getWithDefault(key, defaultValue string) string {
 	return k
 }
 
+// getListWithDefault reads a comma-separated list.
+func getListWithDefault(key string, defaultValue []string) []string {
+	k := getWithDefault(key, "")
+	if k == "" {
+		return defaultValue
+	}
+
+	var l []string
+	for _, v := range strings.Split(k, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
 func getIntWithDefault(key string, defaultValue int) int {
 	k := getWithDefault(key, "")
 	v, err := strconv.Atoi(k)
@@ -145,3 +404,12 @@ func getIntWithDefault(key string, defaultValue int) int {
 	}
 	return v
 }
+
+func getFloatWithDefault(key string, defaultValue float64) float64 {
+	k := getWithDefault(key, "")
+	v, err := strconv.ParseFloat(k, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return v
+}
@@ -5,13 +5,31 @@ import (
 )
 
 type Host struct {
-	MaxRetry        int      // Maximum retries per URL
-	MaxPages        int      // Maximum pages to crawl for this host
-	PagesCrawled    int      // Pages already crawled
-	Delay           int      // Delay between requests in seconds
-	Name            string   // Hostname
-	AllowedUrls     []string // URL patterns allowed to crawl
-	NotAllowedPaths []string // Paths disallowed to crawl (typo kept for backward compatibility)
+	MaxRetry        int      `json:"maxRetry"`     // Maximum retries per URL
+	MaxPages        int      `json:"maxPages"`     // Maximum pages to crawl for this host
+	PagesCrawled    int      `json:"pagesCrawled"` // Pages already crawled
+	Delay           int      `json:"delay"`        // Delay between requests in seconds
+	Name            string   `json:"name"`         // Hostname
+	AllowedUrls     []string `json:"allow"`        // URL patterns allowed to crawl
+	NotAllowedPaths []string `json:"disallow"`     // Paths disallowed to crawl (typo kept for backward compatibility)
+	Sitemaps        []string `json:"sitemaps,omitempty"`
+
+	RobotsFetchedAt time.Time `json:"robotsFetchedAt"` // zero if robots.txt was never fetched
+	RobotsExpiresAt time.Time `json:"robotsExpiresAt"` // when robots.txt must be fetched again
+	RobotsStatus    int       `json:"robotsStatus"`    // HTTP status of the last robots.txt fetch, 0 if unreachable
+	DisallowAll     bool      `json:"disallowAll"`     // robots.txt unreachable: crawling suspended until refetched
+	ErrorCount      int       `json:"errorCount"`      // failed fetches
+	LastError       string    `json:"lastError,omitempty"`
+	LastErrorAt     time.Time `json:"lastErrorAt"`
+
+	ProbedAt          time.Time `json:"probedAt"`             // zero if a nonexistent path was never requested
+	ProbeStatus       int       `json:"probeStatus"`          // HTTP status of the nonexistent path, 0 if unreachable
+	ProbeURL          string    `json:"probeUrl,omitempty"`   // where the nonexistent path led, after redirects
+	ProbeTitle        string    `json:"probeTitle,omitempty"` // title of the page served for it, see soft404.Sign
+	ProbeHash         uint64    `json:"probeHash,omitempty"`  // simhash of its text
+	SoftNotFound      bool      `json:"softNotFound"`         // nonexistent paths are served with 200 OK
+	SoftNotFoundPages int       `json:"softNotFoundPages"`    // pages classified as soft 404s
+	Parked            bool      `json:"parked"`               // the domain serves a parking or for-sale placeholder
 }
 type MetaData struct {
 	URL         string    `json:"url"`
@@ -20,9 +38,83 @@ type MetaData struct {
 	Type        string    `json:"type,omitempty"`
 	SiteName    string    `json:"siteName,omitempty"`
 	Locale      string    `json:"locale,omitempty"`
+	Language    string    `json:"language,omitempty"` // BCP-47 tag, see lang.Identify
 	Keywords    []string  `json:"keywords,omitempty"`
 	Icons       []string  `json:"icons,omitempty"`
 	CrawledAt   time.Time `json:"crawledAt"`
+	PublishedAt time.Time `json:"publishedAt,omitzero"` // from the feed item that announced the page
+	Truncated   string    `json:"truncated,omitempty"`  // why the page was only partly parsed: size, nodes, depth or time
+
+	OpenGraph map[string]string `json:"openGraph,omitempty"` // og:, article: and product: properties, without the og: prefix
+	Twitter   map[string]string `json:"twitter,omitempty"`   // twitter: card tags, without the prefix
+	Entities  []Entity          `json:"entities,omitempty"`  // schema.org entities from JSON-LD and microdata
+
+	Alternates []Alternate `json:"alternates,omitempty"` // translations declared with hreflang
+}
+
+// Alternate is a version of a page in another language, from
+// <link rel="alternate" hreflang>.
+type Alternate struct {
+	Lang string `json:"lang"` // BCP-47 tag, or x-default for the language picker
+	URL  string `json:"url"`
+}
+
+// Entity is a schema.org entity found in JSON-LD or microdata, reduced to
+// the fields shown in rich results. Kind groups related types: an Entity of
+// Type NewsArticle has Kind Article.
+type Entity struct {
+	Kind   string `json:"kind"` // Article, Product, Recipe, Organization, BreadcrumbList or FAQPage
+	Type   string `json:"type"`
+	Source string `json:"source"` // json-ld or microdata
+
+	Name        string   `json:"name,omitempty"` // headline of articles
+	Description string   `json:"description,omitempty"`
+	URL         string   `json:"url,omitempty"`
+	Image       string   `json:"image,omitempty"`
+	Authors     []string `json:"authors,omitempty"`
+	Publisher   string   `json:"publisher,omitempty"`
+
+	DatePublished string `json:"datePublished,omitempty"` // as given, usually ISO 8601
+	DateModified  string `json:"dateModified,omitempty"`
+
+	Rating *Rating `json:"rating,omitempty"`
+	Offer  *Offer  `json:"offer,omitempty"`
+	Brand  string  `json:"brand,omitempty"`
+
+	CookTime    string   `json:"cookTime,omitempty"` // ISO 8601 durations
+	TotalTime   string   `json:"totalTime,omitempty"`
+	Yield       string   `json:"yield,omitempty"`
+	Ingredients []string `json:"ingredients,omitempty"`
+
+	Logo   string   `json:"logo,omitempty"`
+	SameAs []string `json:"sameAs,omitempty"` // profiles of an organization
+
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs,omitempty"`
+	Questions   []Question   `json:"questions,omitempty"`
+}
+
+// Rating is an aggregate rating.
+type Rating struct {
+	Value float64 `json:"value"`
+	Best  float64 `json:"best,omitempty"`
+	Count int64   `json:"count,omitempty"`
+}
+
+// Offer is the price of a product, the lowest one for a range of offers.
+type Offer struct {
+	Price        string `json:"price,omitempty"`
+	Currency     string `json:"currency,omitempty"`
+	Availability string `json:"availability,omitempty"` // e.g. InStock
+}
+
+type Breadcrumb struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type Question struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer,omitempty"`
 }
 
 type Robots struct {
@@ -32,10 +124,239 @@ type Robots struct {
 	CrawlDelay int
 }
 
+// RobotsRules are the outcome of the latest robots.txt fetch of an origin,
+// a scheme and host. They are cached apart from the host, and written only
+// by robots.txt fetches, so crawlers holding an older copy of the host
+// never put outdated rules back.
+type RobotsRules struct {
+	Origin      string    `json:"origin"` // scheme://host
+	Delay       int       `json:"delay"`
+	Allow       []string  `json:"allow"`
+	Disallow    []string  `json:"disallow"`
+	Sitemaps    []string  `json:"sitemaps,omitempty"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	Status      int       `json:"status"`      // HTTP status, 0 if unreachable
+	DisallowAll bool      `json:"disallowAll"` // unreachable without earlier rules
+}
+
+// ApplyRobots copies the rules of one of the host's origins into its
+// robots.txt fields.
+func (h *Host) ApplyRobots(r *RobotsRules) {
+	h.Delay = r.Delay
+	h.AllowedUrls = r.Allow
+	h.NotAllowedPaths = r.Disallow
+	h.Sitemaps = r.Sitemaps
+	h.RobotsFetchedAt = r.FetchedAt
+	h.RobotsExpiresAt = r.ExpiresAt
+	h.RobotsStatus = r.Status
+	h.DisallowAll = r.DisallowAll
+}
+
+// MergeProbe keeps the probe results of cached, a copy of h read from the
+// cache, when they are newer than h's: they are written by background
+// probes while crawlers hold older copies.
+func (h *Host) MergeProbe(cached *Host) {
+	if !cached.ProbedAt.After(h.ProbedAt) {
+		return
+	}
+	h.ProbedAt = cached.ProbedAt
+	h.ProbeStatus = cached.ProbeStatus
+	h.ProbeURL = cached.ProbeURL
+	h.ProbeTitle = cached.ProbeTitle
+	h.ProbeHash = cached.ProbeHash
+	h.SoftNotFound = cached.SoftNotFound
+	h.Parked = cached.Parked
+}
+
+type SitemapURL struct {
+	Loc      string
+	Priority float64 // <priority>, 0.5 when missing
+}
+
+// LinkSource is the markup a link was found in.
+type LinkSource string
+
+const (
+	LinkAnchor   LinkSource = "a"        // <a href>
+	LinkArea     LinkSource = "area"     // <area href> of image maps
+	LinkFrame    LinkSource = "frame"    // <iframe src> and <frame src>
+	LinkRefresh  LinkSource = "refresh"  // <meta http-equiv="refresh"> redirect
+	LinkRel      LinkSource = "rel"      // <link rel="next|prev|alternate|amphtml">
+	LinkHreflang LinkSource = "hreflang" // <link rel="alternate" hreflang>
+	LinkImage    LinkSource = "img"      // <img src>
+	LinkSrcset   LinkSource = "srcset"   // srcset of <img> and <picture><source>
+)
+
+// Link is a URL found on a page, tagged with where it was found.
+type Link struct {
+	URL    string     `json:"url"`
+	Source LinkSource `json:"source"`
+	Lang   string     `json:"lang,omitempty"` // BCP-47 tag of the target, from hreflang
+}
+
 type Page struct {
 	MetaData          // embeds MetaData
 	StatusCode int    // HTTP response code
 	HTML       []byte // Raw HTML content
-	Images     []string
-	Links      []string
+
+	HTMLLang        string // lang attribute of <html>
+	ContentLanguage string // Content-Language response header
+
+	Outlinks []Link   // every link found, routed into Links and Images by the store
+	Images   []string // image URLs
+	Links    []string // URLs to crawl
+	Feeds    []string // RSS, Atom and JSON feeds announced with <link rel="alternate">
+	Embeds   []string // URLs of the scripts and frames the page loads
+
+	DemotedLinks []string // suspected trap links, stored but crawled last
+
+	Priority float64 // frontier score of the URL when it was popped
+
+	Text      string            // visible text, used for relevance scoring
+	Anchors   map[string]string // anchor text by link URL
+	Relevance float64           // topical relevance in focused crawling
+
+	WarcFile   string // WARC file holding the raw response, empty if not archived
+	WarcOffset int64  // offset of the response record in WarcFile
+
+	ContentHash string // hex SHA-256 of the normalized text, see utils.ContentHash
+}
+
+// Deferral is a fetch put off because its host was still within its crawl
+// delay, with the delay left.
+type Deferral struct {
+	Host string
+	Wait time.Duration
+}
+
+// Fetch is one HTTP fetch attempt, as recorded in the fetch log.
+type Fetch struct {
+	URL         string
+	FetchedAt   time.Time
+	Status      int           // 0 when no response was received
+	Latency     time.Duration // until the response body was closed
+	Bytes       int64         // response body bytes read
+	ContentType string
+	ErrorClass  string // empty on success, e.g. "timeout" or "http_5xx"
+	Worker      int    // crawler id, 0 for background fetches
+	Instance    string
+}
+
+// Feed is an RSS, Atom or JSON feed polled for new URLs on behalf of a
+// crawl job.
+type Feed struct {
+	Job   string `json:"job"`
+	URL   string `json:"url"`
+	Host  string `json:"host"`
+	Probe bool   `json:"probe"` // found by trying a common path, dropped if it is not a feed
+
+	Interval     time.Duration `json:"interval"` // adapted to how often the feed has new items
+	NextPollAt   time.Time     `json:"nextPollAt"`
+	LastPolledAt time.Time     `json:"lastPolledAt"`
+	LastItemAt   time.Time     `json:"lastItemAt"` // newest publication date seen
+	SeenItems    []string      `json:"-"`          // keys of the items of the last poll
+
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+
+	ItemsFound int64  `json:"itemsFound"` // new items pushed into the frontier
+	ErrorCount int    `json:"errorCount"`
+	LastError  string `json:"lastError,omitempty"`
+}
+
+// FeedItem is an entry of a feed.
+type FeedItem struct {
+	URL       string
+	ID        string    // guid, Atom id or JSON Feed id; empty when the feed gives none
+	Published time.Time // zero when the feed gives no date
+}
+
+// Key identifies the item across polls: its ID, or else its URL.
+func (it FeedItem) Key() string {
+	if it.ID != "" {
+		return it.ID
+	}
+	return it.URL
+}
+
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobPaused    JobStatus = "paused"
+	JobCompleted JobStatus = "completed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// Finished reports whether the job can no longer be resumed.
+func (s JobStatus) Finished() bool {
+	return s == JobCompleted || s == JobCancelled
+}
+
+// Job is a named crawl with its own seeds, scope, budgets and Redis key
+// namespace.
+type Job struct {
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace"` // prefix of the job's Redis keys, empty for the default job
+	Seeds     []string `json:"seeds"`
+	Scope     []string `json:"scope,omitempty"` // hosts or URL prefixes links must match, empty for no limit
+
+	MaxPages  int64         `json:"maxPages,omitempty"`  // 0 for no limit
+	TimeLimit time.Duration `json:"timeLimit,omitempty"` // from StartedAt, 0 for no limit
+	Crawlers  int           `json:"crawlers,omitempty"`  // 0 for MAX_CRAWLERS
+
+	Status       JobStatus `json:"status"`
+	FinishReason string    `json:"finishReason,omitempty"` // page_budget, time_limit or frontier_empty
+	PagesCrawled int64     `json:"pagesCrawled"`
+	CreatedAt    time.Time `json:"createdAt"`
+	StartedAt    time.Time `json:"startedAt"`
+	FinishedAt   time.Time `json:"finishedAt"`
+}
+
+// EventVersion is the schema version of event payloads. It changes when a
+// field is removed or changes meaning, not when one is added.
+const EventVersion = 1
+
+// EventType names what an event reports.
+type EventType string
+
+const (
+	EventPageCreated EventType = "page.created" // a URL got a page, payload PageEvent
+	EventPageUpdated EventType = "page.updated" // a recrawled page changed, payload PageEvent
+	EventPageDeleted EventType = "page.deleted" // a recrawled page left the index, payload PageEvent
+	EventEdgesAdded  EventType = "edges.added"  // a batch added graph edges, payload EdgesEvent
+)
+
+// Event is a change to the stored pages or link graph, written to the
+// outbox with the change and relayed to the event stream.
+type Event struct {
+	ID        int64 // outbox id, increasing
+	Type      EventType
+	Version   int
+	Payload   []byte // JSON
+	CreatedAt time.Time
+}
+
+// PageEvent is the payload of page events.
+type PageEvent struct {
+	PageID      string    `json:"pageId"`
+	URLID       string    `json:"urlId"`
+	URL         string    `json:"url"`
+	ContentHash string    `json:"contentHash,omitempty"`
+	Language    string    `json:"language,omitempty"`
+	CrawledAt   time.Time `json:"crawledAt"`
+}
+
+// EdgesEvent is the payload of edges.added: the pages whose outgoing
+// edges were added by one batch.
+type EdgesEvent struct {
+	Edges   int          `json:"edges"` // edges added in all
+	Sources []EdgeSource `json:"sources"`
+}
+
+type EdgeSource struct {
+	URLID string `json:"urlId"`
+	URL   string `json:"url"`
+	Edges int    `json:"edges"`
 }
@@ -0,0 +1,227 @@
+// Package feed parses RSS 2.0, RSS 1.0 (RDF), Atom and JSON Feed documents
+// into the URLs and publication dates of their items.
+package feed
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+)
+
+var ErrNotFeed = errors.New("not a feed")
+
+// Parse returns the items of the feed in body. Relative item links are
+// resolved against base, the feed URL.
+func Parse(body []byte, base *url.URL) ([]entity.FeedItem, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil, ErrNotFeed
+	}
+
+	var (
+		items []entity.FeedItem
+		err   error
+	)
+	if trimmed[0] == '{' {
+		items, err = parseJSON(trimmed)
+	} else {
+		items, err = parseXML(trimmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := items[:0]
+	for _, it := range items {
+		u, ok := resolve(base, it.URL)
+		if !ok {
+			continue
+		}
+		it.URL = u
+		out = append(out, it)
+	}
+	return out, nil
+}
+
+// xmlFeed holds the elements of the three XML formats; only the one
+// matching the root element is filled.
+type xmlFeed struct {
+	XMLName xml.Name
+	Channel struct {
+		Items []xmlItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []xmlItem   `xml:"item"`  // RSS 1.0, items are siblings of <channel>
+	Entries []atomEntry `xml:"entry"` // Atom
+}
+
+type xmlItem struct {
+	Links   []string `xml:"link"` // also matches empty <atom:link> elements
+	GUID    string   `xml:"guid"`
+	PubDate string   `xml:"pubDate"`
+	DCDate  string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type atomEntry struct {
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	ID        string `xml:"id"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+}
+
+func parseXML(body []byte) ([]entity.FeedItem, error) {
+	var f xmlFeed
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.Strict = false
+	// URLs and dates are ASCII, so other charsets can be read as they are
+	d.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	if err := d.Decode(&f); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotFeed, err)
+	}
+
+	var items []entity.FeedItem
+	switch strings.ToLower(f.XMLName.Local) {
+	case "rss":
+		for _, it := range f.Channel.Items {
+			items = append(items, rssItem(it))
+		}
+	case "rdf":
+		for _, it := range f.Items {
+			items = append(items, rssItem(it))
+		}
+	case "feed":
+		for _, e := range f.Entries {
+			items = append(items, atomItem(e))
+		}
+	default:
+		return nil, fmt.Errorf("%w: root element <%s>", ErrNotFeed, f.XMLName.Local)
+	}
+	return items, nil
+}
+
+func rssItem(it xmlItem) entity.FeedItem {
+	var link string
+	for _, l := range it.Links {
+		if link = strings.TrimSpace(l); link != "" {
+			break
+		}
+	}
+	if link == "" {
+		// a guid is a permalink unless isPermaLink="false", which
+		// resolve rejects anyway when it is not a URL
+		link = strings.TrimSpace(it.GUID)
+	}
+	date := it.PubDate
+	if date == "" {
+		date = it.DCDate
+	}
+	return entity.FeedItem{URL: link, ID: strings.TrimSpace(it.GUID), Published: parseDate(date)}
+}
+
+func atomItem(e atomEntry) entity.FeedItem {
+	var link string
+	for _, l := range e.Links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			link = l.Href
+			break
+		}
+	}
+	date := e.Published
+	if date == "" {
+		date = e.Updated
+	}
+	return entity.FeedItem{URL: strings.TrimSpace(link), ID: strings.TrimSpace(e.ID), Published: parseDate(date)}
+}
+
+type jsonFeed struct {
+	Version string `json:"version"`
+	Items   []struct {
+		ID            any    `json:"id"` // a string, or a number in some feeds
+		URL           string `json:"url"`
+		ExternalURL   string `json:"external_url"`
+		DatePublished string `json:"date_published"`
+		DateModified  string `json:"date_modified"`
+	} `json:"items"`
+}
+
+func parseJSON(body []byte) ([]entity.FeedItem, error) {
+	var f jsonFeed
+	if err := json.Unmarshal(body, &f); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotFeed, err)
+	}
+	if !strings.Contains(f.Version, "jsonfeed.org") {
+		return nil, fmt.Errorf("%w: missing JSON Feed version", ErrNotFeed)
+	}
+
+	items := make([]entity.FeedItem, 0, len(f.Items))
+	for _, it := range f.Items {
+		link := it.URL
+		if link == "" {
+			link = it.ExternalURL
+		}
+		date := it.DatePublished
+		if date == "" {
+			date = it.DateModified
+		}
+		var id string
+		if it.ID != nil {
+			id = strings.TrimSpace(fmt.Sprint(it.ID))
+		}
+		items = append(items, entity.FeedItem{URL: link, ID: id, Published: parseDate(date)})
+	}
+	return items, nil
+}
+
+// dateLayouts are the date formats found in feeds: RFC 822 variants for
+// RSS, RFC 3339 for Atom, JSON Feed and Dublin Core.
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+func parseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+func resolve(base *url.URL, ref string) (string, bool) {
+	r, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || ref == "" {
+		return "", false
+	}
+	if base != nil {
+		r = base.ResolveReference(r)
+	}
+	if (r.Scheme != "http" && r.Scheme != "https") || r.Host == "" {
+		return "", false
+	}
+	return r.String(), true
+}
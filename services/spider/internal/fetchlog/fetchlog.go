@@ -0,0 +1,132 @@
+package fetchlog
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+)
+
+// Recorder receives every fetch attempt made through a Transport.
+type Recorder interface {
+	RecordFetch(f entity.Fetch)
+}
+
+type workerKey struct{}
+
+// WithWorker tags requests made with the returned context with a crawler id.
+func WithWorker(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, workerKey{}, id)
+}
+
+// Transport records every request passing through it, redirects and
+// retries included. Successful exchanges are recorded when the response
+// body is closed, so latency and size cover the whole body.
+type Transport struct {
+	Base     http.RoundTripper
+	Recorder Recorder
+	Instance string
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	f := entity.Fetch{
+		URL:       req.URL.String(),
+		FetchedAt: time.Now(),
+		Instance:  t.Instance,
+	}
+	if id, ok := req.Context().Value(workerKey{}).(int); ok {
+		f.Worker = id
+	}
+
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		f.Latency = time.Since(f.FetchedAt)
+		f.ErrorClass = ClassifyError(err)
+		t.Recorder.RecordFetch(f)
+		return nil, err
+	}
+
+	f.Status = res.StatusCode
+	f.ContentType = res.Header.Get("Content-Type")
+	res.Body = &countingBody{ReadCloser: res.Body, t: t, fetch: f}
+	return res, nil
+}
+
+type countingBody struct {
+	io.ReadCloser
+	t       *Transport
+	fetch   entity.Fetch
+	readErr error
+	closed  bool
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.fetch.Bytes += int64(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		b.readErr = err
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.closed {
+		return err
+	}
+	b.closed = true
+
+	b.fetch.Latency = time.Since(b.fetch.FetchedAt)
+	switch {
+	case b.readErr != nil:
+		b.fetch.ErrorClass = ClassifyError(b.readErr)
+	case b.fetch.Status >= 400:
+		b.fetch.ErrorClass = "http_" + strconv.Itoa(b.fetch.Status/100) + "xx"
+	}
+	b.t.Recorder.RecordFetch(b.fetch)
+	return err
+}
+
+// ClassifyError maps a transport error to a short class for aggregation.
+func ClassifyError(err error) string {
+	var (
+		dnsErr  *net.DNSError
+		netErr  net.Error
+		certErr *tls.CertificateVerificationError
+		unkAuth x509.UnknownAuthorityError
+		hostErr x509.HostnameError
+		recErr  tls.RecordHeaderError
+	)
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.ErrUnexpectedEOF):
+		return "connection_reset"
+	case errors.As(err, &certErr), errors.As(err, &unkAuth), errors.As(err, &hostErr), errors.As(err, &recErr):
+		return "tls"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	default:
+		return "other"
+	}
+}
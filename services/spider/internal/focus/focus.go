@@ -0,0 +1,161 @@
+package focus
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/config"
+)
+
+// maxTerms bounds the document frequency table. Terms first seen after it
+// is full are scored as if they were rare.
+const maxTerms = 200_000
+
+var stopwords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`a about above after again against all am an and any are as at be
+		because been before being below between both but by can could did do does doing down during
+		each few for from further had has have having he her here hers herself him himself his how i
+		if in into is it its itself just me more most my myself no nor not now of off on once only or
+		other our ours ourselves out over own same she should so some such than that the their theirs
+		them themselves then there these they this those through to too under until up very was we
+		were what when where which while who whom why will with would you your yours yourself
+		yourselves`) {
+		stopwords[w] = true
+	}
+}
+
+// Classifier scores text for topical relevance with a TF-IDF centroid: the
+// topic profile is the mean term vector of the keywords and example
+// documents, and a text's relevance is its cosine similarity to the profile.
+// Document frequencies are learned online from crawled pages.
+type Classifier struct {
+	centroid map[string]float64
+
+	mu   sync.RWMutex
+	df   map[string]int
+	docs int
+}
+
+// NewClassifier builds the topic profile from conf.Keywords, taken together
+// as one document, and each file in conf.Examples.
+func NewClassifier(conf config.FocusConfig) (*Classifier, error) {
+	c := &Classifier{
+		centroid: map[string]float64{},
+		df:       map[string]int{},
+	}
+
+	var profiles []map[string]float64
+	if len(conf.Keywords) > 0 {
+		profiles = append(profiles, termFreq(Tokenize(strings.Join(conf.Keywords, " "))))
+	}
+	for _, path := range conf.Examples {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read focus example: %w", err)
+		}
+		text := string(b)
+		c.Learn(text)
+		profiles = append(profiles, termFreq(Tokenize(text)))
+	}
+
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("focused crawling needs keywords or example documents")
+	}
+
+	for _, p := range profiles {
+		for t, w := range p {
+			c.centroid[t] += w / float64(len(profiles))
+		}
+	}
+	if len(c.centroid) == 0 {
+		return nil, fmt.Errorf("focus keywords and examples contain no usable terms")
+	}
+	return c, nil
+}
+
+// Learn counts the terms of a crawled document towards document frequencies.
+func (c *Classifier) Learn(text string) {
+	seen := map[string]bool{}
+	for _, t := range Tokenize(text) {
+		seen[t] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.docs++
+	for t := range seen {
+		if _, ok := c.df[t]; ok || len(c.df) < maxTerms {
+			c.df[t]++
+		}
+	}
+}
+
+// Relevance returns the cosine similarity between text and the topic
+// profile, from 0 (unrelated) to 1.
+func (c *Classifier) Relevance(text string) float64 {
+	tf := termFreq(Tokenize(text))
+	if len(tf) == 0 {
+		return 0
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var dot, docNorm, topicNorm float64
+	for t, w := range tf {
+		x := w * c.idf(t)
+		docNorm += x * x
+		if cw, ok := c.centroid[t]; ok {
+			dot += x * cw * c.idf(t)
+		}
+	}
+	for t, cw := range c.centroid {
+		y := cw * c.idf(t)
+		topicNorm += y * y
+	}
+
+	if dot == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(docNorm) * math.Sqrt(topicNorm))
+}
+
+func (c *Classifier) idf(term string) float64 {
+	return math.Log(float64(c.docs+1)/float64(c.df[term]+1)) + 1
+}
+
+// Tokenize lowercases text and splits it into letter and digit runs,
+// dropping stopwords and single characters.
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := fields[:0]
+	for _, f := range fields {
+		if len([]rune(f)) < 2 || stopwords[f] {
+			continue
+		}
+		tokens = append(tokens, f)
+	}
+	return tokens
+}
+
+// termFreq returns the term frequencies of tokens, normalized by length.
+func termFreq(tokens []string) map[string]float64 {
+	tf := make(map[string]float64, len(tokens))
+	for _, t := range tokens {
+		tf[t]++
+	}
+	for t := range tf {
+		tf[t] /= float64(len(tokens))
+	}
+	return tf
+}
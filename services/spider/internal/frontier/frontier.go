@@ -0,0 +1,326 @@
+package frontier
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/config"
+)
+
+// Mode is how an Entry's score is applied to the URL's frontier score.
+type Mode int
+
+const (
+	Incr     Mode = iota // add to the current score
+	Max                  // keep the higher of the current and new score
+	SetIfNew             // only set the score of URLs not yet queued
+)
+
+// Entry is a scored URL ready to be pushed into the frontier. The frontier
+// pops the highest score first.
+type Entry struct {
+	URL   string
+	Score float64
+	Mode  Mode
+
+	// Recrawl lets an already visited URL back into the frontier.
+	Recrawl bool
+
+	// Published is the publication date of a feed item, kept until the
+	// URL is popped when the entry is queued.
+	Published time.Time
+}
+
+// Parent describes the page the links were found on.
+type Parent struct {
+	URL   string
+	Score float64 // the page's frontier score when it was popped
+
+	Relevance float64           // topical relevance, set in focused crawling
+	Anchors   map[string]string // anchor text by link URL
+}
+
+// State is the frontier state some strategies need to score links.
+type State interface {
+	// NextHostSeq increments and returns a per-host sequence number for
+	// each URL, in order.
+	NextHostSeq(ctx context.Context, urls []string) ([]int64, error)
+	// LastCrawled returns when each URL was last crawled; never crawled
+	// URLs are missing from the map.
+	LastCrawled(ctx context.Context, urls []string) (map[string]time.Time, error)
+	// Hops returns how many off-topic pages in a row led to u.
+	Hops(ctx context.Context, u string) (int, error)
+	// SetHops records hops for each URL, keeping the lowest value seen.
+	SetHops(ctx context.Context, urls []string, hops int) error
+}
+
+// Prioritizer decides the frontier score of seeds and discovered links.
+type Prioritizer interface {
+	Name() string
+	// Seed scores URLs that have no parent: start URLs and sitemap entries.
+	Seed(ctx context.Context, urls []string) ([]Entry, error)
+	// Score scores the links found on parent. It may drop links.
+	Score(ctx context.Context, parent Parent, links []string) ([]Entry, error)
+}
+
+// New returns the prioritizer selected by conf.Strategy.
+func New(conf config.FrontierConfig, state State) (Prioritizer, error) {
+	switch conf.Strategy {
+	case "", "inlinks":
+		return inLinks{}, nil
+	case "bfs":
+		return bfs{}, nil
+	case "opic":
+		return opic{}, nil
+	case "diversity":
+		return diversity{state: state}, nil
+	case "freshness":
+		return freshness{
+			state:        state,
+			recrawlAfter: conf.RecrawlAfter,
+			weight:       conf.FreshnessWeight,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown frontier strategy %q", conf.Strategy)
+	}
+}
+
+// WithSitemapPriority adds weight times each URL's sitemap <priority> to
+// its seed score. URLs without a priority use the sitemap default of 0.5.
+func WithSitemapPriority(entries []Entry, priorities map[string]float64, weight float64) []Entry {
+	for i := range entries {
+		p, ok := priorities[entries[i].URL]
+		if !ok {
+			p = 0.5
+		}
+		entries[i].Score += weight * p
+	}
+	return entries
+}
+
+// WithPublished adds weight to the seed score of feed items, halved for
+// every day since their publication, and sets their publication date.
+// Items without a date get half the weight.
+func WithPublished(entries []Entry, published map[string]time.Time, weight float64, now time.Time) []Entry {
+	for i := range entries {
+		t, ok := published[entries[i].URL]
+		if !ok {
+			entries[i].Score += weight / 2
+			continue
+		}
+		days := max(now.Sub(t).Hours()/24, 0)
+		entries[i].Score += weight * math.Pow(0.5, days)
+		entries[i].Published = t
+	}
+	return entries
+}
+
+// Demote lowers the score of the entries whose URL is in urls by penalty.
+func Demote(entries []Entry, urls []string, penalty float64) []Entry {
+	if len(urls) == 0 {
+		return entries
+	}
+
+	demoted := make(map[string]bool, len(urls))
+	for _, u := range urls {
+		demoted[u] = true
+	}
+	for i := range entries {
+		if demoted[entries[i].URL] {
+			entries[i].Score -= penalty
+		}
+	}
+	return entries
+}
+
+func entries(urls []string, score float64, mode Mode) []Entry {
+	e := make([]Entry, len(urls))
+	for i, u := range urls {
+		e[i] = Entry{URL: u, Score: score, Mode: mode}
+	}
+	return e
+}
+
+// inLinks ranks URLs by how many times they were linked to. It favors
+// sitewide navigation links and is the historical default.
+type inLinks struct{}
+
+func (inLinks) Name() string { return "inlinks" }
+
+func (inLinks) Seed(_ context.Context, urls []string) ([]Entry, error) {
+	return entries(urls, 1, Incr), nil
+}
+
+func (inLinks) Score(_ context.Context, _ Parent, links []string) ([]Entry, error) {
+	return entries(links, 1, Incr), nil
+}
+
+// bfs crawls breadth-first: the score is minus the link depth, so seeds
+// (depth 0) come first and each URL keeps its shallowest depth.
+type bfs struct{}
+
+func (bfs) Name() string { return "bfs" }
+
+func (bfs) Seed(_ context.Context, urls []string) ([]Entry, error) {
+	return entries(urls, 0, Max), nil
+}
+
+func (bfs) Score(_ context.Context, parent Parent, links []string) ([]Entry, error) {
+	return entries(links, parent.Score-1, Max), nil
+}
+
+// opic implements On-line Page Importance Computation: every page starts
+// with cash, and when it is crawled its cash is split evenly between its
+// outlinks. URLs accumulating the most cash are crawled first.
+type opic struct{}
+
+func (opic) Name() string { return "opic" }
+
+func (opic) Seed(_ context.Context, urls []string) ([]Entry, error) {
+	return entries(urls, 1, Incr), nil
+}
+
+func (opic) Score(_ context.Context, parent Parent, links []string) ([]Entry, error) {
+	if len(links) == 0 {
+		return nil, nil
+	}
+	cash := parent.Score
+	if cash <= 0 {
+		cash = 1
+	}
+	return entries(links, cash/float64(len(links)), Incr), nil
+}
+
+// diversity interleaves hosts round-robin: the n-th URL queued for a host
+// gets score -n, so the frontier serves the first URL of every host before
+// the second URL of any.
+type diversity struct {
+	state State
+}
+
+func (diversity) Name() string { return "diversity" }
+
+func (d diversity) Seed(ctx context.Context, urls []string) ([]Entry, error) {
+	return d.score(ctx, urls)
+}
+
+func (d diversity) Score(ctx context.Context, _ Parent, links []string) ([]Entry, error) {
+	return d.score(ctx, links)
+}
+
+func (d diversity) score(ctx context.Context, urls []string) ([]Entry, error) {
+	seqs, err := d.state.NextHostSeq(ctx, urls)
+	if err != nil {
+		return nil, err
+	}
+
+	e := make([]Entry, len(urls))
+	for i, u := range urls {
+		e[i] = Entry{URL: u, Score: -float64(seqs[i]), Mode: SetIfNew}
+	}
+	return e, nil
+}
+
+// freshness queues new URLs by in-link count and lets crawled URLs back in
+// once they are older than recrawlAfter, scored by how stale they are.
+type freshness struct {
+	state        State
+	recrawlAfter time.Duration
+	weight       float64
+}
+
+func (freshness) Name() string { return "freshness" }
+
+func (f freshness) Seed(ctx context.Context, urls []string) ([]Entry, error) {
+	return f.score(ctx, urls)
+}
+
+func (f freshness) Score(ctx context.Context, _ Parent, links []string) ([]Entry, error) {
+	return f.score(ctx, links)
+}
+
+func (f freshness) score(ctx context.Context, urls []string) ([]Entry, error) {
+	crawled, err := f.state.LastCrawled(ctx, urls)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	e := make([]Entry, 0, len(urls))
+	for _, u := range urls {
+		last, ok := crawled[u]
+		if !ok {
+			e = append(e, Entry{URL: u, Score: 1, Mode: Incr})
+			continue
+		}
+
+		age := now.Sub(last)
+		if f.recrawlAfter <= 0 || age < f.recrawlAfter {
+			continue
+		}
+		e = append(e, Entry{
+			URL:     u,
+			Score:   f.weight * float64(age) / float64(f.recrawlAfter),
+			Mode:    Max,
+			Recrawl: true,
+		})
+	}
+	return e, nil
+}
+
+// Classifier scores text for topical relevance between 0 and 1.
+type Classifier interface {
+	Relevance(text string) float64
+}
+
+// Focused returns a best-first prioritizer for topical crawling. Links
+// inherit the parent's relevance, blended with the relevance of their
+// anchor text. Links found on off-topic pages carry a hop count, and pages
+// more than conf.MaxHops off-topic hops away from a relevant page are not
+// expanded.
+func Focused(c Classifier, conf config.FocusConfig, state State) Prioritizer {
+	return focused{classifier: c, conf: conf, state: state}
+}
+
+type focused struct {
+	classifier Classifier
+	conf       config.FocusConfig
+	state      State
+}
+
+func (focused) Name() string { return "focused" }
+
+func (focused) Seed(_ context.Context, urls []string) ([]Entry, error) {
+	return entries(urls, 1, Max), nil
+}
+
+func (f focused) Score(ctx context.Context, parent Parent, links []string) ([]Entry, error) {
+	hops := 0
+	if parent.Relevance < f.conf.Threshold {
+		h, err := f.state.Hops(ctx, parent.URL)
+		if err != nil {
+			return nil, err
+		}
+		hops = h + 1
+		if hops > f.conf.MaxHops {
+			return nil, nil
+		}
+	}
+
+	if err := f.state.SetHops(ctx, links, hops); err != nil {
+		return nil, err
+	}
+
+	w := f.conf.AnchorWeight
+	e := make([]Entry, len(links))
+	for i, u := range links {
+		score := (1 - w) * parent.Relevance
+		if anchor := parent.Anchors[u]; anchor != "" {
+			score += w * f.classifier.Relevance(anchor)
+		}
+		e[i] = Entry{URL: u, Score: score, Mode: Max}
+	}
+	return e, nil
+}
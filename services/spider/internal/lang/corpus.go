@@ -0,0 +1,169 @@
+package lang
+
+// samples are the texts the n-gram profiles are built from: everyday prose
+// rich in the function words and endings that tell languages apart.
+var samples = map[string]string{
+	"en": `The city council met on Tuesday evening to discuss the new plan for the
+		old market square. Most of the people who came to the meeting said that they
+		would like more trees, wider sidewalks and fewer cars in the centre of town.
+		According to the mayor, the work should start next spring and it will take
+		about two years to finish. Some shop owners are worried that their business
+		will suffer while the street is closed, but others believe that a quieter and
+		greener square will bring more visitors in the long run. If you have any
+		questions about the project, you can read the full report on our website or
+		write to the office. We have also published a short guide which explains how
+		the changes will affect parking, deliveries and public transport. Thank you
+		for your interest and for taking the time to share your thoughts with us.
+		This is what we heard, what we learned and what we are going to do next.`,
+
+	"fr": `Le conseil municipal s'est réuni mardi soir pour discuter du nouveau projet
+		de la vieille place du marché. La plupart des habitants qui étaient présents ont
+		dit qu'ils voudraient plus d'arbres, des trottoirs plus larges et moins de
+		voitures dans le centre de la ville. Selon le maire, les travaux devraient
+		commencer au printemps prochain et ils dureront environ deux ans. Certains
+		commerçants craignent que leur activité souffre pendant la fermeture de la rue,
+		mais d'autres pensent qu'une place plus calme et plus verte attirera davantage
+		de visiteurs à long terme. Si vous avez des questions sur ce projet, vous pouvez
+		lire le rapport complet sur notre site ou écrire à la mairie. Nous avons aussi
+		publié un petit guide qui explique comment les changements vont toucher le
+		stationnement, les livraisons et les transports en commun. Merci de votre
+		intérêt et du temps que vous avez pris pour partager votre avis avec nous.`,
+
+	"de": `Der Stadtrat hat sich am Dienstagabend getroffen, um über den neuen Plan für
+		den alten Marktplatz zu sprechen. Die meisten Menschen, die zu der Sitzung
+		gekommen sind, wünschen sich mehr Bäume, breitere Gehwege und weniger Autos in
+		der Innenstadt. Nach Angaben des Bürgermeisters sollen die Arbeiten im nächsten
+		Frühjahr beginnen und etwa zwei Jahre dauern. Einige Ladenbesitzer machen sich
+		Sorgen, dass ihr Geschäft leidet, während die Straße gesperrt ist, aber andere
+		glauben, dass ein ruhigerer und grünerer Platz auf lange Sicht mehr Besucher
+		anziehen wird. Wenn Sie Fragen zu dem Projekt haben, können Sie den vollständigen
+		Bericht auf unserer Webseite lesen oder uns schreiben. Wir haben außerdem eine
+		kurze Anleitung veröffentlicht, die erklärt, wie sich die Änderungen auf das
+		Parken, die Lieferungen und den öffentlichen Verkehr auswirken. Vielen Dank für
+		Ihr Interesse und dafür, dass Sie sich die Zeit genommen haben.`,
+
+	"es": `El ayuntamiento se reunió el martes por la noche para hablar del nuevo plan
+		para la vieja plaza del mercado. La mayoría de las personas que vinieron a la
+		reunión dijeron que les gustaría tener más árboles, aceras más anchas y menos
+		coches en el centro de la ciudad. Según el alcalde, las obras deberían empezar
+		la próxima primavera y durarán unos dos años. Algunos dueños de tiendas temen
+		que su negocio sufra mientras la calle esté cerrada, pero otros creen que una
+		plaza más tranquila y más verde traerá más visitantes a largo plazo. Si tiene
+		alguna pregunta sobre el proyecto, puede leer el informe completo en nuestra
+		página o escribir a la oficina. También hemos publicado una pequeña guía que
+		explica cómo los cambios afectarán al aparcamiento, a las entregas y al
+		transporte público. Gracias por su interés y por dedicar su tiempo a compartir
+		sus opiniones con nosotros.`,
+
+	"it": `Il consiglio comunale si è riunito martedì sera per discutere del nuovo
+		progetto per la vecchia piazza del mercato. La maggior parte delle persone che
+		sono venute alla riunione ha detto che vorrebbe più alberi, marciapiedi più
+		larghi e meno macchine nel centro della città. Secondo il sindaco, i lavori
+		dovrebbero cominciare la prossima primavera e dureranno circa due anni. Alcuni
+		negozianti temono che la loro attività ne soffra mentre la strada è chiusa, ma
+		altri pensano che una piazza più tranquilla e più verde porterà più visitatori
+		nel lungo periodo. Se avete domande sul progetto, potete leggere la relazione
+		completa sul nostro sito oppure scrivere all'ufficio. Abbiamo anche pubblicato
+		una breve guida che spiega come i cambiamenti riguarderanno il parcheggio, le
+		consegne e i trasporti pubblici. Grazie per il vostro interesse e per il tempo
+		che avete dedicato a condividere le vostre opinioni con noi.`,
+
+	"pt": `A câmara municipal reuniu-se na terça-feira à noite para discutir o novo
+		plano para a velha praça do mercado. A maioria das pessoas que vieram à reunião
+		disse que gostaria de ter mais árvores, passeios mais largos e menos carros no
+		centro da cidade. Segundo o presidente da câmara, as obras deverão começar na
+		próxima primavera e vão durar cerca de dois anos. Alguns comerciantes estão
+		preocupados que o seu negócio sofra enquanto a rua estiver fechada, mas outros
+		acreditam que uma praça mais tranquila e mais verde vai trazer mais visitantes a
+		longo prazo. Se tiver alguma pergunta sobre o projeto, pode ler o relatório
+		completo no nosso site ou escrever para os serviços. Também publicámos um pequeno
+		guia que explica como as mudanças vão afetar o estacionamento, as entregas e os
+		transportes públicos. Obrigado pelo seu interesse e pelo tempo que dedicou a
+		partilhar a sua opinião connosco. Não deixe de voltar em breve.`,
+
+	"nl": `De gemeenteraad is dinsdagavond bij elkaar gekomen om te praten over het
+		nieuwe plan voor het oude marktplein. De meeste mensen die naar de vergadering
+		kwamen, zeiden dat ze graag meer bomen, bredere stoepen en minder auto's in het
+		centrum van de stad willen. Volgens de burgemeester moeten de werkzaamheden
+		volgend voorjaar beginnen en zullen ze ongeveer twee jaar duren. Sommige
+		winkeliers zijn bang dat hun zaak eronder lijdt terwijl de straat dicht is, maar
+		anderen denken dat een rustiger en groener plein op de lange termijn meer
+		bezoekers zal trekken. Als u vragen heeft over het project, kunt u het volledige
+		verslag op onze website lezen of ons een brief schrijven. We hebben ook een korte
+		handleiding gepubliceerd waarin staat hoe de veranderingen het parkeren, de
+		leveringen en het openbaar vervoer zullen raken. Bedankt voor uw interesse en
+		voor de tijd die u heeft genomen om uw mening met ons te delen.`,
+
+	"sv": `Kommunfullmäktige träffades på tisdagskvällen för att diskutera den nya
+		planen för det gamla torget. De flesta som kom till mötet sa att de vill ha fler
+		träd, bredare trottoarer och färre bilar i stadens centrum. Enligt borgmästaren
+		ska arbetet börja nästa vår och det kommer att ta ungefär två år. Några
+		butiksägare är oroliga för att deras affärer ska påverkas medan gatan är
+		avstängd, men andra tror att ett lugnare och grönare torg kommer att locka fler
+		besökare på lång sikt. Om du har frågor om projektet kan du läsa hela rapporten
+		på vår webbplats eller skriva till kontoret. Vi har också gett ut en kort guide
+		som förklarar hur förändringarna påverkar parkering, leveranser och
+		kollektivtrafik. Tack för ditt intresse och för att du tog dig tid att dela
+		dina tankar med oss. Det här är vad vi hörde och vad vi ska göra härnäst.`,
+
+	"pl": `Rada miasta spotkała się we wtorek wieczorem, aby omówić nowy plan dla starego
+		rynku. Większość osób, które przyszły na spotkanie, powiedziała, że chciałaby
+		więcej drzew, szerszych chodników i mniej samochodów w centrum miasta. Według
+		burmistrza prace powinny się zacząć następnej wiosny i potrwają około dwóch lat.
+		Niektórzy właściciele sklepów obawiają się, że ich interesy ucierpią, kiedy ulica
+		będzie zamknięta, ale inni uważają, że spokojniejszy i bardziej zielony plac
+		przyciągnie w dłuższym czasie więcej gości. Jeśli macie pytania dotyczące
+		projektu, możecie przeczytać cały raport na naszej stronie albo napisać do
+		urzędu. Opublikowaliśmy także krótki przewodnik, który wyjaśnia, jak zmiany
+		wpłyną na parkowanie, dostawy i komunikację miejską. Dziękujemy za
+		zainteresowanie i za czas poświęcony na podzielenie się z nami swoją opinią.`,
+
+	"tr": `Belediye meclisi salı akşamı eski pazar meydanı için hazırlanan yeni planı
+		görüşmek üzere toplandı. Toplantıya gelen insanların çoğu şehir merkezinde daha
+		fazla ağaç, daha geniş kaldırımlar ve daha az araba istediklerini söyledi.
+		Belediye başkanına göre çalışmalar önümüzdeki ilkbaharda başlayacak ve yaklaşık
+		iki yıl sürecek. Bazı dükkân sahipleri sokak kapalıyken işlerinin zarar
+		göreceğinden endişe ediyor, ancak diğerleri daha sakin ve daha yeşil bir meydanın
+		uzun vadede daha çok ziyaretçi çekeceğine inanıyor. Proje hakkında sorularınız
+		varsa, raporun tamamını internet sitemizde okuyabilir ya da bize yazabilirsiniz.
+		Ayrıca değişikliklerin otopark, teslimat ve toplu taşıma üzerindeki etkilerini
+		anlatan kısa bir rehber yayımladık. İlginiz için ve düşüncelerinizi bizimle
+		paylaşmak için zaman ayırdığınız için teşekkür ederiz.`,
+
+	"id": `Dewan kota mengadakan rapat pada hari Selasa malam untuk membahas rencana baru
+		bagi alun-alun pasar yang lama. Sebagian besar warga yang datang ke rapat itu
+		mengatakan bahwa mereka ingin lebih banyak pohon, trotoar yang lebih lebar dan
+		lebih sedikit mobil di pusat kota. Menurut wali kota, pekerjaan ini akan dimulai
+		pada musim semi tahun depan dan akan memakan waktu sekitar dua tahun. Beberapa
+		pemilik toko khawatir usaha mereka akan terganggu selama jalan ditutup, tetapi
+		yang lain percaya bahwa alun-alun yang lebih tenang dan lebih hijau akan menarik
+		lebih banyak pengunjung dalam jangka panjang. Jika Anda memiliki pertanyaan
+		tentang proyek ini, Anda dapat membaca laporan lengkapnya di situs kami atau
+		menulis surat kepada kantor kami. Kami juga telah menerbitkan panduan singkat
+		yang menjelaskan bagaimana perubahan ini akan mempengaruhi parkir, pengiriman
+		barang dan angkutan umum. Terima kasih atas perhatian dan waktu Anda.`,
+
+	"ru": `Городской совет собрался во вторник вечером, чтобы обсудить новый план для
+		старой рыночной площади. Большинство людей, которые пришли на встречу, сказали,
+		что хотели бы больше деревьев, более широкие тротуары и меньше машин в центре
+		города. По словам мэра, работы должны начаться следующей весной и продлятся
+		около двух лет. Некоторые владельцы магазинов опасаются, что их бизнес
+		пострадает, пока улица будет закрыта, но другие считают, что более тихая и
+		зелёная площадь со временем привлечёт больше посетителей. Если у вас есть
+		вопросы о проекте, вы можете прочитать полный отчёт на нашем сайте или написать
+		нам. Мы также опубликовали короткое руководство, которое объясняет, как эти
+		изменения отразятся на парковке, доставке и общественном транспорте. Спасибо за
+		ваш интерес и за то, что вы нашли время поделиться с нами своим мнением.`,
+
+	"uk": `Міська рада зібралася у вівторок увечері, щоб обговорити новий план для старої
+		ринкової площі. Більшість людей, які прийшли на зустріч, сказали, що хотіли б
+		більше дерев, ширші тротуари і менше машин у центрі міста. За словами мера,
+		роботи мають розпочатися наступної весни і триватимуть близько двох років.
+		Деякі власники крамниць побоюються, що їхній бізнес постраждає, поки вулиця буде
+		закрита, але інші вважають, що тихіша і зеленіша площа з часом приверне більше
+		відвідувачів. Якщо у вас є запитання щодо проєкту, ви можете прочитати повний
+		звіт на нашому сайті або написати нам. Ми також опублікували короткий посібник,
+		який пояснює, як ці зміни вплинуть на паркування, доставку і громадський
+		транспорт. Дякуємо за ваш інтерес і за те, що ви знайшли час поділитися з нами
+		своєю думкою. Це те, що ми почули, і те, що ми зробимо далі.`,
+}
@@ -0,0 +1,237 @@
+package lang
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	maxDetectRunes = 4000 // runes of a text classified, the start is enough
+	minLetters     = 30   // fewer letters are not classified
+
+	// evidenceCap bounds the trigrams a guess's confidence is based on, so
+	// that long texts do not make every guess certain.
+	evidenceCap = 20
+
+	// minCoverage is the share of a text's trigrams found in the profile of
+	// its language below which the guess loses confidence.
+	minCoverage = 0.35
+
+	smoothing = 0.5   // added to trigram counts
+	vocabSize = 20000 // assumed trigram vocabulary of a language
+)
+
+// scriptLangs are the languages told apart by their script alone. Han and
+// kana are handled on their own: kana means Japanese.
+var scriptLangs = []struct {
+	script *unicode.RangeTable
+	lang   string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Greek, "el"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Armenian, "hy"},
+	{unicode.Georgian, "ka"},
+}
+
+// profile holds the trigram log-probabilities of a language.
+type profile struct {
+	lang   string
+	logp   map[string]float64
+	unseen float64 // log-probability of a trigram missing from the sample
+}
+
+// profiles by script, built from samples.
+var profiles = map[*unicode.RangeTable][]profile{}
+
+func init() {
+	for lang, text := range samples {
+		counts := map[string]int{}
+		total := 0
+		trigrams(text, func(g string) {
+			counts[g]++
+			total++
+		})
+
+		denom := float64(total) + smoothing*vocabSize
+		p := profile{
+			lang:   lang,
+			logp:   make(map[string]float64, len(counts)),
+			unseen: math.Log(smoothing / denom),
+		}
+		for g, n := range counts {
+			p.logp[g] = math.Log((float64(n) + smoothing) / denom)
+		}
+		script := dominantScript(text)
+		profiles[script] = append(profiles[script], p)
+	}
+}
+
+// Detect guesses the language of text, returning its ISO 639-1 code and
+// a confidence between 0 and 1. It returns "" for texts too short or in a
+// script it does not know.
+//
+// Scripts used by one language decide on their own. Latin and Cyrillic
+// texts are scored against character trigram profiles with a naive Bayes
+// classifier.
+func Detect(text string) (string, float64) {
+	if runes := []rune(text); len(runes) > maxDetectRunes {
+		text = string(runes[:maxDetectRunes])
+	}
+
+	counts := map[*unicode.RangeTable]int{}
+	letters, kana := 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.In(r, unicode.Hiragana, unicode.Katakana) {
+			kana++
+			counts[unicode.Han]++ // Japanese mixes kana and Han
+			continue
+		}
+		if s := scriptOf(r); s != nil {
+			counts[s]++
+		}
+	}
+	if letters < minLetters {
+		return "", 0
+	}
+
+	var script *unicode.RangeTable
+	for s, n := range counts {
+		if script == nil || n > counts[script] {
+			script = s
+		}
+	}
+	if script == nil {
+		return "", 0
+	}
+	share := float64(counts[script]) / float64(letters)
+
+	switch script {
+	case unicode.Han:
+		if kana*10 >= counts[unicode.Han] {
+			return "ja", share
+		}
+		return "zh", share
+	case unicode.Latin, unicode.Cyrillic:
+		lang, conf := classify(text, profiles[script])
+		return lang, conf * share
+	}
+	for _, sl := range scriptLangs {
+		if sl.script == script {
+			return sl.lang, share
+		}
+	}
+	return "", 0
+}
+
+// classify returns the profile most likely to have produced text, and the
+// posterior probability of that guess with the evidence capped at
+// evidenceCap trigrams.
+func classify(text string, candidates []profile) (string, float64) {
+	if len(candidates) == 0 {
+		return "", 0
+	}
+
+	scores := make([]float64, len(candidates))
+	seen := make([]int, len(candidates))
+	n := 0
+	trigrams(text, func(g string) {
+		n++
+		for i, p := range candidates {
+			lp, ok := p.logp[g]
+			if !ok {
+				lp = p.unseen
+			} else {
+				seen[i]++
+			}
+			scores[i] += lp
+		}
+	})
+	if n == 0 {
+		return "", 0
+	}
+
+	best := 0
+	for i := range scores {
+		scores[i] = scores[i] / float64(n) * float64(min(n, evidenceCap))
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+	var sum float64
+	for _, s := range scores {
+		sum += math.Exp(s - scores[best])
+	}
+	// a text in a language without a profile shares few trigrams with
+	// any of them
+	coverage := float64(seen[best]) / float64(n)
+	return candidates[best].lang, min(1, coverage/minCoverage) / sum
+}
+
+// trigrams calls fn with the character trigrams of the words of text,
+// lowercased and padded with a space on both ends.
+func trigrams(text string, fn func(string)) {
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		runes := []rune(" " + w + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			fn(string(runes[i : i+3]))
+		}
+	}
+}
+
+// Supported reports whether Detect can return lang.
+func Supported(lang string) bool {
+	switch lang {
+	case "ja", "zh":
+		return true
+	}
+	for _, sl := range scriptLangs {
+		if sl.lang == lang {
+			return true
+		}
+	}
+	for _, ps := range profiles {
+		for _, p := range ps {
+			if p.lang == lang {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func scriptOf(r rune) *unicode.RangeTable {
+	for _, s := range []*unicode.RangeTable{unicode.Latin, unicode.Cyrillic, unicode.Han} {
+		if unicode.Is(s, r) {
+			return s
+		}
+	}
+	for _, sl := range scriptLangs {
+		if unicode.Is(sl.script, r) {
+			return sl.script
+		}
+	}
+	return nil
+}
+
+func dominantScript(text string) *unicode.RangeTable {
+	counts := map[*unicode.RangeTable]int{}
+	var best *unicode.RangeTable
+	for _, r := range text {
+		if s := scriptOf(r); s != nil {
+			counts[s]++
+			if best == nil || counts[s] > counts[best] {
+				best = s
+			}
+		}
+	}
+	return best
+}
@@ -0,0 +1,136 @@
+// Package lang identifies the language of pages from what they declare,
+// <html lang>, Content-Language, hreflang and og:locale, checked against a
+// classifier over their text. Languages are BCP-47 tags.
+package lang
+
+import (
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// MinConfidence is the confidence from which a detected language overrides
+// a declared one. Sites often declare the same language on every page,
+// whatever the content.
+const MinConfidence = 0.8
+
+// Signals are the hints of a page's language.
+type Signals struct {
+	HTML     string // lang of <html>
+	Hreflang string // hreflang of the alternate pointing at the page itself
+	Header   string // Content-Language response header
+	Locale   string // og:locale, e.g. en_US
+	Text     string // visible text
+}
+
+// Identify returns the normalized language tag of a page, or "" when it
+// cannot tell. The declared language is kept when the text agrees with it,
+// so its region or script survives; a confident detection replaces it
+// otherwise.
+func Identify(s Signals) string {
+	declared := ""
+	for _, tag := range []string{s.HTML, s.Hreflang, single(s.Header), s.Locale} {
+		if declared = Normalize(tag); declared != "" {
+			break
+		}
+	}
+
+	detected, conf := Detect(s.Text)
+	switch {
+	case declared == "":
+		if conf >= MinConfidence {
+			return detected
+		}
+		return ""
+	case conf < MinConfidence || !Supported(Base(declared)):
+		return declared
+	case Base(declared) == detected:
+		return declared
+	default:
+		return detected
+	}
+}
+
+// Normalize returns the canonical form of a BCP-47 tag: "en_us" becomes
+// "en-US", deprecated codes such as "iw" are replaced. Invalid tags,
+// "und" and hreflang's "x-default" yield "".
+func Normalize(tag string) string {
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	if tag == "" || strings.EqualFold(tag, "x-default") {
+		return ""
+	}
+	t, err := language.Parse(tag)
+	if err != nil || t == language.Und {
+		return ""
+	}
+	return t.String()
+}
+
+// Base returns the language subtag of a normalized tag: "en" for "en-US".
+func Base(tag string) string {
+	base, _, _ := strings.Cut(tag, "-")
+	return base
+}
+
+// Match reports whether tag is one of allowed. An allowed language matches
+// its regional variants: "en" matches "en-GB", "en-GB" only matches itself.
+// Everything matches an empty list, and an unknown language matches any
+// list, as it cannot be ruled out.
+func Match(tag string, allowed []string) bool {
+	if len(allowed) == 0 || tag == "" {
+		return true
+	}
+	for _, a := range allowed {
+		if tag == a || strings.HasPrefix(tag, a+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// single returns a Content-Language header naming one language, or "" for
+// pages declared to be in several.
+func single(header string) string {
+	if strings.Contains(header, ",") {
+		return ""
+	}
+	return header
+}
+
+// subdomainSites are the sites with one subdomain per language, as in
+// fr.wikipedia.org.
+var subdomainSites = []string{
+	"wikipedia.org",
+	"wikibooks.org",
+	"wikivoyage.org",
+	"wiktionary.org",
+	"wikiquote.org",
+	"wikisource.org",
+	"wikinews.org",
+}
+
+// sharedSubdomains are the subdomains of those sites that are not in one
+// language. Some, such as www, are also ISO 639-3 codes.
+var sharedSubdomains = map[string]bool{
+	"www":       true,
+	"m":         true,
+	"api":       true,
+	"commons":   true,
+	"meta":      true,
+	"species":   true,
+	"incubator": true,
+}
+
+// FromHost returns the language of a host of a site with one subdomain per
+// language, such as "fr" for fr.wikipedia.org, or "".
+func FromHost(host string) string {
+	host = strings.ToLower(host)
+	for _, site := range subdomainSites {
+		sub, ok := strings.CutSuffix(host, "."+site)
+		if !ok || strings.Contains(sub, ".") || sharedSubdomains[sub] {
+			continue
+		}
+		return Normalize(sub)
+	}
+	return ""
+}
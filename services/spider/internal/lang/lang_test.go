@@ -0,0 +1,210 @@
+package lang
+
+import "testing"
+
+// texts are in the languages of the corpus, on another subject than its
+// samples, so that the profiles generalize.
+var texts = map[string]string{
+	"en": `The library will be closed for two weeks while the old heating system is
+		replaced. During this time, books can still be returned at the post office
+		next door, and the reading room in the school will stay open in the evening.`,
+	"fr": `La bibliothèque sera fermée pendant deux semaines pendant que l'ancien
+		système de chauffage est remplacé. Pendant ce temps, les livres peuvent
+		toujours être rendus au bureau de poste d'à côté, et la salle de lecture de
+		l'école restera ouverte le soir.`,
+	"de": `Die Bibliothek bleibt zwei Wochen lang geschlossen, während die alte
+		Heizung ausgetauscht wird. In dieser Zeit können Bücher weiterhin bei der
+		Post nebenan zurückgegeben werden, und der Lesesaal in der Schule bleibt am
+		Abend geöffnet.`,
+	"es": `La biblioteca estará cerrada durante dos semanas mientras se cambia el
+		antiguo sistema de calefacción. Durante este tiempo, los libros se pueden
+		devolver en la oficina de correos de al lado, y la sala de lectura de la
+		escuela seguirá abierta por la tarde.`,
+	"it": `La biblioteca resterà chiusa per due settimane mentre viene sostituito il
+		vecchio impianto di riscaldamento. In questo periodo i libri si possono
+		ancora restituire all'ufficio postale qui accanto, e la sala di lettura
+		della scuola rimarrà aperta la sera.`,
+	"pt": `A biblioteca vai estar fechada durante duas semanas enquanto o antigo
+		sistema de aquecimento é substituído. Durante este tempo, os livros ainda
+		podem ser devolvidos nos correios ao lado, e a sala de leitura da escola vai
+		continuar aberta à noite.`,
+	"nl": `De bibliotheek is twee weken gesloten terwijl de oude verwarming wordt
+		vervangen. In die tijd kunnen boeken nog steeds worden ingeleverd bij het
+		postkantoor hiernaast, en de leeszaal in de school blijft 's avonds open.`,
+	"sv": `Biblioteket kommer att vara stängt i två veckor medan det gamla
+		värmesystemet byts ut. Under tiden kan böcker fortfarande lämnas tillbaka på
+		posten bredvid, och läsesalen i skolan är öppen på kvällarna.`,
+	"pl": `Biblioteka będzie zamknięta przez dwa tygodnie, podczas gdy stary system
+		ogrzewania zostanie wymieniony. W tym czasie książki można nadal zwracać na
+		poczcie obok, a czytelnia w szkole będzie otwarta wieczorem.`,
+	"tr": `Eski ısıtma sistemi değiştirilirken kütüphane iki hafta boyunca kapalı
+		olacak. Bu süre içinde kitaplar yandaki postaneye iade edilebilir ve okuldaki
+		okuma salonu akşamları açık kalacak.`,
+	"id": `Perpustakaan akan ditutup selama dua minggu sementara sistem pemanas yang
+		lama diganti. Selama waktu ini, buku masih dapat dikembalikan di kantor pos
+		sebelah, dan ruang baca di sekolah tetap dibuka pada malam hari.`,
+	"ru": `Библиотека будет закрыта на две недели, пока заменяют старую систему
+		отопления. В это время книги можно по-прежнему вернуть на почте по соседству,
+		а читальный зал в школе будет открыт по вечерам.`,
+	"uk": `Бібліотека буде зачинена на два тижні, поки замінюють стару систему
+		опалення. У цей час книжки можна і далі повернути на пошті поруч, а читальна
+		зала в школі буде відчинена ввечері.`,
+}
+
+func TestDetect(t *testing.T) {
+	for lang := range samples {
+		if texts[lang] == "" {
+			t.Errorf("no text in %q", lang)
+		}
+	}
+
+	for want, text := range texts {
+		t.Run(want, func(t *testing.T) {
+			got, conf := Detect(text)
+			if got != want {
+				t.Errorf("Detect = %q (%.2f), want %q", got, conf, want)
+			}
+			if conf < MinConfidence {
+				t.Errorf("confidence = %.2f, want at least %.2f", conf, MinConfidence)
+			}
+		})
+	}
+}
+
+func TestDetectUnknown(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"empty", "", ""},
+		{"too short", "Hello there", ""},
+		{"digits and symbols", "12 345 678 90 — 12:30, 14:45; 2024-01-01 % $ € 123 456 789 012", ""},
+		{"script of one language", "Η βιβλιοθήκη θα είναι κλειστή για δύο εβδομάδες όσο αλλάζει η θέρμανση.", "el"},
+		{"kana", "図書館は暖房の交換のため二週間閉館します。その間、本は隣の郵便局で返却できます。", "ja"},
+		{"han", "图书馆将关闭两周，以更换旧的供暖系统。在此期间，书籍仍可在隔壁的邮局归还。", "zh"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := Detect(tt.text); got != tt.want {
+				t.Errorf("Detect = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	tests := []struct {
+		name string
+		s    Signals
+		want string
+	}{
+		{"declared and agreeing text", Signals{HTML: "en-GB", Text: texts["en"]}, "en-GB"},
+		{"declared and other text", Signals{HTML: "en", Text: texts["fr"]}, "fr"},
+		{"declared and no text", Signals{HTML: "de-AT"}, "de-AT"},
+		{"declared unsupported language", Signals{HTML: "ca", Text: texts["es"]}, "ca"},
+		{"detected only", Signals{Text: texts["nl"]}, "nl"},
+		{"nothing", Signals{Text: "Hello there"}, ""},
+
+		{"html before hreflang", Signals{HTML: "fr", Hreflang: "de", Header: "es", Locale: "it_IT"}, "fr"},
+		{"hreflang before header", Signals{Hreflang: "de", Header: "es", Locale: "it_IT"}, "de"},
+		{"header before locale", Signals{Header: "es", Locale: "it_IT"}, "es"},
+		{"locale", Signals{Locale: "it_IT"}, "it-IT"},
+		{"several languages in header", Signals{Header: "en, fr", Locale: "pt_BR"}, "pt-BR"},
+		{"invalid html lang", Signals{HTML: "x-default", Header: "sv"}, "sv"},
+		{"detected over declared region", Signals{Locale: "pt_BR", Text: texts["es"]}, "es"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Identify(tt.s); got != tt.want {
+				t.Errorf("Identify = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"en", "en"},
+		{"EN", "en"},
+		{"en_us", "en-US"},
+		{" pt-br ", "pt-BR"},
+		{"zh-hans-cn", "zh-Hans-CN"},
+		{"iw", "he"},
+		{"in", "id"},
+		{"", ""},
+		{"und", ""},
+		{"x-default", ""},
+		{"X-Default", ""},
+		{"commons", ""},
+		{"not a tag", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := Normalize(tt.tag); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"fr.wikipedia.org", "fr"},
+		{"FR.Wikipedia.org", "fr"},
+		{"pt-br.wikibooks.org", "pt-BR"},
+		{"be-tarask.wikipedia.org", "be-tarask"},
+		{"de.wiktionary.org", "de"},
+		{"commons.wikipedia.org", ""},
+		{"meta.wikipedia.org", ""},
+		{"species.wikipedia.org", ""},
+		{"www.wikipedia.org", ""},
+		{"api.wikipedia.org", ""},
+		{"en.m.wikipedia.org", ""},
+		{"wikipedia.org", ""},
+		{"fr.example.org", ""},
+		{"fr.notwikipedia.org", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := FromHost(tt.host); got != tt.want {
+				t.Errorf("FromHost(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		allowed []string
+		want    bool
+	}{
+		{"no list", "fr", nil, true},
+		{"unknown language", "", []string{"en"}, true},
+		{"exact", "en", []string{"fr", "en"}, true},
+		{"regional variant", "en-GB", []string{"en"}, true},
+		{"other region", "en-US", []string{"en-GB"}, false},
+		{"prefix of another language", "enm", []string{"en"}, false},
+		{"other language", "de", []string{"en", "fr"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Match(tt.tag, tt.allowed); got != tt.want {
+				t.Errorf("Match(%q, %q) = %v, want %v", tt.tag, tt.allowed, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
+)
+
+const namespace = "spider"
+
+var (
+	PagesFetched = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pages_fetched_total",
+		Help:      "Pages fetched and parsed successfully.",
+	})
+
+	BytesDownloaded = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_downloaded_total",
+		Help:      "Response body bytes downloaded.",
+	})
+
+	FetchLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "fetch_duration_seconds",
+		Help:      "Fetch latency, including retries, by HTTP status class.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"status_class"})
+
+	ParseErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "parse_errors_total",
+		Help:      "Fetched responses that failed to parse.",
+	})
+
+	PersistErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "persist_errors_total",
+		Help:      "Pages that failed to persist.",
+	})
+
+	PagesDeduplicated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pages_deduplicated_total",
+		Help:      "Pages not stored again, by reason: unchanged on recrawl or duplicate of another URL.",
+	}, []string{"reason"})
+
+	PagesSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pages_skipped_total",
+		Help:      "Fetched pages left out of the index, by reason.",
+	}, []string{"reason"})
+
+	EventsPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_published_total",
+		Help:      "Events relayed from the outbox to the event stream, by type.",
+	}, []string{"type"})
+
+	FeedPolls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "feed_polls_total",
+		Help:      "Feed polls, by result: new_items, no_change or error.",
+	}, []string{"result"})
+
+	FeedItems = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "feed_items_total",
+		Help:      "New feed items queued in the frontier.",
+	})
+
+	TrapURLs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "trap_urls_total",
+		Help:      "Links flagged as crawler traps, by reason and action.",
+	}, []string{"reason", "action"})
+
+	PolitenessWait = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "politeness_wait_seconds_total",
+		Help:      "Crawl delay left on hosts whose fetches were deferred.",
+	})
+
+	PolitenessDeferrals = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "politeness_deferrals_total",
+		Help:      "Fetches deferred because their host's crawl delay had not expired, by kind (page, feed).",
+	}, []string{"kind"})
+)
+
+// StatusClass maps an HTTP status code to its class label ("2xx", "4xx", ...).
+// A zero code means no response was received.
+func StatusClass(code int) string {
+	if code <= 0 {
+		return "error"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// RegisterGauge exposes a value computed at scrape time, such as the
+// frontier size or the fetch pool occupancy.
+func RegisterGauge(name, help string, fn func() float64) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, fn))
+}
+
+type Server struct {
+	srv *http.Server
+	log *slog.Logger
+}
+
+// NewServer returns an HTTP server exposing the default registry on /metrics.
+func NewServer(addr string, logger *utils.Logger) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	return &Server{
+		srv: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+		log: logger.With("component", "metrics"),
+	}
+}
+
+func (s *Server) Start() {
+	s.log.Info("Starting metrics server", "addr", s.srv.Addr)
+	go func() {
+		if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Error("metrics server stopped", "error", err)
+		}
+	}()
+}
+
+func (s *Server) Shutdown(ctx context.Context) {
+	if err := s.srv.Shutdown(ctx); err != nil {
+		s.log.Warn("shutdown metrics server", "error", err)
+	}
+}
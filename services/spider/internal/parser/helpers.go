@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"slices"
 	"strings"
 
 	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
@@ -37,13 +38,6 @@ func extrantMeta(n *html.Node) entity.MetaData {
 	return m
 }
 
-func traverse(n *html.Node, visit func(*html.Node)) {
-	visit(n)
-	for child := n.FirstChild; child != nil; child = child.NextSibling {
-		traverse(child, visit)
-	}
-}
-
 func getAttr(n *html.Node, key string) string {
 	for _, a := range n.Attr {
 		if a.Key == key {
@@ -62,6 +56,97 @@ func isIconLink(n *html.Node) bool {
 	return false
 }
 
+// feedTypes are the <link type> values of RSS, Atom and JSON feeds.
+var feedTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+	"application/json":      true,
+}
+
+// isFeedLink reports whether n is a <link rel="alternate"> to a feed.
+func isFeedLink(n *html.Node) bool {
+	rels := strings.Fields(strings.ToLower(getAttr(n, "rel")))
+	typ := strings.ToLower(strings.TrimSpace(getAttr(n, "type")))
+	return slices.Contains(rels, "alternate") && feedTypes[typ]
+}
+
+// isHreflangLink reports whether n is a <link rel="alternate" hreflang> to
+// a translation of the page.
+func isHreflangLink(n *html.Node) bool {
+	rels := strings.Fields(strings.ToLower(getAttr(n, "rel")))
+	return slices.Contains(rels, "alternate") && getAttr(n, "hreflang") != ""
+}
+
+// followedRels are the <link rel> values whose target is crawled.
+var followedRels = []string{"next", "prev", "previous", "alternate", "amphtml"}
+
+// isFollowedRelLink reports whether n is a <link> to a page to crawl, such
+// as the next page of a series or a translation. Stylesheets and icons
+// declared as alternates are not.
+func isFollowedRelLink(n *html.Node) bool {
+	rels := strings.Fields(strings.ToLower(getAttr(n, "rel")))
+	if slices.Contains(rels, "stylesheet") || slices.Contains(rels, "icon") {
+		return false
+	}
+	return slices.ContainsFunc(rels, func(r string) bool { return slices.Contains(followedRels, r) })
+}
+
+// refreshTarget returns the URL of a <meta http-equiv="refresh"
+// content="5; url=/next"> redirect.
+func refreshTarget(n *html.Node) (string, bool) {
+	if !strings.EqualFold(getAttr(n, "http-equiv"), "refresh") {
+		return "", false
+	}
+
+	content := getAttr(n, "content")
+	i := strings.IndexAny(content, ";,")
+	if i < 0 {
+		return "", false // a plain reload
+	}
+	rest := strings.TrimSpace(content[i+1:])
+	if k, v, ok := strings.Cut(rest, "="); ok && strings.EqualFold(strings.TrimSpace(k), "url") {
+		rest = strings.TrimSpace(v)
+	}
+	rest = strings.Trim(rest, `"'`)
+	return rest, rest != ""
+}
+
+// parseSrcset returns the URLs of a srcset attribute, a comma-separated
+// list of "url [descriptor]" candidates. URLs may contain commas, as in
+// data: URLs, so a candidate's URL runs until the next whitespace.
+func parseSrcset(srcset string) []string {
+	var urls []string
+	s := srcset
+	for {
+		s = strings.TrimLeft(s, " \t\n\r\f,")
+		if s == "" {
+			return urls
+		}
+
+		end := strings.IndexAny(s, " \t\n\r\f")
+		if end < 0 {
+			end = len(s)
+		}
+		u := s[:end]
+		s = s[end:]
+
+		if strings.HasSuffix(u, ",") {
+			// no descriptor, the comma ends the candidate
+			urls = append(urls, strings.TrimRight(u, ","))
+			continue
+		}
+		urls = append(urls, u)
+
+		// skip the descriptor, up to the comma ending the candidate
+		if i := strings.IndexByte(s, ','); i >= 0 {
+			s = s[i+1:]
+		} else {
+			s = ""
+		}
+	}
+}
+
 func getMetaProperty(n *html.Node) string {
 	for _, a := range n.Attr {
 		if a.Key == "property" {
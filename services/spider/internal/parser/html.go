@@ -7,20 +7,35 @@ import (
 	"golang.org/x/net/html"
 
 	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+	"github.com/Hassan-ach/boogle/services/spider/internal/lang"
 	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
 )
 
 type htmlCollector struct {
-	Links      []string
-	Imags      []string
+	Links      []entity.Link     // links and images, in document order
+	Anchors    map[string]string // anchor text by normalized link
+	Feeds      []string
+	Embeds     []string // scripts and frames loaded by the page
 	TextBuffer strings.Builder
 	Meta       entity.MetaData
-	BaseURL    *url.URL
+	HTMLLang   string
+	BaseURL    *url.URL // effective base: the document URL, or its <base href>
+
+	hasBaseTag bool
+
+	stack    []string         // names of the open elements
+	captures []capture        // text collected for open elements
+	items    []microdataItem  // open microdata items
+	jsonLD   *strings.Builder // text of the open JSON-LD <script>, nil otherwise
+	skipped  []string         // names of the open elements beyond the depth limit
+	tooDeep  bool             // some elements were beyond the depth limit
+	nodes    int              // elements and text nodes parsed
 }
 
 func newHtmlCollector(baseURL *url.URL) *htmlCollector {
 	return &htmlCollector{
 		BaseURL: baseURL,
+		Anchors: map[string]string{},
 	}
 }
 
@@ -37,30 +52,60 @@ func (c *htmlCollector) conllectText(text string) {
 	c.TextBuffer.WriteString(s)
 }
 
-func (c *htmlCollector) Visit(n *html.Node) {
-	if n.Type != html.ElementNode {
-		if n.Type == html.TextNode {
-			c.conllectText(n.Data)
-		}
-		return
-	}
+// visit handles an element once it is open. Its attributes are all that
+// is known of it: content is collected through captures.
+func (c *htmlCollector) visit(n *html.Node) {
+	c.visitMicrodata(n)
 
 	switch n.Data {
-	case "script", "style":
-		return
+	case "script":
+		if isJSONLD(n) {
+			c.jsonLD = &strings.Builder{}
+		}
+		c.maybeAddEmbed(getAttr(n, "src"))
+	case "html":
+		c.HTMLLang = getAttr(n, "lang")
+		if c.HTMLLang == "" {
+			c.HTMLLang = getAttr(n, "xml:lang")
+		}
+	case "base":
+		c.setBase(getAttr(n, "href"))
 	case "meta":
 		c.mergeMeta(extrantMeta(n))
+		c.addCardTag(n)
+		if target, ok := refreshTarget(n); ok {
+			c.maybeAddLink(target, entity.LinkRefresh, "")
+		}
 	case "link":
 		if isIconLink(n) {
 			c.Meta.Icons = append(c.Meta.Icons, getAttr(n, "href"))
 		}
+		switch {
+		case isFeedLink(n):
+			c.maybeAddFeed(getAttr(n, "href"))
+		case isHreflangLink(n):
+			c.maybeAddAlternate(getAttr(n, "href"), getAttr(n, "hreflang"))
+		case isFollowedRelLink(n):
+			c.maybeAddLink(getAttr(n, "href"), entity.LinkRel, "")
+		}
 	case "a":
-		c.maybeAddLink(getAttr(n, "href"))
+		href := getAttr(n, "href")
+		c.capture(func(text string) {
+			c.maybeAddLink(href, entity.LinkAnchor, text)
+		})
+	case "area":
+		c.maybeAddLink(getAttr(n, "href"), entity.LinkArea, getAttr(n, "alt"))
+	case "iframe", "frame":
+		c.maybeAddLink(getAttr(n, "src"), entity.LinkFrame, "")
+		c.maybeAddEmbed(getAttr(n, "src"))
 	case "img":
-		c.maybeAddImage(getAttr(n, "src"))
-	case "title":
-		if n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
-			c.Meta.Title = strings.TrimSpace(n.FirstChild.Data)
+		c.maybeAddImage(getAttr(n, "src"), entity.LinkImage)
+		c.maybeAddSrcset(getAttr(n, "srcset"))
+		// the alt text of an image link is its anchor text
+		c.addCaptured(getAttr(n, "alt"))
+	case "source":
+		if c.parent(1) == "picture" {
+			c.maybeAddSrcset(getAttr(n, "srcset"))
 		}
 	}
 }
@@ -89,21 +134,113 @@ func (c *htmlCollector) mergeMeta(other entity.MetaData) entity.MetaData {
 	return c.Meta
 }
 
-func (c *htmlCollector) maybeAddLink(rawURL string) {
-	if _, err := url.Parse(rawURL); err == nil {
-		u, ok := utils.NormalizeUrl(rawURL, "")
-		if !ok {
-			return
-		}
-		c.Links = append(c.Links, u)
+// setBase applies the first <base href> of the document, resolved against
+// the document URL. Later <base> elements are ignored, as in browsers.
+func (c *htmlCollector) setBase(href string) {
+	if c.hasBaseTag {
+		return
+	}
+	c.hasBaseTag = true
+
+	if u, ok := c.resolve(href); ok {
+		c.BaseURL = u
+	}
+}
+
+// resolve turns a reference found in the document into an absolute URL
+// following RFC 3986 section 5, including protocol-relative "//host/path"
+// and dot-segment references. Schemes other than http and https
+// (mailto:, javascript:, tel:, data:, ...) are rejected.
+func (c *htmlCollector) resolve(ref string) (*url.URL, bool) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return nil, false
+	}
+
+	r, err := url.Parse(ref)
+	if err != nil || !utils.IsSupportedScheme(r.Scheme) {
+		return nil, false
+	}
+
+	if c.BaseURL != nil {
+		r = c.BaseURL.ResolveReference(r)
+	}
+	if !r.IsAbs() || r.Host == "" {
+		return nil, false
+	}
+	return r, true
+}
+
+func (c *htmlCollector) maybeAddLink(rawURL string, source entity.LinkSource, anchor string) {
+	r, ok := c.resolve(rawURL)
+	if !ok {
+		return
+	}
+
+	u, ok := utils.NormalizeUrl(r.String(), "")
+	if !ok {
+		return
+	}
+	c.Links = append(c.Links, entity.Link{URL: u, Source: source})
+	if anchor == "" {
+		return
+	}
+	if prev := c.Anchors[u]; prev != "" {
+		anchor = prev + " " + anchor
 	}
+	c.Anchors[u] = anchor
 }
 
-func (c *htmlCollector) maybeAddImage(src string) {
-	if src == "" {
+func (c *htmlCollector) maybeAddEmbed(src string) {
+	if r, ok := c.resolve(src); ok {
+		c.Embeds = append(c.Embeds, r.String())
+	}
+}
+
+// maybeAddImage keeps image URLs as resolved: canonicalization would drop
+// them for their file extension.
+func (c *htmlCollector) maybeAddImage(src string, source entity.LinkSource) {
+	r, ok := c.resolve(src)
+	if !ok {
 		return
 	}
-	if _, err := url.Parse(src); err == nil {
-		c.Imags = append(c.Imags, src)
+	c.Links = append(c.Links, entity.Link{URL: r.String(), Source: source})
+}
+
+func (c *htmlCollector) maybeAddSrcset(srcset string) {
+	for _, src := range parseSrcset(srcset) {
+		c.maybeAddImage(src, entity.LinkSrcset)
+	}
+}
+
+// maybeAddAlternate records a translation of the page and crawls it. The
+// x-default alternate, the language picker, gives no language hint.
+func (c *htmlCollector) maybeAddAlternate(href, hreflang string) {
+	r, ok := c.resolve(href)
+	if !ok {
+		return
+	}
+	u, ok := utils.NormalizeUrl(r.String(), "")
+	if !ok {
+		return
+	}
+
+	tag := lang.Normalize(hreflang)
+	switch {
+	case tag != "":
+		c.Meta.Alternates = append(c.Meta.Alternates, entity.Alternate{Lang: tag, URL: u})
+	case strings.EqualFold(strings.TrimSpace(hreflang), "x-default"):
+		c.Meta.Alternates = append(c.Meta.Alternates, entity.Alternate{Lang: "x-default", URL: u})
+	default:
+		return
+	}
+	c.Links = append(c.Links, entity.Link{URL: u, Source: entity.LinkHreflang, Lang: tag})
+}
+
+func (c *htmlCollector) maybeAddFeed(href string) {
+	r, ok := c.resolve(href)
+	if !ok {
+		return
 	}
+	c.Feeds = append(c.Feeds, r.String())
 }
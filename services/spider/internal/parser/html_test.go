@@ -0,0 +1,162 @@
+package parser
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	// RFC 3986 section 5.4, with the base of its examples
+	base, _ := url.Parse("http://a/b/c/d;p?q")
+
+	tests := []struct {
+		name string
+		ref  string
+		want string
+		ok   bool
+	}{
+		// normal examples
+		{"relative path", "g", "http://a/b/c/g", true},
+		{"dot relative path", "./g", "http://a/b/c/g", true},
+		{"relative directory", "g/", "http://a/b/c/g/", true},
+		{"absolute path", "/g", "http://a/g", true},
+		{"protocol relative", "//g", "http://g", true},
+		{"query only", "?y", "http://a/b/c/d;p?y", true},
+		{"path and query", "g?y", "http://a/b/c/g?y", true},
+		{"path and fragment", "g#s", "http://a/b/c/g#s", true},
+		{"params", ";x", "http://a/b/c/;x", true},
+		{"dot", ".", "http://a/b/c/", true},
+		{"dot slash", "./", "http://a/b/c/", true},
+		{"double dot", "..", "http://a/b/", true},
+		{"double dot slash", "../", "http://a/b/", true},
+		{"double dot path", "../g", "http://a/b/g", true},
+		{"two double dots", "../..", "http://a/", true},
+		{"two double dots path", "../../g", "http://a/g", true},
+
+		// abnormal examples
+		{"above root", "../../../g", "http://a/g", true},
+		{"far above root", "../../../../g", "http://a/g", true},
+		{"absolute dot segments", "/./g", "http://a/g", true},
+		{"absolute double dot", "/../g", "http://a/g", true},
+		{"trailing dot name", "g.", "http://a/b/c/g.", true},
+		{"leading dot name", ".g", "http://a/b/c/.g", true},
+		{"inner dot segments", "./g/.", "http://a/b/c/g/", true},
+		{"inner double dot", "g/../h", "http://a/b/c/h", true},
+
+		// absolute references
+		{"absolute http", "http://example.com/x", "http://example.com/x", true},
+		{"absolute https", "https://example.com/x", "https://example.com/x", true},
+		{"surrounding spaces", "  g  ", "http://a/b/c/g", true},
+
+		// rejected
+		{"empty", "", "", false},
+		{"fragment only", "#top", "", false},
+		{"mailto", "mailto:someone@example.com", "", false},
+		{"javascript", "javascript:void(0)", "", false},
+		{"tel", "tel:+123456", "", false},
+		{"data", "data:text/plain,hello", "", false},
+		{"ftp", "ftp://example.com/file", "", false},
+		{"http without host", "http:", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newHtmlCollector(base)
+			got, ok := c.resolve(tt.ref)
+			if ok != tt.ok {
+				t.Fatalf("resolve(%q) ok = %v, want %v", tt.ref, ok, tt.ok)
+			}
+			if ok && got.String() != tt.want {
+				t.Errorf("resolve(%q) = %q, want %q", tt.ref, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHTMLLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		pageURL string
+		body    string
+		want    []string
+	}{
+		{
+			name:    "relative to the page",
+			pageURL: "https://example.com/docs/guide/intro",
+			body:    `<a href="setup">a</a><a href="../api">b</a><a href="/about">c</a>`,
+			want: []string{
+				"https://example.com/docs/guide/setup",
+				"https://example.com/docs/api",
+				"https://example.com/about",
+			},
+		},
+		{
+			name:    "base href",
+			pageURL: "https://example.com/docs/guide/intro",
+			body:    `<head><base href="/v2/"></head><a href="setup">a</a><a href="/about">b</a>`,
+			want: []string{
+				"https://example.com/v2/setup",
+				"https://example.com/about",
+			},
+		},
+		{
+			name:    "absolute base href",
+			pageURL: "https://example.com/docs/",
+			body:    `<head><base href="https://cdn.example.org/mirror/"></head><a href="page">a</a>`,
+			want:    []string{"https://cdn.example.org/mirror/page"},
+		},
+		{
+			name:    "only the first base href",
+			pageURL: "https://example.com/",
+			body:    `<head><base href="/first/"><base href="/second/"></head><a href="page">a</a>`,
+			want:    []string{"https://example.com/first/page"},
+		},
+		{
+			name:    "base href with a rejected scheme",
+			pageURL: "https://example.com/docs/",
+			body:    `<head><base href="javascript:void(0)"></head><a href="page">a</a>`,
+			want:    []string{"https://example.com/docs/page"},
+		},
+		{
+			name:    "protocol relative keeps the page scheme",
+			pageURL: "http://example.com/",
+			body:    `<a href="//example.org/x">a</a>`,
+			want:    []string{"http://example.org/x"},
+		},
+		{
+			name:    "rejected schemes",
+			pageURL: "https://example.com/",
+			body: `<a href="mailto:a@example.com">a</a><a href="javascript:go()">b</a>` +
+				`<a href="tel:+1">c</a><a href="data:text/html,x">d</a><a href="ftp://example.com/f">e</a>` +
+				`<a href="#top">f</a><a href="/kept">g</a>`,
+			want: []string{"https://example.com/kept"},
+		},
+		{
+			name:    "resolved against the final URL",
+			pageURL: "https://example.org/moved/here/",
+			body:    `<a href="next">a</a>`,
+			want:    []string{"https://example.org/moved/here/next"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := benchParser().ParseHTML(strings.NewReader(tt.body), tt.pageURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.URL != tt.pageURL {
+				t.Errorf("page URL = %q, want %q", page.URL, tt.pageURL)
+			}
+			var got []string
+			for _, l := range page.Outlinks {
+				got = append(got, l.URL)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("links = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
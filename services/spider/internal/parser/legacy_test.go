@@ -0,0 +1,201 @@
+package parser
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
+)
+
+// legacyParseHTML is ParseHTML as it was before streaming, the baseline of
+// BenchmarkParseHTML: the whole document is parsed into a tree, then
+// walked, and anchor text, titles, JSON-LD and microdata are read from the
+// subtrees of their elements.
+func legacyParseHTML(r io.Reader, baseURL string) (*entity.Page, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	u, _ := url.Parse(baseURL)
+
+	c := legacyCollector{newHtmlCollector(u)}
+	legacyTraverse(doc, c.visit)
+
+	text := strings.TrimSpace(c.TextBuffer.String())
+	desc := text
+	if len(desc) > 300 {
+		desc = desc[:300]
+	}
+
+	if c.Meta.Description == "" {
+		c.Meta.Description = desc
+	}
+	c.Meta.CrawledAt = time.Now()
+
+	return &entity.Page{
+		MetaData: c.Meta,
+		HTMLLang: c.HTMLLang,
+		Outlinks: dedupeLinks(c.Links),
+		Feeds:    utils.NewSetFromSlice(c.Feeds).GetAll(),
+		Text:     text,
+		Anchors:  c.Anchors,
+	}, nil
+}
+
+type legacyCollector struct {
+	*htmlCollector
+}
+
+func (c legacyCollector) visit(n *html.Node) {
+	if n.Type != html.ElementNode {
+		if n.Type == html.TextNode {
+			c.conllectText(n.Data)
+		}
+		return
+	}
+
+	c.addMicrodata(n)
+
+	switch n.Data {
+	case "script":
+		c.addJSONLD(n)
+		return
+	case "style":
+		return
+	case "html":
+		c.HTMLLang = getAttr(n, "lang")
+		if c.HTMLLang == "" {
+			c.HTMLLang = getAttr(n, "xml:lang")
+		}
+	case "base":
+		c.setBase(getAttr(n, "href"))
+	case "meta":
+		c.mergeMeta(extrantMeta(n))
+		c.addCardTag(n)
+		if target, ok := refreshTarget(n); ok {
+			c.maybeAddLink(target, entity.LinkRefresh, "")
+		}
+	case "link":
+		if isIconLink(n) {
+			c.Meta.Icons = append(c.Meta.Icons, getAttr(n, "href"))
+		}
+		switch {
+		case isFeedLink(n):
+			c.maybeAddFeed(getAttr(n, "href"))
+		case isHreflangLink(n):
+			c.maybeAddAlternate(getAttr(n, "href"), getAttr(n, "hreflang"))
+		case isFollowedRelLink(n):
+			c.maybeAddLink(getAttr(n, "href"), entity.LinkRel, "")
+		}
+	case "a":
+		c.maybeAddLink(getAttr(n, "href"), entity.LinkAnchor, legacyTextContent(n))
+	case "area":
+		c.maybeAddLink(getAttr(n, "href"), entity.LinkArea, getAttr(n, "alt"))
+	case "iframe", "frame":
+		c.maybeAddLink(getAttr(n, "src"), entity.LinkFrame, "")
+	case "img":
+		c.maybeAddImage(getAttr(n, "src"), entity.LinkImage)
+		c.maybeAddSrcset(getAttr(n, "srcset"))
+	case "source":
+		if n.Parent != nil && n.Parent.Type == html.ElementNode && n.Parent.Data == "picture" {
+			c.maybeAddSrcset(getAttr(n, "srcset"))
+		}
+	case "title":
+		if n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+			c.Meta.Title = strings.TrimSpace(n.FirstChild.Data)
+		}
+	}
+}
+
+func (c legacyCollector) addJSONLD(n *html.Node) {
+	if !isJSONLD(n) {
+		return
+	}
+
+	var raw strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			raw.WriteString(child.Data)
+		}
+	}
+	var doc any
+	if err := json.Unmarshal([]byte(raw.String()), &doc); err != nil {
+		return
+	}
+	c.findEntities(doc, sourceJSONLD)
+}
+
+func (c legacyCollector) addMicrodata(n *html.Node) {
+	if !hasAttr(n, "itemscope") || hasAttr(n, "itemprop") {
+		return
+	}
+	c.findEntities(legacyMicrodataItem(n), sourceMicrodata)
+}
+
+func legacyMicrodataItem(n *html.Node) map[string]any {
+	item := map[string]any{}
+	if types := strings.Fields(getAttr(n, "itemtype")); len(types) > 0 {
+		list := make([]any, len(types))
+		for i, t := range types {
+			list[i] = t
+		}
+		item["@type"] = list
+	}
+
+	var walk func(*html.Node)
+	walk = func(p *html.Node) {
+		for child := p.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			props := strings.Fields(getAttr(child, "itemprop"))
+			scope := hasAttr(child, "itemscope")
+			if len(props) > 0 {
+				var value any
+				if scope {
+					value = legacyMicrodataItem(child)
+				} else if v, ok := microdataValue(child); ok {
+					value = v
+				} else {
+					value = legacyTextContent(child)
+				}
+				for _, prop := range props {
+					list, _ := item[prop].([]any)
+					item[prop] = append(list, value)
+				}
+			}
+			if !scope {
+				walk(child)
+			}
+		}
+	}
+	walk(n)
+	return item
+}
+
+func legacyTraverse(n *html.Node, visit func(*html.Node)) {
+	visit(n)
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		legacyTraverse(child, visit)
+	}
+}
+
+func legacyTextContent(n *html.Node) string {
+	var parts []string
+	legacyTraverse(n, func(c *html.Node) {
+		switch {
+		case c.Type == html.TextNode:
+			parts = append(parts, c.Data)
+		case c.Type == html.ElementNode && c.Data == "img":
+			parts = append(parts, getAttr(c, "alt"))
+		}
+	})
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
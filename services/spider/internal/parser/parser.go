@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"bytes"
 	"io"
 	"log/slog"
 	"net/http"
@@ -9,36 +10,57 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Hassan-ach/boogle/services/spider/internal/config"
 	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
 	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
-
-	"golang.org/x/net/html"
 )
 
 type Parser struct {
 	Client *http.Client
+	limits config.ParserConfig
 	log    *slog.Logger
 }
 
-func NewParser(client *http.Client, logger *utils.Logger) *Parser {
+func NewParser(client *http.Client, limits config.ParserConfig, logger *utils.Logger) *Parser {
 	return &Parser{
 		Client: client,
+		limits: limits,
 		log:    logger.With("component", "parser"),
 	}
 }
 
+// ParseHTML parses a page as it is read from r, without building a DOM.
+// The bytes read become the page's HTML. baseURL, the URL the page was
+// finally fetched from after redirects, becomes the page's URL and the
+// base its links are resolved against. Parsing stops at the configured
+// body size, node count or time limit, and elements nested too deep are
+// skipped; either way the page's Truncated field says why.
 func (p *Parser) ParseHTML(r io.Reader, baseURL string) (*entity.Page, error) {
-	doc, err := html.Parse(r)
-	if err != nil {
-		return nil, err
-	}
-
 	u, _ := url.Parse(baseURL)
 
+	body := newLimitedReader(r, p.limits.MaxBodySize)
+	var raw bytes.Buffer
 	c := newHtmlCollector(u)
-	traverse(doc, c.Visit)
+	truncated, err := c.parse(io.TeeReader(body, &raw), p.limits)
+	if err != nil {
+		return nil, err
+	}
+	c.closeAll()
+
+	switch {
+	case truncated != "":
+	case body.truncated:
+		truncated = truncatedSize
+	case c.tooDeep:
+		truncated = truncatedDepth
+	}
+	if truncated != "" {
+		p.log.Warn("Page only partly parsed", "url", baseURL, "truncated", truncated, "bytes", raw.Len(), "nodes", c.nodes)
+	}
+	c.Meta.Truncated = truncated
 
-	desc := strings.TrimSpace(c.TextBuffer.String())
+	text := strings.TrimSpace(c.TextBuffer.String())
+	desc := text
 	if len(desc) > 300 {
 		desc = desc[:300]
 	}
@@ -48,20 +70,39 @@ func (p *Parser) ParseHTML(r io.Reader, baseURL string) (*entity.Page, error) {
 	}
 	c.Meta.CrawledAt = time.Now()
 
+	links := dedupeLinks(c.Links)
 	p.log.Info(
 		"",
 		"links_found",
-		len(c.Links),
-		"images_found",
-		len(c.Imags),
+		len(links),
 	)
 
-	return &entity.Page{
+	page := &entity.Page{
 		MetaData: c.Meta,
-		Links: utils.NewSetFromSlice(
-			utils.NormalizeUrls(c.Links, u.Host)).GetAll(),
-		Images: utils.NewSetFromSlice(c.Imags).GetAll(),
-	}, nil
+		HTML:     raw.Bytes(),
+		HTMLLang: c.HTMLLang,
+		Outlinks: links,
+		Feeds:    utils.NewSetFromSlice(c.Feeds).GetAll(),
+		Embeds:   c.Embeds,
+		Text:     text,
+		Anchors:  c.Anchors,
+	}
+	page.URL = baseURL
+	return page, nil
+}
+
+// dedupeLinks drops repeated links, keeping the first of each URL and
+// source.
+func dedupeLinks(links []entity.Link) []entity.Link {
+	seen := make(map[entity.Link]bool, len(links))
+	out := make([]entity.Link, 0, len(links))
+	for _, l := range links {
+		if !seen[l] {
+			seen[l] = true
+			out = append(out, l)
+		}
+	}
+	return out
 }
 
 func (p *Parser) ParseRobots(txt, ua string) *entity.Robots {
@@ -87,6 +128,10 @@ func (p *Parser) ParseRobots(txt, ua string) *entity.Robots {
 		case strings.HasPrefix(lower, "user-agent:"):
 			userAgent := strings.TrimSpace(line[11:])
 			uaActive = (userAgent == ua || userAgent == "*")
+		case strings.HasPrefix(lower, "sitemap:"):
+			// sitemaps are not part of a group
+			sitemapURL := strings.TrimSpace(line[8:])
+			r.SiteMaps = append(r.SiteMaps, sitemapURL)
 		case uaActive:
 			switch {
 			case strings.HasPrefix(lower, "disallow:"):
@@ -100,10 +145,6 @@ func (p *Parser) ParseRobots(txt, ua string) *entity.Robots {
 					r.CrawlDelay = d
 				}
 			}
-
-		case strings.HasPrefix(lower, "sitemap:"):
-			sitemapURL := strings.TrimSpace(line[8:])
-			r.SiteMaps = append(r.SiteMaps, sitemapURL)
 		}
 	}
 	return r
@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/config"
+)
+
+// page builds a document of n articles, each with a heading, paragraphs,
+// a list of links and an image.
+func page(n int) []byte {
+	var b strings.Builder
+	b.WriteString(`<!doctype html><html lang="en"><head><title>Benchmark</title>`)
+	b.WriteString(`<meta name="description" content="A page to parse">`)
+	b.WriteString(`<script type="application/ld+json">{"@type":"Article","headline":"Benchmark","author":{"name":"Ada"}}</script>`)
+	b.WriteString(`<style>body{margin:0}</style></head><body><nav><ul>`)
+	for i := range 20 {
+		fmt.Fprintf(&b, `<li><a href="/section/%d">Section %d</a>`, i, i)
+	}
+	b.WriteString(`</ul></nav><main>`)
+	for i := range n {
+		fmt.Fprintf(&b, `<article><h2><a href="/post/%d">Post %d</a></h2>`, i, i)
+		for range 3 {
+			b.WriteString(`<p>Lorem ipsum dolor sit amet, <em>consectetur</em> adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.`)
+		}
+		fmt.Fprintf(&b, `<ul><li><a href="https://example.org/%d">related</a><li><a href="/tag/%d"><img src="/t/%d.png" alt="tag"></a></ul>`, i, i, i)
+		b.WriteString(`</article>`)
+	}
+	b.WriteString(`</main></body></html>`)
+	return []byte(b.String())
+}
+
+// nested builds a document of n elements nested in one another.
+func nested(n int) []byte {
+	return []byte(`<html><body>` + strings.Repeat(`<div><span>text`, n) + `</body></html>`)
+}
+
+func benchParser() *Parser {
+	return &Parser{
+		limits: config.ParserConfig{
+			MaxBodySize: 10 << 20,
+			MaxNodes:    500_000,
+			MaxDepth:    256,
+			Timeout:     5 * time.Second,
+		},
+		log: slog.New(slog.DiscardHandler),
+	}
+}
+
+// parseTree feeds the collector with the tree html.Parse builds, the
+// reference the streaming tree builder is checked against.
+func parseTree(doc []byte, baseURL string) (*htmlCollector, error) {
+	u, _ := url.Parse(baseURL)
+	root, err := html.Parse(bytes.NewReader(doc))
+	if err != nil {
+		return nil, err
+	}
+	c := newHtmlCollector(u)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.ElementNode:
+			c.stack = append(c.stack, n.Data)
+			c.visit(n)
+		case html.TextNode:
+			c.text(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if n.Type == html.ElementNode {
+			c.pop()
+		}
+	}
+	walk(root)
+	c.closeAll()
+	return c, nil
+}
+
+func BenchmarkParseHTML(b *testing.B) {
+	docs := []struct {
+		name string
+		doc  []byte
+	}{
+		{"small", page(10)},
+		{"large", page(2000)},
+		{"nested", nested(5000)},
+	}
+	for _, d := range docs {
+		b.Run(d.name+"/stream", func(b *testing.B) {
+			p := benchParser()
+			b.SetBytes(int64(len(d.doc)))
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := p.ParseHTML(bytes.NewReader(d.doc), "https://example.com/"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(d.name+"/legacy", func(b *testing.B) {
+			b.SetBytes(int64(len(d.doc)))
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := legacyParseHTML(bytes.NewReader(d.doc), "https://example.com/"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -5,12 +5,16 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
 	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
 )
 
 type u struct {
-	Loc string `xml:"loc"`
+	Loc      string `xml:"loc"`
+	Priority string `xml:"priority"`
 }
 
 func (u u) Parse(raw string) (any, error) {
@@ -34,8 +38,8 @@ func parseSitemap(file []byte) (*SiteMaps, error) {
 	return &sitemap, nil
 }
 
-func fetchSitemap(client *http.Client, sitemapURL string, host *url.URL) ([]string, error) {
-	var r []string
+func fetchSitemap(client *http.Client, sitemapURL string, host *url.URL) ([]entity.SitemapURL, error) {
+	var r []entity.SitemapURL
 
 	siteUrl, _ := url.Parse(sitemapURL)
 	if siteUrl.Scheme == "" {
@@ -60,14 +64,18 @@ func fetchSitemap(client *http.Client, sitemapURL string, host *url.URL) ([]stri
 		if !ok {
 			return nil, fmt.Errorf("fetching sitemap: invalid URL %s", u.Loc)
 		}
-		r = append(r, x)
+		p, err := strconv.ParseFloat(strings.TrimSpace(u.Priority), 64)
+		if err != nil || p < 0 || p > 1 {
+			p = 0.5
+		}
+		r = append(r, entity.SitemapURL{Loc: x, Priority: p})
 	}
 
 	return r, nil
 }
 
-func FetchSitemaps(client *http.Client, s []string, host *url.URL) []string {
-	var r []string
+func FetchSitemaps(client *http.Client, s []string, host *url.URL) []entity.SitemapURL {
+	var r []entity.SitemapURL
 	for _, sitemapURL := range s {
 		if siteUrls, err := fetchSitemap(client, sitemapURL, host); err == nil {
 			r = append(r, siteUrls...)
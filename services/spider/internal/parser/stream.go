@@ -0,0 +1,280 @@
+package parser
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/config"
+)
+
+// Reasons a page was only partly parsed, reported in its metadata.
+const (
+	truncatedSize  = "size"  // body longer than MAX_BODY_SIZE_MB
+	truncatedNodes = "nodes" // more than PARSE_MAX_NODES
+	truncatedDepth = "depth" // elements nested deeper than PARSE_MAX_DEPTH were skipped
+	truncatedTime  = "time"  // parsing took longer than PARSE_TIMEOUT_MS
+)
+
+// deadlineEvery is how many tokens are parsed between two checks of the
+// parse deadline.
+const deadlineEvery = 256
+
+// voidElements have no content and no end tag.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// impliedEnds are the elements ended by the start of another of the same
+// kind, as an <li> ends the previous <li> of its list.
+var impliedEnds = map[string]bool{
+	"p": true, "li": true, "dt": true, "dd": true, "option": true,
+	"tr": true, "td": true, "th": true, "a": true,
+}
+
+// blocks bound the search for an element ended by an implied end: a <li>
+// does not end the <li> holding its list.
+var blocks = map[string]bool{
+	"html": true, "body": true, "div": true, "section": true, "article": true,
+	"main": true, "nav": true, "aside": true, "header": true, "footer": true,
+	"ul": true, "ol": true, "dl": true, "table": true, "select": true,
+	"form": true, "blockquote": true, "figure": true, "details": true,
+}
+
+// capture collects the text of an open element, handed to done when the
+// element ends.
+type capture struct {
+	depth int
+	parts []string
+	done  func(text string)
+}
+
+// parse feeds the tokens of r to the collector until the end of the
+// document or a limit. It returns the limit that stopped it, if any. Open
+// elements are left for closeAll.
+func (c *htmlCollector) parse(r io.Reader, limits config.ParserConfig) (string, error) {
+	z := html.NewTokenizer(r)
+
+	var deadline time.Time
+	if limits.Timeout > 0 {
+		deadline = time.Now().Add(limits.Timeout)
+	}
+
+	for i := 0; ; i++ {
+		if limits.MaxNodes > 0 && c.nodes >= limits.MaxNodes {
+			return truncatedNodes, nil
+		}
+		if !deadline.IsZero() && i%deadlineEvery == 0 && time.Now().After(deadline) {
+			return truncatedTime, nil
+		}
+
+		switch z.Next() {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return "", err
+			}
+			return "", nil
+		case html.TextToken:
+			c.nodes++
+			c.text(string(z.Text()))
+		case html.StartTagToken:
+			c.nodes++
+			c.start(z.Token(), false, limits.MaxDepth)
+		case html.SelfClosingTagToken:
+			c.nodes++
+			c.start(z.Token(), true, limits.MaxDepth)
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			c.end(string(name))
+		}
+	}
+}
+
+// start opens an element and visits it. Void and self-closed elements are
+// closed right away. Elements beyond maxDepth are skipped, their text
+// aside: they are kept on their own stack, inside the innermost open
+// element, so their end tags are told apart from those of open elements.
+func (c *htmlCollector) start(t html.Token, selfClosing bool, maxDepth int) {
+	empty := selfClosing || voidElements[t.Data]
+	if len(c.skipped) > 0 {
+		c.tooDeep = true
+		if impliedEnds[t.Data] {
+			c.skipped = c.skipped[:impliedEnd(c.skipped, t.Data)]
+		}
+		if !empty {
+			c.skipped = append(c.skipped, t.Data)
+		}
+		return
+	}
+	if impliedEnds[t.Data] {
+		c.endImplied(t.Data)
+	}
+
+	if maxDepth > 0 && len(c.stack) >= maxDepth {
+		c.tooDeep = true
+		if !empty {
+			c.skipped = append(c.skipped, t.Data)
+		}
+		return
+	}
+
+	c.stack = append(c.stack, t.Data)
+	c.visit(&html.Node{Type: html.ElementNode, Data: t.Data, Attr: t.Attr})
+	if empty {
+		c.pop()
+	}
+}
+
+// end closes the innermost open element named name and those inside it,
+// skipped elements first. Stray end tags are ignored.
+func (c *htmlCollector) end(name string) {
+	for i := len(c.skipped) - 1; i >= 0; i-- {
+		if c.skipped[i] == name {
+			c.skipped = c.skipped[:i]
+			return
+		}
+	}
+	for i := len(c.stack) - 1; i >= 0; i-- {
+		if c.stack[i] == name {
+			// the skipped elements are inside it
+			c.skipped = c.skipped[:0]
+			for len(c.stack) > i {
+				c.pop()
+			}
+			return
+		}
+	}
+}
+
+// endImplied closes an open element named name within the current block.
+func (c *htmlCollector) endImplied(name string) {
+	for i := impliedEnd(c.stack, name); len(c.stack) > i; {
+		c.pop()
+	}
+}
+
+// impliedEnd returns the index in stack of the element named name that the
+// start of another one ends, or len(stack) when it is not open within the
+// current block.
+func impliedEnd(stack []string, name string) int {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch {
+		case stack[i] == name:
+			return i
+		case blocks[stack[i]]:
+			return len(stack)
+		}
+	}
+	return len(stack)
+}
+
+// pop closes the innermost open element, completing the captures and
+// microdata items it holds.
+func (c *htmlCollector) pop() {
+	depth := len(c.stack)
+
+	for len(c.captures) > 0 && c.captures[len(c.captures)-1].depth >= depth {
+		cp := c.captures[len(c.captures)-1]
+		c.captures = c.captures[:len(c.captures)-1]
+		cp.done(strings.Join(strings.Fields(strings.Join(cp.parts, " ")), " "))
+	}
+	for len(c.items) > 0 && c.items[len(c.items)-1].depth >= depth {
+		it := c.items[len(c.items)-1]
+		c.items = c.items[:len(c.items)-1]
+		if it.top {
+			c.findEntities(it.props, sourceMicrodata)
+		}
+	}
+	if c.stack[depth-1] == "script" && c.jsonLD != nil {
+		c.addJSONLD(c.jsonLD.String())
+		c.jsonLD = nil
+	}
+
+	c.stack = c.stack[:depth-1]
+}
+
+// closeAll closes the elements left open at the end of the document.
+func (c *htmlCollector) closeAll() {
+	for len(c.stack) > 0 {
+		c.pop()
+	}
+}
+
+// text handles a text token. Script and style contents are not visible
+// text; the text of a JSON-LD script is kept for addJSONLD.
+func (c *htmlCollector) text(s string) {
+	switch c.parent(0) {
+	case "script":
+		if c.jsonLD != nil {
+			c.jsonLD.WriteString(s)
+		}
+		return
+	case "style", "noscript":
+		return
+	case "title":
+		c.Meta.Title = strings.TrimSpace(s)
+	}
+
+	c.conllectText(s)
+	c.addCaptured(s)
+}
+
+// capture starts collecting the text of the element being visited.
+func (c *htmlCollector) capture(done func(text string)) {
+	c.captures = append(c.captures, capture{depth: len(c.stack), done: done})
+}
+
+func (c *htmlCollector) addCaptured(s string) {
+	if strings.TrimSpace(s) == "" {
+		return
+	}
+	for i := range c.captures {
+		c.captures[i].parts = append(c.captures[i].parts, s)
+	}
+}
+
+// parent returns the name of the open element i levels above the innermost
+// one, or "".
+func (c *htmlCollector) parent(i int) string {
+	if i >= len(c.stack) {
+		return ""
+	}
+	return c.stack[len(c.stack)-1-i]
+}
+
+// limitedReader reads up to n bytes of r, all of it when n <= 0, and
+// records whether r had more.
+type limitedReader struct {
+	r         io.Reader
+	n         int64
+	limited   bool
+	truncated bool
+}
+
+func newLimitedReader(r io.Reader, n int64) *limitedReader {
+	return &limitedReader{r: r, n: n, limited: n > 0}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if !l.limited {
+		return l.r.Read(p)
+	}
+	if l.n <= 0 {
+		if !l.truncated {
+			var b [1]byte
+			k, _ := io.ReadFull(l.r, b[:])
+			l.truncated = k > 0
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	k, err := l.r.Read(p)
+	l.n -= int64(k)
+	return k, err
+}
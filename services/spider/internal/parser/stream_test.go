@@ -0,0 +1,156 @@
+package parser
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/config"
+)
+
+// parseStream feeds the collector with the streaming tree builder.
+func parseStream(t *testing.T, doc []byte, baseURL string, limits config.ParserConfig) *htmlCollector {
+	t.Helper()
+	u, _ := url.Parse(baseURL)
+	c := newHtmlCollector(u)
+	if _, err := c.parse(bytes.NewReader(doc), limits); err != nil {
+		t.Fatal(err)
+	}
+	c.closeAll()
+	return c
+}
+
+func TestStreamMatchesTree(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.html")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			doc, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			const base = "https://example.com/articles/page"
+
+			want, err := parseTree(doc, base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := parseStream(t, doc, base, benchParser().limits)
+
+			if got.Meta.Title != want.Meta.Title {
+				t.Errorf("title = %q, want %q", got.Meta.Title, want.Meta.Title)
+			}
+			if got, want := got.TextBuffer.String(), want.TextBuffer.String(); got != want {
+				t.Errorf("text =\n%s\nwant\n%s", got, want)
+			}
+			if got, want := dedupeLinks(got.Links), dedupeLinks(want.Links); !reflect.DeepEqual(got, want) {
+				t.Errorf("links =\n%v\nwant\n%v", got, want)
+			}
+			if !reflect.DeepEqual(got.Anchors, want.Anchors) {
+				t.Errorf("anchors =\n%v\nwant\n%v", got.Anchors, want.Anchors)
+			}
+			if !reflect.DeepEqual(got.Meta, want.Meta) {
+				t.Errorf("metadata =\n%+v\nwant\n%+v", got.Meta, want.Meta)
+			}
+			if !reflect.DeepEqual(got.Feeds, want.Feeds) || !reflect.DeepEqual(got.Embeds, want.Embeds) {
+				t.Errorf("feeds, embeds = %v, %v, want %v, %v", got.Feeds, got.Embeds, want.Feeds, want.Embeds)
+			}
+			if got.HTMLLang != want.HTMLLang {
+				t.Errorf("lang = %q, want %q", got.HTMLLang, want.HTMLLang)
+			}
+			if got.tooDeep || len(got.skipped) > 0 {
+				t.Errorf("elements skipped within the depth limit: %v", got.skipped)
+			}
+		})
+	}
+}
+
+func TestSkippedElements(t *testing.T) {
+	limits := config.ParserConfig{MaxDepth: 2}
+
+	tests := []struct {
+		name    string
+		doc     string
+		anchors map[string]string
+	}{
+		{
+			name: "unclosed skipped element",
+			doc: `<div><section><a href="/deep">deep</section></div>` +
+				`<p><a href="/next">next</a> tail</p>`,
+			anchors: map[string]string{"https://example.com/next": "next"},
+		},
+		{
+			name: "closed skipped elements",
+			doc: `<div><section><a href="/deep">deep</a><b>bold</b></section></div>` +
+				`<p><a href="/next">next</a> tail</p>`,
+			anchors: map[string]string{"https://example.com/next": "next"},
+		},
+		{
+			name: "implied end of a skipped element",
+			doc: `<div><ul><li><b>one<li><b>two</ul></div>` +
+				`<b>bold</b><a href="/next">next</a> tail`,
+			anchors: map[string]string{"https://example.com/next": "next"},
+		},
+		{
+			name: "stray end tag while skipping",
+			doc: `<div><section><span>deep</i></span></section></div>` +
+				`<p><a href="/next">next</a> tail</p>`,
+			anchors: map[string]string{"https://example.com/next": "next"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := parseStream(t, []byte(tt.doc), "https://example.com/", limits)
+			if !c.tooDeep {
+				t.Error("depth limit not reported")
+			}
+			if !reflect.DeepEqual(c.Anchors, tt.anchors) {
+				t.Errorf("anchors = %v, want %v", c.Anchors, tt.anchors)
+			}
+		})
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	doc := page(200)
+
+	tests := []struct {
+		name   string
+		limits config.ParserConfig
+		want   string
+	}{
+		{"none", config.ParserConfig{}, ""},
+		{"size", config.ParserConfig{MaxBodySize: 4 << 10}, truncatedSize},
+		{"nodes", config.ParserConfig{MaxNodes: 100}, truncatedNodes},
+		{"depth", config.ParserConfig{MaxDepth: 4}, truncatedDepth},
+		{"time", config.ParserConfig{Timeout: time.Nanosecond}, truncatedTime},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := benchParser()
+			p.limits = tt.limits
+			page, err := p.ParseHTML(bytes.NewReader(doc), "https://example.com/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Truncated != tt.want {
+				t.Errorf("truncated = %q, want %q", page.Truncated, tt.want)
+			}
+			if tt.want == truncatedSize && int64(len(page.HTML)) != tt.limits.MaxBodySize {
+				t.Errorf("kept %d bytes, want %d", len(page.HTML), tt.limits.MaxBodySize)
+			}
+			if tt.want != truncatedTime && page.Title != "Benchmark" {
+				t.Errorf("title = %q, want %q", page.Title, "Benchmark")
+			}
+		})
+	}
+}
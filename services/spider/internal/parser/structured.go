@@ -0,0 +1,535 @@
+package parser
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+)
+
+const (
+	maxEntities     = 20  // per page
+	maxListItems    = 50  // breadcrumbs, questions, ingredients, ...
+	maxTextRunes    = 500 // descriptions and answers
+	jsonLDType      = "application/ld+json"
+	sourceJSONLD    = "json-ld"
+	sourceMicrodata = "microdata"
+)
+
+// entityKinds maps the schema.org types kept to their kind. Other types,
+// such as WebPage, are searched for entities of these types.
+var entityKinds = map[string]string{
+	"Article":          "Article",
+	"NewsArticle":      "Article",
+	"BlogPosting":      "Article",
+	"LiveBlogPosting":  "Article",
+	"TechArticle":      "Article",
+	"ScholarlyArticle": "Article",
+	"Report":           "Article",
+
+	"Product":      "Product",
+	"ProductGroup": "Product",
+
+	"Recipe": "Recipe",
+
+	"Organization":            "Organization",
+	"Corporation":             "Organization",
+	"NewsMediaOrganization":   "Organization",
+	"EducationalOrganization": "Organization",
+	"NGO":                     "Organization",
+	"LocalBusiness":           "Organization",
+
+	"BreadcrumbList": "BreadcrumbList",
+	"FAQPage":        "FAQPage",
+}
+
+// addCardTag keeps the Open Graph (og:, article:, product:) and Twitter
+// card properties of a <meta>. The first value of a property wins.
+func (c *htmlCollector) addCardTag(n *html.Node) {
+	content := strings.TrimSpace(getMetaContent(n))
+	if content == "" {
+		return
+	}
+	key := getAttr(n, "property")
+	if key == "" {
+		key = getAttr(n, "name")
+	}
+	key = strings.ToLower(strings.TrimSpace(key))
+
+	switch {
+	case strings.HasPrefix(key, "twitter:"):
+		c.Meta.Twitter = setOnce(c.Meta.Twitter, key[len("twitter:"):], content)
+	case strings.HasPrefix(key, "og:"):
+		c.Meta.OpenGraph = setOnce(c.Meta.OpenGraph, key[len("og:"):], content)
+	case strings.HasPrefix(key, "article:"), strings.HasPrefix(key, "product:"):
+		c.Meta.OpenGraph = setOnce(c.Meta.OpenGraph, key, content)
+	}
+}
+
+func setOnce(m map[string]string, key, value string) map[string]string {
+	if key == "" {
+		return m
+	}
+	if m == nil {
+		m = map[string]string{}
+	}
+	if _, ok := m[key]; !ok {
+		m[key] = value
+	}
+	return m
+}
+
+// isJSONLD reports whether n is a <script type="application/ld+json">.
+func isJSONLD(n *html.Node) bool {
+	typ, _, _ := strings.Cut(getAttr(n, "type"), ";")
+	return strings.EqualFold(strings.TrimSpace(typ), jsonLDType)
+}
+
+// addJSONLD collects the entities of the text of a JSON-LD script.
+// Invalid JSON, common in hand-written blocks, is skipped.
+func (c *htmlCollector) addJSONLD(raw string) {
+	var doc any
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		return
+	}
+	c.findEntities(doc, sourceJSONLD)
+}
+
+// findEntities walks a JSON-LD document, or a microdata item in the same
+// shape, and keeps the objects of a known type. Their nested objects, such
+// as an article's publisher, are part of them and not kept on their own.
+func (c *htmlCollector) findEntities(v any, source string) {
+	if len(c.Meta.Entities) >= maxEntities {
+		return
+	}
+	switch v := v.(type) {
+	case []any:
+		for _, item := range v {
+			c.findEntities(item, source)
+		}
+	case map[string]any:
+		for _, t := range ldTypes(v) {
+			if kind, ok := entityKinds[t]; ok {
+				if e, ok := c.newEntity(kind, t, v); ok {
+					e.Source = source
+					c.Meta.Entities = append(c.Meta.Entities, e)
+				}
+				return
+			}
+		}
+		// in key order, so that a page always yields the same entities
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			if key != "@context" {
+				c.findEntities(v[key], source)
+			}
+		}
+	}
+}
+
+// newEntity reduces a schema.org object to the fields of its kind. It
+// reports false when nothing worth showing is left.
+func (c *htmlCollector) newEntity(kind, typ string, obj map[string]any) (entity.Entity, bool) {
+	e := entity.Entity{
+		Kind:        kind,
+		Type:        typ,
+		Name:        ldText(obj["name"]),
+		Description: truncateRunes(stripTags(ldText(obj["description"])), maxTextRunes),
+		URL:         c.ldURL(obj["url"]),
+		Image:       c.ldURL(obj["image"]),
+	}
+
+	switch kind {
+	case "Article":
+		if h := ldText(obj["headline"]); h != "" {
+			e.Name = h
+		}
+		e.Authors = ldNames(obj["author"])
+		e.Publisher = ldName(obj["publisher"])
+		e.DatePublished = ldText(obj["datePublished"])
+		e.DateModified = ldText(obj["dateModified"])
+	case "Product":
+		e.Brand = ldName(obj["brand"])
+		e.Offer = ldOffer(obj["offers"])
+		e.Rating = ldRating(obj["aggregateRating"])
+	case "Recipe":
+		e.Authors = ldNames(obj["author"])
+		e.DatePublished = ldText(obj["datePublished"])
+		e.CookTime = ldText(obj["cookTime"])
+		e.TotalTime = ldText(obj["totalTime"])
+		e.Yield = ldText(obj["recipeYield"])
+		e.Ingredients = limit(ldTexts(obj["recipeIngredient"]), maxListItems)
+		e.Rating = ldRating(obj["aggregateRating"])
+	case "Organization":
+		e.Logo = c.ldURL(obj["logo"])
+		for _, s := range ldTexts(obj["sameAs"]) {
+			if u, ok := c.resolve(s); ok {
+				e.SameAs = append(e.SameAs, u.String())
+			}
+		}
+		e.SameAs = limit(e.SameAs, maxListItems)
+	case "BreadcrumbList":
+		e.Breadcrumbs = c.ldBreadcrumbs(obj["itemListElement"])
+		return e, len(e.Breadcrumbs) > 0
+	case "FAQPage":
+		e.Questions = ldQuestions(obj["mainEntity"])
+		return e, len(e.Questions) > 0
+	}
+	return e, e.Name != ""
+}
+
+func (c *htmlCollector) ldBreadcrumbs(v any) []entity.Breadcrumb {
+	type crumb struct {
+		entity.Breadcrumb
+		position float64
+	}
+	var crumbs []crumb
+	for _, item := range ldList(v) {
+		obj, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		b := entity.Breadcrumb{Name: ldText(obj["name"])}
+		switch target := obj["item"].(type) {
+		case string:
+			b.URL = c.ldURL(target)
+		case map[string]any:
+			b.URL = c.ldURL(firstOf(target, "@id", "url"))
+			if b.Name == "" {
+				b.Name = ldText(target["name"])
+			}
+		}
+		if b.Name == "" {
+			continue
+		}
+		position, _ := ldNumber(obj["position"])
+		crumbs = append(crumbs, crumb{b, position})
+	}
+	slices.SortStableFunc(crumbs, func(a, b crumb) int {
+		switch {
+		case a.position < b.position:
+			return -1
+		case a.position > b.position:
+			return 1
+		}
+		return 0
+	})
+
+	out := make([]entity.Breadcrumb, 0, len(crumbs))
+	for _, b := range limit(crumbs, maxListItems) {
+		out = append(out, b.Breadcrumb)
+	}
+	return out
+}
+
+func ldQuestions(v any) []entity.Question {
+	var out []entity.Question
+	for _, item := range ldList(v) {
+		obj, ok := item.(map[string]any)
+		if !ok || !slices.Contains(ldTypes(obj), "Question") {
+			continue
+		}
+		q := entity.Question{Question: ldText(obj["name"])}
+		if q.Question == "" {
+			continue
+		}
+		if answer, ok := firstItem(obj["acceptedAnswer"]).(map[string]any); ok {
+			q.Answer = truncateRunes(stripTags(ldText(answer["text"])), maxTextRunes)
+		}
+		out = append(out, q)
+	}
+	return limit(out, maxListItems)
+}
+
+// ldOffer returns the first offer of a product, or the low price of an
+// AggregateOffer.
+func ldOffer(v any) *entity.Offer {
+	obj, ok := firstItem(v).(map[string]any)
+	if !ok {
+		return nil
+	}
+	o := entity.Offer{
+		Price:        ldText(firstOf(obj, "price", "lowPrice")),
+		Currency:     ldText(obj["priceCurrency"]),
+		Availability: schemaEnum(ldText(obj["availability"])),
+	}
+	if o == (entity.Offer{}) {
+		return nil
+	}
+	return &o
+}
+
+func ldRating(v any) *entity.Rating {
+	obj, ok := firstItem(v).(map[string]any)
+	if !ok {
+		return nil
+	}
+	value, ok := ldNumber(obj["ratingValue"])
+	if !ok {
+		return nil
+	}
+	r := entity.Rating{Value: value}
+	r.Best, _ = ldNumber(obj["bestRating"])
+	count, ok := ldNumber(obj["ratingCount"])
+	if !ok {
+		count, _ = ldNumber(obj["reviewCount"])
+	}
+	r.Count = int64(count)
+	return &r
+}
+
+// ldURL resolves a URL value, or the url of an ImageObject or logo.
+func (c *htmlCollector) ldURL(v any) string {
+	v = firstItem(v)
+	if obj, ok := v.(map[string]any); ok {
+		v = firstOf(obj, "url", "contentUrl", "@id")
+	}
+	if u, ok := c.resolve(ldText(v)); ok {
+		return u.String()
+	}
+	return ""
+}
+
+// ldTypes returns the @type of an object, which may be a list. Types given
+// as URLs, as in microdata, are reduced to their name.
+func ldTypes(obj map[string]any) []string {
+	var types []string
+	for _, t := range ldTexts(obj["@type"]) {
+		types = append(types, schemaEnum(t))
+	}
+	return types
+}
+
+// schemaEnum turns "https://schema.org/InStock" into "InStock".
+func schemaEnum(s string) string {
+	if i := strings.LastIndexByte(s, '/'); i >= 0 && strings.Contains(s, "schema.org") {
+		return s[i+1:]
+	}
+	return s
+}
+
+// ldText returns a scalar value as a string, or the @value of a value
+// object.
+func ldText(v any) string {
+	switch v := firstItem(v).(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]any:
+		return ldText(v["@value"])
+	}
+	return ""
+}
+
+func ldTexts(v any) []string {
+	var out []string
+	for _, item := range ldList(v) {
+		if s := ldText(item); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// ldName returns the name of a Person or Organization, which may also be
+// given as a plain string.
+func ldName(v any) string {
+	v = firstItem(v)
+	if obj, ok := v.(map[string]any); ok {
+		return ldText(obj["name"])
+	}
+	return ldText(v)
+}
+
+func ldNames(v any) []string {
+	var out []string
+	for _, item := range ldList(v) {
+		if name := ldName(item); name != "" && !slices.Contains(out, name) {
+			out = append(out, name)
+		}
+	}
+	return limit(out, maxListItems)
+}
+
+func ldNumber(v any) (float64, bool) {
+	switch v := firstItem(v).(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(v), ",", "."), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// ldList returns a list value as it is and a single value as a list of
+// one. An ItemList is replaced by its elements.
+func ldList(v any) []any {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		return v
+	case map[string]any:
+		if items, ok := v["itemListElement"]; ok {
+			return ldList(items)
+		}
+	}
+	return []any{v}
+}
+
+func firstItem(v any) any {
+	if list, ok := v.([]any); ok {
+		if len(list) == 0 {
+			return nil
+		}
+		return list[0]
+	}
+	return v
+}
+
+func firstOf(obj map[string]any, keys ...string) any {
+	for _, k := range keys {
+		if v, ok := obj[k]; ok && v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+func limit[T any](s []T, n int) []T {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// microdataItem is an open itemscope element, in the shape of a JSON-LD
+// object: its itemtype as @type, and the values of its itemprop
+// descendants, nested items included, as lists.
+type microdataItem struct {
+	depth int
+	props map[string]any
+	top   bool // not the value of another item's property
+}
+
+// visitMicrodata opens the item of an itemscope element, or adds the
+// value of an itemprop element to the innermost open item. Values given
+// by the element's text are filled in when it ends.
+func (c *htmlCollector) visitMicrodata(n *html.Node) {
+	props := strings.Fields(getAttr(n, "itemprop"))
+	var parent map[string]any
+	if len(props) > 0 && len(c.items) > 0 {
+		parent = c.items[len(c.items)-1].props
+	}
+
+	if hasAttr(n, "itemscope") {
+		item := map[string]any{}
+		if types := strings.Fields(getAttr(n, "itemtype")); len(types) > 0 {
+			list := make([]any, len(types))
+			for i, t := range types {
+				list[i] = t
+			}
+			item["@type"] = list
+		}
+		if parent != nil {
+			addMicrodataValue(parent, props, item)
+		}
+		c.items = append(c.items, microdataItem{depth: len(c.stack), props: item, top: parent == nil})
+		return
+	}
+	if parent == nil {
+		return
+	}
+
+	if v, ok := microdataValue(n); ok {
+		addMicrodataValue(parent, props, v)
+		return
+	}
+	slots := addMicrodataValue(parent, props, "")
+	c.capture(func(text string) {
+		for i, prop := range props {
+			parent[prop].([]any)[slots[i]] = text
+		}
+	})
+}
+
+// addMicrodataValue appends v to the values of props and returns its
+// index in each list.
+func addMicrodataValue(item map[string]any, props []string, v any) []int {
+	slots := make([]int, len(props))
+	for i, prop := range props {
+		list, _ := item[prop].([]any)
+		slots[i] = len(list)
+		item[prop] = append(list, v)
+	}
+	return slots
+}
+
+// microdataValue returns the value of an itemprop element given by its
+// attributes, as defined by the HTML microdata specification. It reports
+// false for elements whose value is their text.
+func microdataValue(n *html.Node) (string, bool) {
+	switch n.Data {
+	case "meta":
+		return getAttr(n, "content"), true
+	case "a", "area", "link":
+		return getAttr(n, "href"), true
+	case "img", "audio", "video", "source", "iframe", "embed", "track":
+		return getAttr(n, "src"), true
+	case "object":
+		return getAttr(n, "data"), true
+	case "data", "meter":
+		return getAttr(n, "value"), true
+	case "time":
+		if dt := getAttr(n, "datetime"); dt != "" {
+			return dt, true
+		}
+	}
+	if content := getAttr(n, "content"); content != "" {
+		return content, true
+	}
+	return "", false
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// stripTags returns the text of an HTML fragment, such as an FAQ answer.
+func stripTags(s string) string {
+	if !strings.ContainsRune(s, '<') {
+		return strings.Join(strings.Fields(s), " ")
+	}
+	z := html.NewTokenizer(strings.NewReader(s))
+	var parts []string
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+		case html.TextToken:
+			parts = append(parts, string(z.Text()))
+		}
+	}
+}
+
+func truncateRunes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
@@ -0,0 +1,154 @@
+package profile
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/config"
+)
+
+// profile is a fetch profile ready to be applied. transport is nil when
+// the profile needs no proxy or TLS settings of its own.
+type profile struct {
+	conf      config.FetchProfile
+	transport *http.Transport
+}
+
+// Transport applies the first fetch profile matching each request's host:
+// its headers, cookies and credentials are added to the request, and it is
+// sent through the profile's proxy and TLS settings. Redirects are matched
+// again, so credentials never follow a redirect to another host. Headers,
+// cookies and credentials are only sent over https, unless the profile
+// allows http.
+type Transport struct {
+	Base     http.RoundTripper // used by requests without a profile transport
+	profiles []profile
+}
+
+// NewTransport builds the proxy and TLS transports of profiles, cloned from
+// http.DefaultTransport.
+func NewTransport(base http.RoundTripper, profiles []config.FetchProfile) (*Transport, error) {
+	t := &Transport{Base: base}
+	for _, conf := range profiles {
+		tr, err := newProfileTransport(conf)
+		if err != nil {
+			return nil, fmt.Errorf("fetch profile %q: %w", conf.Name, err)
+		}
+		t.profiles = append(t.profiles, profile{conf: conf, transport: tr})
+	}
+	return t, nil
+}
+
+func newProfileTransport(conf config.FetchProfile) (*http.Transport, error) {
+	if conf.Proxy == "" && conf.CAFile == "" && conf.CertFile == "" && !conf.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+
+	if conf.Proxy != "" {
+		u, err := url.Parse(string(conf.Proxy))
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL")
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+
+	tlsConf := &tls.Config{InsecureSkipVerify: conf.InsecureSkipVerify}
+	if conf.CAFile != "" {
+		pem, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", conf.CAFile)
+		}
+		tlsConf.RootCAs = pool
+	}
+	if conf.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+	tr.TLSClientConfig = tlsConf
+
+	return tr, nil
+}
+
+// Names returns the names of the profiles in match order, for logging.
+func (t *Transport) Names() []string {
+	names := make([]string, len(t.profiles))
+	for i, p := range t.profiles {
+		names[i] = p.conf.Name
+	}
+	return names
+}
+
+func (t *Transport) match(host string) *profile {
+	host = strings.ToLower(host)
+	for i := range t.profiles {
+		for _, pattern := range t.profiles[i].conf.Hosts {
+			if matchHost(strings.ToLower(pattern), host) {
+				return &t.profiles[i]
+			}
+		}
+	}
+	return nil
+}
+
+// matchHost matches host against "example.com", "*.example.com" or "*".
+func matchHost(pattern, host string) bool {
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(host, pattern[1:])
+	default:
+		return host == pattern
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	p := t.match(req.URL.Hostname())
+	if p == nil {
+		return base.RoundTrip(req)
+	}
+
+	// a RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+	if req.URL.Scheme == "https" || p.conf.AllowHTTP {
+		for k, v := range p.conf.Headers {
+			req.Header.Set(k, string(v))
+		}
+		for name, value := range p.conf.Cookies {
+			req.AddCookie(&http.Cookie{Name: name, Value: string(value)})
+		}
+		switch {
+		case p.conf.BearerToken != "":
+			req.Header.Set("Authorization", "Bearer "+string(p.conf.BearerToken))
+		case p.conf.Username != "":
+			req.SetBasicAuth(p.conf.Username, string(p.conf.Password))
+		}
+	}
+
+	if p.transport != nil {
+		return p.transport.RoundTrip(req)
+	}
+	return base.RoundTrip(req)
+}
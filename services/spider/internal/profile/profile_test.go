@@ -0,0 +1,142 @@
+package profile
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/config"
+)
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		host    string
+		want    bool
+	}{
+		{"exact", "wiki.corp.example", "wiki.corp.example", true},
+		{"exact other host", "wiki.corp.example", "docs.corp.example", false},
+		{"exact subdomain", "corp.example", "wiki.corp.example", false},
+		{"wildcard subdomain", "*.corp.example", "wiki.corp.example", true},
+		{"wildcard nested subdomain", "*.corp.example", "a.wiki.corp.example", true},
+		{"wildcard apex", "*.corp.example", "corp.example", false},
+		{"wildcard suffix only", "*.corp.example", "evilcorp.example", false},
+		{"any", "*", "example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchHost(tt.pattern, tt.host); got != tt.want {
+				t.Errorf("matchHost(%q, %q) = %v, want %v", tt.pattern, tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tr, err := NewTransport(nil, []config.FetchProfile{
+		{Name: "wiki", Hosts: []string{"Wiki.Corp.Example"}},
+		{Name: "corp", Hosts: []string{"*.corp.example"}},
+		{Name: "any", Hosts: []string{"*"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"wiki.corp.example", "wiki"},
+		{"WIKI.corp.example", "wiki"},
+		{"docs.corp.example", "corp"},
+		{"example.com", "any"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			p := tr.match(tt.host)
+			if p == nil || p.conf.Name != tt.want {
+				t.Errorf("match(%q) = %v, want %q", tt.host, p, tt.want)
+			}
+		})
+	}
+}
+
+// recorder is a RoundTripper keeping the last request it was given.
+type recorder struct {
+	req *http.Request
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.req = req
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	profiles := []config.FetchProfile{
+		{
+			Name:        "api",
+			Hosts:       []string{"api.example.com"},
+			Headers:     map[string]config.Secret{"X-Tenant": "search"},
+			Cookies:     map[string]config.Secret{"session": "s3cret"},
+			BearerToken: "token",
+		},
+		{
+			Name:     "wiki",
+			Hosts:    []string{"wiki.example.com"},
+			Username: "crawler",
+			Password: "pass",
+		},
+		{
+			Name:        "intranet",
+			Hosts:       []string{"intranet.example.com"},
+			Headers:     map[string]config.Secret{"X-Tenant": "intranet"},
+			BearerToken: "token",
+			AllowHTTP:   true,
+		},
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		header string
+		auth   string
+		cookie string
+	}{
+		{"bearer over https", "https://api.example.com/x", "search", "Bearer token", "session=s3cret"},
+		{"no credentials over http", "http://api.example.com/x", "", "", ""},
+		{"basic auth over https", "https://wiki.example.com/x", "", "Basic Y3Jhd2xlcjpwYXNz", ""},
+		{"no basic auth over http", "http://wiki.example.com/x", "", "", ""},
+		{"http allowed", "http://intranet.example.com/x", "intranet", "Bearer token", ""},
+		{"no profile", "https://example.com/x", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := &recorder{}
+			tr, err := NewTransport(base, profiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			if _, err := tr.RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+
+			sent := base.req.Header
+			if got := sent.Get("X-Tenant"); got != tt.header {
+				t.Errorf("X-Tenant = %q, want %q", got, tt.header)
+			}
+			if got := sent.Get("Authorization"); got != tt.auth {
+				t.Errorf("Authorization = %q, want %q", got, tt.auth)
+			}
+			if got := sent.Get("Cookie"); got != tt.cookie {
+				t.Errorf("Cookie = %q, want %q", got, tt.cookie)
+			}
+			if len(req.Header) != 0 {
+				t.Errorf("caller's request modified: %v", req.Header)
+			}
+		})
+	}
+}
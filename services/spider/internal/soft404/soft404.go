@@ -0,0 +1,187 @@
+// Package soft404 recognizes pages served with 200 OK that are not real
+// content: error pages of sites that never answer 404 ("soft 404s"), login
+// walls shown for any path, and placeholders of parked domains.
+//
+// A site's answer to a path that cannot exist is its soft 404 page; pages
+// close to it are soft 404s too. Pages are compared on their title and a
+// simhash of their text, so a page naming the missing path still matches.
+package soft404
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Reasons a page is left out of the index.
+const (
+	NotFound = "soft_404"
+	Parked   = "parked"
+)
+
+const (
+	shingleSize = 3 // words hashed together by Sign
+
+	// maxWords is the length of text beyond which a page is not taken for
+	// an error page or a parking placeholder on its wording alone.
+	maxWords = 300
+)
+
+// Signature sums up a page for comparison with the soft 404 page of its
+// host.
+type Signature struct {
+	Title string // lowercased, whitespace collapsed
+	Hash  uint64 // simhash of the text, 0 for pages without text
+}
+
+// Sign returns the signature of a page. Words holding a slash are left
+// out: error pages often repeat the path that was not found.
+func Sign(title, text string) Signature {
+	words := strings.Fields(strings.ToLower(text))
+	words = slices.DeleteFunc(words, func(w string) bool { return strings.Contains(w, "/") })
+	return Signature{
+		Title: strings.Join(strings.Fields(strings.ToLower(title)), " "),
+		Hash:  simhash(words),
+	}
+}
+
+// Similar reports whether a and b look like the same page. Their texts may
+// differ in up to maxDistance bits of their simhash, twice as many when
+// their titles are the same. Pages without text are never similar.
+func Similar(a, b Signature, maxDistance int) bool {
+	if a.Hash == 0 || b.Hash == 0 {
+		return false
+	}
+	d := bits.OnesCount64(a.Hash ^ b.Hash)
+	if a.Title != "" && a.Title == b.Title {
+		return d <= 2*maxDistance
+	}
+	return d <= maxDistance
+}
+
+// simhash returns the 64-bit simhash of the word shingles of words.
+func simhash(words []string) uint64 {
+	if len(words) == 0 {
+		return 0
+	}
+
+	var votes [64]int
+	n := max(1, len(words)-shingleSize+1)
+	for i := range n {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:min(i+shingleSize, len(words))], " ")))
+		sum := h.Sum64()
+		for b := range votes {
+			if sum&(1<<b) != 0 {
+				votes[b]++
+			} else {
+				votes[b]--
+			}
+		}
+	}
+
+	var hash uint64
+	for b, v := range votes {
+		if v > 0 {
+			hash |= 1 << b
+		}
+	}
+	if hash == 0 {
+		hash = 1 // 0 means no text
+	}
+	return hash
+}
+
+// notFoundTitle matches the titles of error pages, in the languages the
+// spider identifies most often.
+var notFoundTitle = regexp.MustCompile(`(?i)^(error )?404\b|\b404 (error|not found)\b|` +
+	`\b(page|file|article|content) (was )?not found\b|^not found$|` +
+	`page (introuvable|non trouvée)|seite nicht gefunden|página no encontrada|` +
+	`pagina non trovata|página não encontrada|pagina niet gevonden|страница не найдена`)
+
+// IsNotFound reports whether a short page is titled as an error page.
+func IsNotFound(title, text string) bool {
+	return notFoundTitle.MatchString(title) && len(strings.Fields(text)) <= maxWords
+}
+
+// parkingPhrases are the wording of domain parking and for-sale pages.
+var parkingPhrases = []string{
+	"this domain is for sale",
+	"this domain may be for sale",
+	"this domain name is for sale",
+	"the domain name is for sale",
+	"buy this domain",
+	"this domain is parked",
+	"domain parked",
+	"parked free, courtesy of",
+	"this web page is parked",
+	"this page is parked free",
+	"make an offer on this domain",
+	"the owner of this domain has not yet uploaded",
+	"this domain has recently been registered",
+	"this domain has been registered",
+}
+
+// parkingService is a domain parking or marketplace service, recognized
+// by a script or frame a placeholder page loads from it.
+type parkingService struct {
+	host string // the service's domain, subdomains included
+	path string // prefix of the path loaded, empty for any
+}
+
+var parkingServices = []parkingService{
+	{host: "sedoparking.com"},
+	{host: "parkingcrew.net"},
+	{host: "bodis.com"},
+	{host: "above.com"},
+	{host: "parklogic.com"},
+	{host: "dan.com"},
+	{host: "afternic.com"},
+	{host: "hugedomains.com"},
+	{host: "undeveloped.com"},
+	{host: "domainmarket.com"},
+	{host: "parking.reg.ru"},
+	{host: "google.com", path: "/adsense/domains/"}, // AdSense for domains
+}
+
+// IsParked reports whether a short page is the placeholder of a parked or
+// for-sale domain, from its wording or from a parking service among the
+// URLs of the scripts and frames it loads.
+func IsParked(text string, embeds []string) bool {
+	if len(strings.Fields(text)) > maxWords {
+		return false
+	}
+
+	lower := strings.ToLower(text)
+	for _, p := range parkingPhrases {
+		if strings.Contains(lower, p) {
+			return true
+		}
+	}
+	for _, e := range embeds {
+		if isParkingService(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func isParkingService(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, ps := range parkingServices {
+		if host != ps.host && !strings.HasSuffix(host, "."+ps.host) {
+			continue
+		}
+		if strings.HasPrefix(u.Path, ps.path) {
+			return true
+		}
+	}
+	return false
+}
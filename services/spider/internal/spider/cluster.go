@@ -0,0 +1,142 @@
+package spider
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/store"
+)
+
+// coordinator registers the instance in Redis and keeps it leasing its fair
+// share of frontier partitions. Partitions held by an instance that stops
+// heartbeating expire after the lease TTL and are picked up by the others.
+type coordinator struct {
+	cache    store.Cache
+	id       string
+	interval time.Duration
+	ttl      time.Duration
+	log      *slog.Logger
+
+	mu    sync.RWMutex
+	owned []int
+}
+
+func newCoordinator(cache store.Cache, id string, interval, ttl time.Duration, log *slog.Logger) *coordinator {
+	return &coordinator{
+		cache:    cache,
+		id:       id,
+		interval: interval,
+		ttl:      ttl,
+		log:      log.With("component", "cluster", "instance", id),
+	}
+}
+
+// Owned returns the partitions currently leased by this instance.
+func (c *coordinator) Owned() []int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Clone(c.owned)
+}
+
+// Run heartbeats and rebalances until ctx is done, then releases every
+// partition so other instances can take over without waiting for the TTL.
+func (c *coordinator) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.leave()
+			return
+		case <-ticker.C:
+			c.rebalance(ctx)
+		}
+	}
+}
+
+func (c *coordinator) rebalance(ctx context.Context) {
+	live, err := c.cache.Heartbeat(ctx, c.id, c.ttl)
+	if err != nil {
+		c.log.Warn("heartbeat failed", "error", err)
+		return
+	}
+	if live < 1 {
+		live = 1
+	}
+
+	total := c.cache.Partitions()
+	target := (total + int(live) - 1) / int(live)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// keep the leases we still hold
+	kept := c.owned[:0]
+	for _, p := range c.owned {
+		ok, err := c.cache.RenewPartition(ctx, p, c.id, c.ttl)
+		if err != nil {
+			c.log.Warn("renew partition", "partition", p, "error", err)
+		}
+		if ok {
+			kept = append(kept, p)
+		} else {
+			c.log.Warn("Lost partition lease", "partition", p)
+		}
+	}
+	c.owned = kept
+
+	// hand back surplus partitions when new instances joined
+	for len(c.owned) > target {
+		last := len(c.owned) - 1
+		if err := c.cache.ReleasePartition(ctx, c.owned[last], c.id); err != nil {
+			c.log.Warn("release partition", "partition", c.owned[last], "error", err)
+		}
+		c.owned = c.owned[:last]
+	}
+
+	// pick up free partitions, starting at a random offset so instances
+	// don't all race for the same ones
+	start := rand.IntN(total)
+	for i := 0; i < total && len(c.owned) < target; i++ {
+		p := (start + i) % total
+		if slices.Contains(c.owned, p) {
+			continue
+		}
+		ok, err := c.cache.AcquirePartition(ctx, p, c.id, c.ttl)
+		if err != nil {
+			c.log.Warn("acquire partition", "partition", p, "error", err)
+			continue
+		}
+		if ok {
+			c.owned = append(c.owned, p)
+		}
+	}
+
+	c.log.Debug("Rebalanced partitions",
+		"live_instances", live, "target", target, "owned", len(c.owned))
+}
+
+func (c *coordinator) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, p := range c.owned {
+		if err := c.cache.ReleasePartition(ctx, p, c.id); err != nil {
+			c.log.Warn("release partition", "partition", p, "error", err)
+		}
+	}
+	c.owned = nil
+
+	if err := c.cache.Deregister(ctx, c.id); err != nil {
+		c.log.Warn("deregister instance", "error", err)
+	}
+	c.log.Info("Left cluster")
+}
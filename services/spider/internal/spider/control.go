@@ -0,0 +1,304 @@
+package spider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/admin"
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+	"github.com/Hassan-ach/boogle/services/spider/internal/store"
+	"github.com/Hassan-ach/boogle/services/spider/internal/trap"
+	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
+)
+
+// maxHostErrors is how many recent fetch errors are kept per host.
+const maxHostErrors = 20
+
+// hostErrorLog keeps the most recent fetch errors of each host in memory
+// for the admin API.
+type hostErrorLog struct {
+	mu     sync.Mutex
+	byHost map[string][]admin.HostError
+}
+
+func newHostErrorLog() *hostErrorLog {
+	return &hostErrorLog{byHost: map[string][]admin.HostError{}}
+}
+
+func (l *hostErrorLog) Add(host, u string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	errs := append(l.byHost[host], admin.HostError{
+		Time:  time.Now(),
+		URL:   u,
+		Error: err.Error(),
+	})
+	if len(errs) > maxHostErrors {
+		errs = errs[len(errs)-maxHostErrors:]
+	}
+	l.byHost[host] = errs
+}
+
+func (l *hostErrorLog) Get(host string) []admin.HostError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]admin.HostError{}, l.byHost[host]...)
+}
+
+// Pause stops crawlers from picking new URLs. In-flight fetches finish and
+// the frontier is left untouched.
+func (s *Spider) Pause() {
+	s.paused.Store(true)
+}
+
+func (s *Spider) Resume() {
+	s.paused.Store(false)
+}
+
+func (s *Spider) Status(ctx context.Context) admin.Status {
+	status := admin.Status{
+		InstanceID:         s.config.App.InstanceID,
+		Paused:             s.paused.Load(),
+		MaxCrawlers:        s.config.App.MaxCrawlers,
+		MaxConcurrentFetch: s.fetchpool.Limit(),
+		FetchesInFlight:    s.fetchpool.InUse(),
+		Jobs:               []admin.JobStatus{},
+	}
+	for _, j := range s.runningJobs() {
+		js := s.jobStatus(ctx, j)
+		status.FrontierSize += js.FrontierSize
+		status.VisitedCount += js.VisitedCount
+		status.Jobs = append(status.Jobs, js)
+	}
+	return status
+}
+
+func (s *Spider) jobStatus(ctx context.Context, j *job) admin.JobStatus {
+	j.mu.Lock()
+	crawlers := len(j.crawlers)
+	j.mu.Unlock()
+
+	spec := *j.spec
+	spec.PagesCrawled = j.pages.Load()
+	if j.paused.Load() {
+		spec.Status = entity.JobPaused
+	} else {
+		spec.Status = entity.JobRunning
+	}
+
+	cache := j.store.GetCache()
+	return admin.JobStatus{
+		Job:          &spec,
+		Running:      true,
+		Partitions:   j.cluster.Owned(),
+		Crawlers:     crawlers,
+		FrontierSize: cache.CountUrls(ctx),
+		VisitedCount: cache.CountVisited(ctx),
+	}
+}
+
+// SetMaxCrawlers resizes the crawler pool of every job that does not set
+// its own.
+func (s *Spider) SetMaxCrawlers(n int) error {
+	if n < 1 {
+		return fmt.Errorf("max crawlers must be at least 1, got %d", n)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx.Err() != nil {
+		return fmt.Errorf("spider is stopping")
+	}
+	s.config.App.MaxCrawlers = n
+	for _, j := range s.jobs {
+		s.resizeCrawlers(j, s.jobCrawlers(j.spec))
+	}
+	return nil
+}
+
+func (s *Spider) SetMaxConcurrentFetch(n int) error {
+	if n < 1 {
+		return fmt.Errorf("max concurrent fetch must be at least 1, got %d", n)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.config.App.MaxConcurrentFetch = n
+	s.fetchpool.SetLimit(n)
+	return nil
+}
+
+// AddSeeds normalizes the given URLs and pushes the valid ones into the
+// frontier of the named job, the default job if name is empty. It returns
+// how many were accepted.
+func (s *Spider) AddSeeds(ctx context.Context, name string, urls []string) (int, error) {
+	st, err := s.jobStore(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	seeds := utils.NewSetFromSlice(utils.NormalizeUrls(urls, "")).GetAll()
+	if err := st.AddSeeds(ctx, seeds); err != nil {
+		return 0, fmt.Errorf("add seeds: %w", err)
+	}
+	return len(seeds), nil
+}
+
+// jobStore returns the store of an unfinished job, whether or not it runs
+// in this instance yet.
+func (s *Spider) jobStore(ctx context.Context, name string) (*store.Store, error) {
+	if j, ok := s.getJob(name); ok {
+		return j.store, nil
+	}
+	if name == "" {
+		name = defaultJobName
+	}
+
+	spec, ok, err := s.store.GetDB().GetJob(ctx, name)
+	switch {
+	case err != nil:
+		return nil, err
+	case !ok:
+		return nil, fmt.Errorf("%w: %s", store.ErrJobNotFound, name)
+	case spec.Status.Finished():
+		return nil, fmt.Errorf("%w: %s", store.ErrJobFinished, name)
+	}
+	return s.store.Namespace(spec.Namespace, scopeMatcher(spec.Scope))
+}
+
+func (s *Spider) HostInfo(ctx context.Context, h string) (*admin.HostInfo, bool, error) {
+	host, ok, err := s.store.GetHostMetaData(ctx, h)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var queued int64
+	for _, j := range s.runningJobs() {
+		n, err := j.store.GetCache().CountHostUrls(ctx, h)
+		if err != nil {
+			return nil, false, err
+		}
+		queued += n
+	}
+
+	feeds, err := s.store.GetDB().HostFeeds(ctx, h)
+	if err != nil {
+		return nil, false, err
+	}
+
+	stats, hasStats, err := s.store.GetDB().HostStats(ctx, h)
+	if err != nil {
+		return nil, false, err
+	}
+
+	errs := s.hostErrors.Get(h)
+	if !ok && !hasStats && queued == 0 && len(errs) == 0 && len(feeds) == 0 {
+		return nil, false, nil
+	}
+
+	return &admin.HostInfo{
+		Host:         host,
+		QueueSize:    queued,
+		RecentErrors: errs,
+		Feeds:        feeds,
+		Stats:        stats,
+	}, true, nil
+}
+
+// TopHosts returns the statistics of the hosts ranking first by order.
+func (s *Spider) TopHosts(ctx context.Context, order string, limit int) ([]store.HostStats, error) {
+	return s.store.GetDB().TopHosts(ctx, order, limit)
+}
+
+// PurgeHost removes the host's URLs from the frontier of every job running
+// in this instance.
+func (s *Spider) PurgeHost(ctx context.Context, h string) (int64, error) {
+	var removed int64
+	for _, j := range s.runningJobs() {
+		n, err := j.store.GetCache().PurgeHost(ctx, h)
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+func (s *Spider) Traps() []trap.Report {
+	return s.traps.Reports()
+}
+
+// Jobs lists every crawl job, with live figures for those running here.
+func (s *Spider) Jobs(ctx context.Context) ([]admin.JobStatus, error) {
+	specs, err := s.store.GetDB().ListJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]admin.JobStatus, len(specs))
+	for i, spec := range specs {
+		if j, ok := s.getJob(spec.Name); ok {
+			jobs[i] = s.jobStatus(ctx, j)
+			jobs[i].Job.CreatedAt = spec.CreatedAt
+			jobs[i].Job.StartedAt = spec.StartedAt
+			continue
+		}
+		jobs[i] = admin.JobStatus{Job: spec}
+	}
+	return jobs, nil
+}
+
+// CreateJob validates and registers a new job, then starts it. Other
+// instances pick it up on their next poll.
+func (s *Spider) CreateJob(ctx context.Context, j *entity.Job) error {
+	if err := NormalizeJob(j); err != nil {
+		return err
+	}
+	if err := s.store.GetDB().CreateJob(ctx, j); err != nil {
+		return err
+	}
+	if _, err := s.startJob(ctx, j); err != nil {
+		s.logger.Warn("Failed to start crawl job, will retry on next poll",
+			"component", "jobs", "job", j.Name, "error", err)
+	}
+	return nil
+}
+
+// PauseJob stops the job's crawlers from picking new URLs in every
+// instance. Its frontier and budgets are kept.
+func (s *Spider) PauseJob(ctx context.Context, name string) error {
+	if err := s.store.GetDB().SetJobStatus(ctx, name, entity.JobPaused, ""); err != nil {
+		return err
+	}
+	if j, ok := s.getJob(name); ok {
+		j.paused.Store(true)
+	}
+	return nil
+}
+
+func (s *Spider) ResumeJob(ctx context.Context, name string) error {
+	if err := s.store.GetDB().SetJobStatus(ctx, name, entity.JobRunning, ""); err != nil {
+		return err
+	}
+	if j, ok := s.getJob(name); ok {
+		j.paused.Store(false)
+	}
+	return nil
+}
+
+// CancelJob finishes the job for good. Its Redis keys are left in place.
+func (s *Spider) CancelJob(ctx context.Context, name string) error {
+	if err := s.store.GetDB().SetJobStatus(ctx, name, entity.JobCancelled, ""); err != nil {
+		return err
+	}
+	if j, ok := s.getJob(name); ok {
+		s.stopJob(j)
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+	"github.com/Hassan-ach/boogle/services/spider/internal/feed"
+	"github.com/Hassan-ach/boogle/services/spider/internal/metrics"
+	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
+)
+
+// feedFetchTimeout bounds a single feed fetch, redirects included.
+const feedFetchTimeout = 30 * time.Second
+
+// feedLease is how long a claimed feed is hidden from other instances
+// while it is polled.
+const feedLease = 5 * time.Minute
+
+// discoverFeeds registers the feeds announced by a page of the job. Each
+// feed is sent to Postgres once per job and process.
+func (s *Spider) discoverFeeds(ctx context.Context, j *job, urls []string) {
+	var feeds []*entity.Feed
+	for _, raw := range urls {
+		if _, seen := j.feeds.LoadOrStore(raw, true); seen {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			continue
+		}
+		feeds = append(feeds, s.newFeed(j, u, false))
+	}
+	s.addFeeds(ctx, j, feeds)
+}
+
+// probeFeeds registers the common feed paths of a new host as probes,
+// dropped on their first poll unless they turn out to be feeds.
+func (s *Spider) probeFeeds(ctx context.Context, j *job, u *url.URL) {
+	feeds := make([]*entity.Feed, 0, len(s.config.Feed.ProbePaths))
+	for _, p := range s.config.Feed.ProbePaths {
+		feeds = append(feeds, s.newFeed(j, &url.URL{Scheme: u.Scheme, Host: u.Host, Path: p}, true))
+	}
+	s.addFeeds(ctx, j, feeds)
+}
+
+func (s *Spider) newFeed(j *job, u *url.URL, probe bool) *entity.Feed {
+	return &entity.Feed{
+		Job:      j.name,
+		URL:      u.String(),
+		Host:     u.Host,
+		Probe:    probe,
+		Interval: s.config.Feed.MinInterval,
+	}
+}
+
+func (s *Spider) addFeeds(ctx context.Context, j *job, feeds []*entity.Feed) {
+	if s.config.Feed.PollInterval <= 0 || len(feeds) == 0 {
+		return
+	}
+	if err := s.store.GetDB().AddFeeds(ctx, feeds); err != nil {
+		j.log.Warn("Failed to register feeds", "component", "feeds", "error", err)
+	}
+}
+
+// runFeeds polls the due feeds of the jobs running here until ctx is done.
+func (s *Spider) runFeeds(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Feed.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !s.paused.Load() {
+				s.pollFeeds(ctx)
+			}
+		}
+	}
+}
+
+// pollFeeds claims a batch of due feeds and polls them concurrently,
+// within the fetch pool.
+func (s *Spider) pollFeeds(ctx context.Context) {
+	logger := s.logger.With("component", "feeds")
+
+	jobs := map[string]*job{}
+	for _, j := range s.runningJobs() {
+		if !j.paused.Load() {
+			jobs[j.name] = j
+		}
+	}
+	if len(jobs) == 0 {
+		return
+	}
+	names := make([]string, 0, len(jobs))
+	for name := range jobs {
+		names = append(names, name)
+	}
+
+	feeds, err := s.store.GetDB().ClaimFeeds(ctx, names, s.config.Feed.BatchSize, feedLease)
+	if err != nil {
+		logger.Warn("Failed to claim due feeds", "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, f := range feeds {
+		j, ok := jobs[f.Job]
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.pollFeed(j, f)
+		}()
+	}
+	wg.Wait()
+}
+
+// pollFeed fetches a feed, queues its new items and schedules the next
+// poll: sooner when there were new items, later when there were none.
+// Probes that are not feeds are deleted.
+func (s *Spider) pollFeed(j *job, f *entity.Feed) {
+	ctx, cancel := context.WithTimeout(j.ctx, s.crawlerTimeout)
+	defer cancel()
+	logger := j.log.With("component", "feeds", "feed", f.URL)
+
+	if err := s.fetchpool.Acquire(ctx); err != nil {
+		s.rescheduleFeed(ctx, f, f.Interval, err)
+		return
+	}
+	defer s.fetchpool.Release()
+
+	items, err := s.fetchFeed(ctx, j, f)
+	var busy *hostBusyError
+	if errors.As(err, &busy) {
+		// not a failure: poll again once the host's crawl delay expires
+		f.NextPollAt = time.Now().Add(busy.wait)
+		s.updateFeed(ctx, f)
+		return
+	}
+	f.LastPolledAt = time.Now()
+
+	if err != nil {
+		if f.Probe {
+			if err := s.store.GetDB().DeleteFeed(ctx, f.Job, f.URL); err != nil {
+				logger.Warn("Failed to drop probed feed path", "error", err)
+			}
+			return
+		}
+		metrics.FeedPolls.WithLabelValues("error").Inc()
+		logger.Warn("Failed to poll feed", "error", err)
+		f.ErrorCount++
+		s.rescheduleFeed(ctx, f, 2*f.Interval, err)
+		return
+	}
+	if f.Probe {
+		f.Probe = false
+		logger.Info("Feed found at a common path")
+	}
+
+	fresh := newFeedItems(items, f.SeenItems, f.LastItemAt)
+	for _, it := range items {
+		if it.Published.After(f.LastItemAt) {
+			f.LastItemAt = it.Published
+		}
+	}
+	if len(items) > 0 {
+		f.SeenItems = feedItemKeys(items)
+	}
+
+	interval := f.Interval * 3 / 2
+	if len(fresh) > 0 {
+		interval = f.Interval / 2
+		if err := j.store.AddFeedItems(ctx, fresh, s.config.Feed.Weight); err != nil {
+			logger.Warn("Failed to queue feed items", "error", err)
+		}
+		f.ItemsFound += int64(len(fresh))
+		metrics.FeedPolls.WithLabelValues("new_items").Inc()
+		metrics.FeedItems.Add(float64(len(fresh)))
+		logger.Info("Queued new feed items", "items", len(fresh))
+	} else {
+		metrics.FeedPolls.WithLabelValues("no_change").Inc()
+	}
+	f.ErrorCount = 0
+	s.rescheduleFeed(ctx, f, interval, nil)
+}
+
+// maxSeenItems bounds the item keys remembered per feed.
+const maxSeenItems = 1000
+
+// newFeedItems returns the items that were not in the previous poll, seen,
+// or every item when the feed was never polled. Unseen items with a date
+// must also be newer than since, the newest date of earlier polls, so old
+// items that come back into the feed are not queued again. Items already
+// crawled are left out by the frontier.
+func newFeedItems(items []entity.FeedItem, seen []string, since time.Time) []entity.FeedItem {
+	if since.IsZero() && len(seen) == 0 {
+		return items
+	}
+	known := make(map[string]bool, len(seen))
+	for _, k := range seen {
+		known[k] = true
+	}
+	var fresh []entity.FeedItem
+	for _, it := range items {
+		if known[it.Key()] {
+			continue
+		}
+		if it.Published.IsZero() || it.Published.After(since) {
+			fresh = append(fresh, it)
+		}
+	}
+	return fresh
+}
+
+// feedItemKeys returns the keys of the first maxSeenItems items.
+func feedItemKeys(items []entity.FeedItem) []string {
+	keys := make([]string, 0, min(len(items), maxSeenItems))
+	for _, it := range items[:min(len(items), maxSeenItems)] {
+		keys = append(keys, it.Key())
+	}
+	return keys
+}
+
+// rescheduleFeed stores the outcome of a poll, with the next one after
+// interval bounded by FEED_MIN_INTERVAL and FEED_MAX_INTERVAL.
+func (s *Spider) rescheduleFeed(ctx context.Context, f *entity.Feed, interval time.Duration, pollErr error) {
+	f.Interval = min(max(interval, s.config.Feed.MinInterval), s.config.Feed.MaxInterval)
+	f.NextPollAt = time.Now().Add(f.Interval)
+	f.LastError = ""
+	if pollErr != nil {
+		f.LastError = pollErr.Error()
+	}
+	s.updateFeed(ctx, f)
+}
+
+// updateFeed stores f, even when ctx has expired.
+func (s *Spider) updateFeed(ctx context.Context, f *entity.Feed) {
+	// the poll context may be the one that expired
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := s.store.GetDB().UpdateFeed(ctx, f); err != nil {
+		s.logger.Warn("Failed to update feed", "component", "feeds", "feed", f.URL, "error", err)
+	}
+}
+
+// fetchFeed fetches and parses a feed, honoring robots.txt and the host's
+// crawl delay: a host still within it yields a *hostBusyError. A 304 Not
+// Modified yields no items.
+func (s *Spider) fetchFeed(ctx context.Context, j *job, f *entity.Feed) ([]entity.FeedItem, error) {
+	u, err := url.Parse(f.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := s.robotsFor(ctx, u)
+	host, ok, err := s.store.GetHostMetaData(ctx, u.Host)
+	if err != nil || !ok {
+		host = s.newHostMetaData(ctx, j, u, rules)
+	} else {
+		host.ApplyRobots(rules)
+	}
+	if host.DisallowAll || utils.IsDisallowed(u.Path, host.NotAllowedPaths) {
+		return nil, fmt.Errorf("disallowed by robots.txt")
+	}
+	if err := s.claimHost(ctx, host, "feed"); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := s.store.GetCache().AddToWaitedHost(ctx, host.Name, host.Delay); err != nil {
+			s.logger.Warn("Failed to add host to waited set", "component", "feeds", "host", host.Name, "error", err)
+		}
+	}()
+
+	fetchCtx, cancel := context.WithTimeout(ctx, feedFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(fetchCtx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create feed request: %w", err)
+	}
+	req.Header.Set("User-Agent", utils.UserAgent)
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/feed+json, application/xml;q=0.9, */*;q=0.1")
+	if f.ETag != "" {
+		req.Header.Set("If-None-Match", f.ETag)
+	}
+	if f.LastModified != "" {
+		req.Header.Set("If-Modified-Since", f.LastModified)
+	}
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("get feed: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("get feed: status %d", res.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, s.config.Feed.MaxSize))
+	if err != nil {
+		return nil, fmt.Errorf("read feed: %w", err)
+	}
+	parsed, err := feed.Parse(body, res.Request.URL)
+	if err != nil {
+		return nil, err
+	}
+	items := parsed[:0]
+	for _, it := range parsed {
+		if link, ok := utils.NormalizeUrl(it.URL, ""); ok {
+			it.URL = link
+			items = append(items, it)
+		}
+	}
+
+	f.ETag = res.Header.Get("ETag")
+	f.LastModified = res.Header.Get("Last-Modified")
+	return items, nil
+}
@@ -0,0 +1,364 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+	"github.com/Hassan-ach/boogle/services/spider/internal/store"
+	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
+)
+
+// defaultJobName is the job crawling the spider's start URLs. It uses the
+// unprefixed Redis keys, so a frontier built before crawl jobs existed is
+// picked up where it stopped.
+const defaultJobName = "default"
+
+// jobIdlePolls is how many job polls in a row a job's frontier must be
+// empty, with no page in flight, before the job completes.
+const jobIdlePolls = 3
+
+var jobNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// job is a crawl job running in this process: its own crawlers, frontier
+// partitions and namespaced store. The fetch pool, parser and batch writer
+// are shared with the other jobs.
+type job struct {
+	name      string
+	spec      *entity.Job
+	store     *store.Store
+	cluster   *coordinator
+	ctx       context.Context
+	cancel    context.CancelFunc
+	startedAt time.Time
+	log       *slog.Logger
+
+	// crawlers holds the cancel func of each running crawler goroutine,
+	// so the pool can be resized at runtime.
+	mu       sync.Mutex
+	crawlers []context.CancelFunc
+
+	// feeds holds the feed URLs already registered by this process
+	feeds sync.Map
+
+	paused   atomic.Bool
+	pages    atomic.Int64 // pages crawled by every instance, as last seen
+	inFlight atomic.Int64
+	idle     int // consecutive idle polls, only touched by syncJobs
+}
+
+// exhausted returns the budget the job used up, "page_budget" or
+// "time_limit", or "" while it may go on.
+func (j *job) exhausted(now time.Time) string {
+	switch {
+	case j.spec.MaxPages > 0 && j.pages.Load() >= j.spec.MaxPages:
+		return "page_budget"
+	case j.spec.TimeLimit > 0 && now.Sub(j.startedAt) >= j.spec.TimeLimit:
+		return "time_limit"
+	default:
+		return ""
+	}
+}
+
+// scopeMatcher returns a func reporting whether a URL matches one of the
+// scope entries: a host, which also matches its subdomains, or a URL
+// prefix. An empty scope matches every URL.
+func scopeMatcher(scope []string) func(u string) bool {
+	if len(scope) == 0 {
+		return nil
+	}
+
+	var hosts, prefixes []string
+	for _, s := range scope {
+		if strings.Contains(s, "://") {
+			prefixes = append(prefixes, s)
+		} else {
+			hosts = append(hosts, s)
+		}
+	}
+
+	return func(raw string) bool {
+		for _, p := range prefixes {
+			if strings.HasPrefix(raw, p) {
+				return true
+			}
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			return false
+		}
+		h := u.Hostname()
+		for _, s := range hosts {
+			if h == s || strings.HasSuffix(h, "."+s) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// normalizeScope lowercases hosts and drops "www.", as URL canonicalization
+// does, so scope entries compare equal to queued URLs.
+func normalizeScope(scope []string) ([]string, error) {
+	out := make([]string, 0, len(scope))
+	for _, s := range scope {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "://") {
+			out = append(out, strings.TrimPrefix(strings.ToLower(s), "www."))
+			continue
+		}
+
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid scope prefix %q", s)
+		}
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+		out = append(out, u.String())
+	}
+	return out, nil
+}
+
+// NormalizeJob validates a new job, canonicalizes its seeds and scope and
+// sets its defaults. Errors wrap store.ErrInvalidJob.
+func NormalizeJob(j *entity.Job) error {
+	if !jobNameRe.MatchString(j.Name) {
+		return fmt.Errorf("%w: name must match %s", store.ErrInvalidJob, jobNameRe)
+	}
+	if j.Namespace == "" {
+		j.Namespace = j.Name
+	}
+	if !jobNameRe.MatchString(j.Namespace) {
+		return fmt.Errorf("%w: namespace must match %s", store.ErrInvalidJob, jobNameRe)
+	}
+	if j.MaxPages < 0 || j.TimeLimit < 0 || j.Crawlers < 0 {
+		return fmt.Errorf("%w: budgets and crawlers cannot be negative", store.ErrInvalidJob)
+	}
+
+	j.Seeds = utils.NewSetFromSlice(utils.NormalizeUrls(j.Seeds, "")).GetAll()
+	if len(j.Seeds) == 0 {
+		return fmt.Errorf("%w: no valid seed URL", store.ErrInvalidJob)
+	}
+	scope, err := normalizeScope(j.Scope)
+	if err != nil {
+		return fmt.Errorf("%w: %w", store.ErrInvalidJob, err)
+	}
+	j.Scope = scope
+	j.Status = entity.JobRunning
+	return nil
+}
+
+// ensureDefaultJob registers the default job with the start URLs, unless
+// it was created, or finished, before.
+func (s *Spider) ensureDefaultJob(ctx context.Context, startUrls []string) error {
+	return s.store.GetDB().EnsureJob(ctx, &entity.Job{
+		Name:  defaultJobName,
+		Seeds: utils.NewSetFromSlice(utils.NormalizeUrls(startUrls, "")).GetAll(),
+	})
+}
+
+// runJobs starts the jobs registered in Postgres and keeps this process in
+// line with their status until ctx is done, so jobs created, paused or
+// cancelled from another instance or the CLI are picked up.
+func (s *Spider) runJobs(ctx context.Context) {
+	ticker := time.NewTicker(s.config.App.JobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.syncJobs(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Spider) syncJobs(ctx context.Context) {
+	logger := s.logger.With("component", "jobs")
+
+	specs, err := s.store.GetDB().ListJobs(ctx, entity.JobRunning, entity.JobPaused)
+	if err != nil {
+		logger.Warn("Failed to list crawl jobs", "error", err)
+		return
+	}
+
+	active := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		active[spec.Name] = true
+
+		s.mu.Lock()
+		j, ok := s.jobs[spec.Name]
+		s.mu.Unlock()
+		if !ok {
+			if j, err = s.startJob(ctx, spec); err != nil {
+				logger.Error("Failed to start crawl job", "job", spec.Name, "error", err)
+				continue
+			}
+		}
+		j.paused.Store(spec.Status == entity.JobPaused)
+		s.checkJob(ctx, j)
+	}
+
+	// jobs finished by another instance or the CLI
+	s.mu.Lock()
+	var gone []*job
+	for name, j := range s.jobs {
+		if !active[name] {
+			gone = append(gone, j)
+		}
+	}
+	s.mu.Unlock()
+	for _, j := range gone {
+		s.stopJob(j)
+		j.log.Info("Crawl job stopped")
+	}
+}
+
+// checkJob publishes the job's progress and completes it once its budgets
+// are used up or, except for the default job, its frontier stays empty.
+func (s *Spider) checkJob(ctx context.Context, j *job) {
+	pages, err := j.store.GetCache().CountPages(ctx)
+	if err != nil {
+		j.log.Warn("Failed to count crawled pages", "error", err)
+		return
+	}
+	j.pages.Store(pages)
+	if err := s.store.GetDB().SetJobProgress(ctx, j.name, pages); err != nil {
+		j.log.Warn("Failed to record job progress", "error", err)
+	}
+
+	reason := j.exhausted(time.Now())
+	if reason == "" && j.name != defaultJobName && !j.paused.Load() {
+		if j.store.GetCache().CountUrls(ctx) == 0 && j.inFlight.Load() == 0 && j.store.PendingWrites() == 0 {
+			j.idle++
+		} else {
+			j.idle = 0
+		}
+		if j.idle >= jobIdlePolls {
+			reason = "frontier_empty"
+		}
+	}
+	if reason == "" {
+		return
+	}
+
+	err = s.store.GetDB().SetJobStatus(ctx, j.name, entity.JobCompleted, reason)
+	if err != nil && !errors.Is(err, store.ErrJobFinished) {
+		j.log.Warn("Failed to complete crawl job", "error", err)
+		return
+	}
+	s.stopJob(j)
+	j.log.Info("Crawl job completed", "reason", reason, "pages", pages)
+}
+
+// startJob seeds the job's frontier if it is empty, leases its partitions
+// and starts its crawlers.
+func (s *Spider) startJob(ctx context.Context, spec *entity.Job) (*job, error) {
+	st, err := s.store.Namespace(spec.Namespace, scopeMatcher(spec.Scope))
+	if err != nil {
+		return nil, err
+	}
+	if err := st.SeedIfEmpty(ctx, spec.Seeds); err != nil {
+		return nil, fmt.Errorf("seed frontier: %w", err)
+	}
+	startedAt, err := s.store.GetDB().StartJob(ctx, spec.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx.Err() != nil {
+		return nil, fmt.Errorf("spider is stopping")
+	}
+	if j, ok := s.jobs[spec.Name]; ok {
+		return j, nil
+	}
+
+	jobCtx, cancel := context.WithCancel(s.ctx)
+	j := &job{
+		name:      spec.Name,
+		spec:      spec,
+		store:     st,
+		ctx:       jobCtx,
+		cancel:    cancel,
+		startedAt: startedAt,
+		log:       s.logger.With("component", "jobs", "job", spec.Name),
+		cluster: newCoordinator(
+			st.GetCache(),
+			s.config.App.InstanceID,
+			s.config.App.HeartbeatInterval,
+			s.config.App.LeaseTTL,
+			s.logger.With("job", spec.Name),
+		),
+	}
+	j.paused.Store(spec.Status == entity.JobPaused)
+
+	// lease partitions before crawlers start asking for URLs
+	j.cluster.rebalance(jobCtx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		j.cluster.Run(jobCtx)
+	}()
+
+	s.resizeCrawlers(j, s.jobCrawlers(spec))
+	s.jobs[spec.Name] = j
+
+	j.log.Info("Crawl job started",
+		"namespace", spec.Namespace, "seeds", len(spec.Seeds), "scope", spec.Scope,
+		"max_pages", spec.MaxPages, "time_limit", spec.TimeLimit, "status", spec.Status)
+	return j, nil
+}
+
+// stopJob cancels the job's crawlers and releases its partitions.
+func (s *Spider) stopJob(j *job) {
+	s.mu.Lock()
+	delete(s.jobs, j.name)
+	s.mu.Unlock()
+
+	j.cancel()
+}
+
+func (s *Spider) jobCrawlers(spec *entity.Job) int {
+	if spec.Crawlers > 0 {
+		return spec.Crawlers
+	}
+	return s.config.App.MaxCrawlers
+}
+
+func (s *Spider) getJob(name string) (*job, bool) {
+	if name == "" {
+		name = defaultJobName
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[name]
+	return j, ok
+}
+
+// runningJobs returns the jobs running in this process.
+func (s *Spider) runningJobs() []*job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]*job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	return jobs
+}
@@ -0,0 +1,84 @@
+package spider
+
+import (
+	"net/url"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+	"github.com/Hassan-ach/boogle/services/spider/internal/lang"
+	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
+)
+
+// normalizeLanguages returns the LANGUAGES tags in canonical form, leaving
+// out invalid ones.
+func normalizeLanguages(tags []string, logger *utils.Logger) []string {
+	var out []string
+	for _, t := range tags {
+		n := lang.Normalize(t)
+		if n == "" {
+			logger.Warn("Ignoring invalid language tag", "component", "spider", "tag", t)
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// identifyLanguage sets the page's language from its declarations and text.
+func identifyLanguage(page *entity.Page) {
+	self := ""
+	for _, a := range page.Alternates {
+		if a.URL == page.URL {
+			self = a.Lang
+			break
+		}
+	}
+	page.Language = lang.Identify(lang.Signals{
+		HTML:     page.HTMLLang,
+		Hreflang: self,
+		Header:   page.ContentLanguage,
+		Locale:   page.Locale,
+		Text:     page.Text,
+	})
+}
+
+// filterLanguages drops the links known to lead to pages in a language not
+// crawled: hreflang alternates and language subdomains such as
+// fr.wikipedia.org. Links of unknown language are kept.
+func (s *Spider) filterLanguages(page *entity.Page) {
+	if len(s.languages) == 0 {
+		return
+	}
+
+	hints := map[string]string{}
+	for _, l := range page.Outlinks {
+		if l.Lang != "" {
+			hints[l.URL] = l.Lang
+		}
+	}
+
+	keep := page.Links[:0]
+	for _, l := range page.Links {
+		hint, ok := hints[l]
+		if !ok {
+			if u, err := url.Parse(l); err == nil {
+				hint = lang.FromHost(u.Host)
+			}
+		}
+		if lang.Match(hint, s.languages) {
+			keep = append(keep, l)
+		}
+	}
+	page.Links = keep
+}
+
+// translationLinks returns the page's hreflang alternates in a crawled
+// language: all that is followed from a page in another language.
+func (s *Spider) translationLinks(page *entity.Page) []string {
+	var out []string
+	for _, l := range page.Outlinks {
+		if l.Source == entity.LinkHreflang && l.Lang != "" && lang.Match(l.Lang, s.languages) {
+			out = append(out, l.URL)
+		}
+	}
+	return out
+}
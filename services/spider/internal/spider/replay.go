@@ -0,0 +1,267 @@
+package spider
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
+	"github.com/Hassan-ach/boogle/services/spider/internal/warc"
+)
+
+type ReplayStats struct {
+	Files   int
+	Records int
+	Pages   int
+	Robots  int
+	Probes  int
+	Skipped int
+	Errors  int
+}
+
+// replayHosts holds what the archive has said so far about hosts.
+type replayHosts struct {
+	hosts  map[string]*entity.Host        // by name
+	robots map[string]*entity.RobotsRules // by origin
+	// redirects maps the target of a robots.txt or probe redirect to the
+	// URL first requested, whose outcome the final answer is.
+	redirects map[string]*url.URL
+}
+
+// Replay feeds archived responses from every WARC file in dir through the
+// same parse, link validation and persist steps as a live crawl, without
+// touching the network. Files are processed in the order they were
+// written, by the time in their names; a host is crawled by one instance
+// at a time, so its robots.txt and probe records are seen before the pages
+// they govern. Links are queued in the default job's frontier.
+func (s *Spider) Replay(ctx context.Context, dir string) (ReplayStats, error) {
+	var stats ReplayStats
+	logger := s.logger.With("component", "replay")
+
+	files, err := warcFiles(dir)
+	if err != nil {
+		return stats, err
+	}
+
+	j := &job{name: defaultJobName, store: s.store}
+	hosts := &replayHosts{
+		hosts:     map[string]*entity.Host{},
+		robots:    map[string]*entity.RobotsRules{},
+		redirects: map[string]*url.URL{},
+	}
+	for _, name := range files {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		logger.Info("Replaying WARC file", "file", name)
+		if err := s.replayFile(ctx, j, dir, name, hosts, &stats); err != nil {
+			return stats, fmt.Errorf("replay %s: %w", name, err)
+		}
+		stats.Files++
+	}
+
+	return stats, nil
+}
+
+func (s *Spider) replayFile(
+	ctx context.Context,
+	j *job,
+	dir, name string,
+	hosts *replayHosts,
+	stats *ReplayStats,
+) error {
+	logger := s.logger.With("component", "replay", "file", name)
+
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	r := warc.NewReader(f)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stats.Records++
+
+		if rec.Type() != "response" {
+			continue
+		}
+
+		target := rec.TargetURI()
+		u, err := url.Parse(target)
+		if err != nil {
+			stats.Skipped++
+			continue
+		}
+
+		res, body, err := rec.Response()
+		if err != nil {
+			logger.Warn("Unreadable response record", "url", target, "error", err)
+			stats.Errors++
+			continue
+		}
+
+		// robots.txt and probes are answered by the end of their redirects
+		requested := u
+		if from, ok := hosts.redirects[target]; ok {
+			requested = from
+			delete(hosts.redirects, target)
+		}
+		probe := rec.Probe() == warcProbe
+		if requested.Path == "/robots.txt" || probe {
+			if loc, err := res.Location(); err == nil && res.StatusCode >= 300 && res.StatusCode < 400 {
+				hosts.redirects[loc.String()] = requested
+				continue
+			}
+		}
+
+		if requested.Path == "/robots.txt" {
+			rules, ok := hosts.robots[origin(requested)]
+			if !ok {
+				rules = &entity.RobotsRules{Origin: origin(requested)}
+				hosts.robots[rules.Origin] = rules
+			}
+			if res.StatusCode < 200 || res.StatusCode >= 300 {
+				body = nil
+			}
+			s.applyRobots(rules, cutRobots(body, s.config.App.RobotsMaxSize), res.StatusCode, rec.Date())
+			stats.Robots++
+			continue
+		}
+
+		if probe {
+			host := s.replayHost(hosts, requested, rec.Date())
+			host.ProbedAt = rec.Date()
+			if err := s.applyProbe(host, res.StatusCode, target, bytes.NewReader(body)); err != nil {
+				logger.Warn("Failed to parse archived probe", "url", target, "error", err)
+				stats.Errors++
+			}
+			stats.Probes++
+			continue
+		}
+		if rec.Probe() != "" {
+			stats.Skipped++
+			continue
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+		if res.StatusCode >= 300 || (mediaType != "" && mediaType != "text/html") {
+			stats.Skipped++
+			continue
+		}
+
+		host := s.replayHost(hosts, u, rec.Date())
+		if host.DisallowAll || utils.IsDisallowed(u.Path, host.NotAllowedPaths) {
+			stats.Skipped++
+			continue
+		}
+
+		page, err := s.parser.ParseHTML(bytes.NewReader(body), target)
+		if err != nil {
+			logger.Warn("Failed to parse archived page", "url", target, "error", err)
+			stats.Errors++
+			continue
+		}
+		if date := rec.Date(); !date.IsZero() {
+			page.CrawledAt = date
+		}
+		page.StatusCode = res.StatusCode
+		page.ContentLanguage = res.Header.Get("Content-Language")
+		page.WarcFile = name
+		page.WarcOffset = rec.Offset
+
+		s.persist(ctx, j, page, host)
+		stats.Pages++
+	}
+}
+
+// replayHost returns the metadata of u's host under the robots.txt rules of
+// u's origin archived so far, as a live crawl applies them. An origin
+// without an archived robots.txt is treated as having none (a 404).
+func (s *Spider) replayHost(hosts *replayHosts, u *url.URL, at time.Time) *entity.Host {
+	rules, ok := hosts.robots[origin(u)]
+	if !ok {
+		rules = &entity.RobotsRules{Origin: origin(u)}
+		s.applyRobots(rules, nil, http.StatusNotFound, at)
+	}
+
+	host, ok := hosts.hosts[u.Host]
+	if !ok {
+		host = newHost(u.Host, rules)
+		hosts.hosts[u.Host] = host
+		return host
+	}
+	host.ApplyRobots(rules)
+	return host
+}
+
+// warcFiles returns the WARC files in dir in the order they were written.
+// Names are <instance>-<YYYYmmddHHMMSS>-<seq>.warc.gz, so name order only
+// holds within an instance: files are sorted by time, then sequence.
+func warcFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read warc dir: %w", err)
+	}
+
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".warc.gz") {
+			continue
+		}
+		files = append(files, e.Name())
+	}
+	slices.SortFunc(files, func(a, b string) int {
+		at, aseq := warcFileTime(a)
+		bt, bseq := warcFileTime(b)
+		return cmp.Or(strings.Compare(at, bt), cmp.Compare(aseq, bseq), strings.Compare(a, b))
+	})
+	return files, nil
+}
+
+// warcFileTime returns the timestamp and sequence number in the name of a
+// WARC file. The instance prefix may itself contain dashes, so they are
+// read from the end.
+func warcFileTime(name string) (string, int) {
+	rest, seq, ok := cutLast(strings.TrimSuffix(name, ".warc.gz"), "-")
+	if !ok {
+		return "", 0
+	}
+	_, stamp, ok := cutLast(rest, "-")
+	if !ok {
+		return "", 0
+	}
+	n, _ := strconv.Atoi(seq)
+	return stamp, n
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
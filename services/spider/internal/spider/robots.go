@@ -0,0 +1,164 @@
+package spider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
+)
+
+// robotsFetchTimeout bounds a single robots.txt fetch, redirects included.
+const robotsFetchTimeout = 30 * time.Second
+
+// fetchRobots fetches robots.txt for the scheme and host of u. Only the
+// first RobotsMaxSize bytes are kept, cut at the last full line. A zero
+// status with an error means the host was unreachable.
+func (s *Spider) fetchRobots(ctx context.Context, u *url.URL) ([]byte, int, error) {
+	robotsURL := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+
+	ctx, cancel := context.WithTimeout(ctx, robotsFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("create robots.txt request: %w", err)
+	}
+	req.Header.Set("User-Agent", utils.UserAgent)
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("get robots.txt: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, res.StatusCode, nil
+	}
+
+	max := s.config.App.RobotsMaxSize
+	body, err := io.ReadAll(io.LimitReader(res.Body, max+1))
+	if err != nil {
+		return nil, 0, fmt.Errorf("read robots.txt: %w", err)
+	}
+	return cutRobots(body, max), res.StatusCode, nil
+}
+
+// cutRobots keeps the first max bytes of a robots.txt body, cut at the last
+// full line.
+func cutRobots(body []byte, max int64) []byte {
+	if int64(len(body)) > max {
+		body = body[:max]
+		if i := bytes.LastIndexByte(body, '\n'); i >= 0 {
+			body = body[:i+1]
+		}
+	}
+	return body
+}
+
+// applyRobots updates the rules of an origin from the outcome of a
+// robots.txt fetch, following RFC 9309:
+//   - 2xx: the parsed rules apply.
+//   - 4xx: there are no rules, everything is allowed.
+//   - 5xx, 429 or unreachable: the previous rules stay in force if there
+//     are any, otherwise the whole origin is disallowed until the next fetch.
+//
+// Successful fetches are trusted for RobotsTTL, failed ones are retried
+// after RobotsErrorTTL.
+func (s *Spider) applyRobots(rules *entity.RobotsRules, body []byte, status int, now time.Time) {
+	hadRules := hasRobotsRules(rules)
+	rules.FetchedAt = now
+	rules.Status = status
+
+	var r *entity.Robots
+	switch {
+	case status >= 200 && status < 300:
+		r = s.parser.ParseRobots(string(body), "*")
+	case status >= 400 && status < 500 && status != http.StatusTooManyRequests:
+		r = s.parser.ParseRobots("", "*")
+	default:
+		rules.ExpiresAt = now.Add(s.config.App.RobotsErrorTTL)
+		rules.DisallowAll = !hadRules
+		if rules.Delay <= 0 {
+			rules.Delay = s.parser.ParseRobots("", "*").CrawlDelay
+		}
+		return
+	}
+
+	rules.ExpiresAt = now.Add(s.config.App.RobotsTTL)
+	rules.DisallowAll = false
+	rules.Delay = r.CrawlDelay
+	rules.Allow = r.Allow
+	rules.Disallow = r.Disallow
+	rules.Sitemaps = r.SiteMaps
+}
+
+// hasRobotsRules reports whether rules hold the outcome of an earlier
+// successful (2xx or 4xx) fetch.
+func hasRobotsRules(rules *entity.RobotsRules) bool {
+	return !rules.FetchedAt.IsZero() && !rules.DisallowAll
+}
+
+func origin(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// robotsFor returns the robots.txt rules of u's scheme and host. Rules
+// never fetched are fetched now; expired ones are refetched in the
+// background while the cached ones keep applying.
+func (s *Spider) robotsFor(ctx context.Context, u *url.URL) *entity.RobotsRules {
+	rules, ok, err := s.store.GetRobots(ctx, origin(u))
+	if err != nil {
+		s.logger.Warn("Failed to read cached robots.txt rules, refetching",
+			"component", "robots", "origin", origin(u), "error", err)
+	}
+	if !ok {
+		return s.loadRobots(ctx, u, &entity.RobotsRules{Origin: origin(u)})
+	}
+	if robotsExpired(rules, time.Now()) {
+		s.refreshRobots(u, rules)
+	}
+	return rules
+}
+
+// loadRobots fetches robots.txt for u's scheme and host, applies the
+// outcome to rules and caches them.
+func (s *Spider) loadRobots(ctx context.Context, u *url.URL, rules *entity.RobotsRules) *entity.RobotsRules {
+	body, status, err := s.fetchRobots(ctx, u)
+	if err != nil {
+		s.logger.Warn("Failed to fetch robots.txt",
+			"component", "robots", "origin", rules.Origin, "error", err)
+	}
+	s.applyRobots(rules, body, status, time.Now())
+	s.store.SetRobots(ctx, rules)
+	return rules
+}
+
+// refreshRobots refetches robots.txt for u's scheme and host in the
+// background, at most once at a time per origin. Crawlers keep using the
+// cached rules meanwhile.
+func (s *Spider) refreshRobots(u *url.URL, cached *entity.RobotsRules) {
+	if _, busy := s.robotsRefresh.LoadOrStore(cached.Origin, true); busy {
+		return
+	}
+
+	rules := *cached
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.robotsRefresh.Delete(rules.Origin)
+
+		s.loadRobots(s.ctx, u, &rules)
+		s.logger.Info("Refreshed robots.txt", "component", "robots", "origin", rules.Origin,
+			"status", rules.Status, "disallow_all", rules.DisallowAll, "rules", len(rules.Disallow))
+	}()
+}
+
+func robotsExpired(rules *entity.RobotsRules, now time.Time) bool {
+	return rules.ExpiresAt.IsZero() || now.After(rules.ExpiresAt)
+}
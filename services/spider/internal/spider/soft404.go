@@ -0,0 +1,163 @@
+package spider
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+	"github.com/Hassan-ach/boogle/services/spider/internal/soft404"
+	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
+	"github.com/Hassan-ach/boogle/services/spider/internal/warc"
+)
+
+// probeFetchTimeout bounds a request for a nonexistent path, redirects
+// included.
+const probeFetchTimeout = 30 * time.Second
+
+// warcProbe marks probe exchanges in the WARC archive, so that replay
+// restores them onto the host instead of persisting them as pages.
+const warcProbe = "soft-404"
+
+// probe requests a random path of u's host, which cannot exist, and
+// records the answer in host: a site answering 200 OK serves soft 404s,
+// and the page it serves is what they look like. A parking placeholder
+// served for the path marks the domain parked.
+func (s *Spider) probe(ctx context.Context, host *entity.Host, u *url.URL) error {
+	if host.DisallowAll {
+		return nil
+	}
+
+	host.ProbedAt = time.Now()
+	host.ProbeStatus = 0
+	host.ProbeURL = ""
+	host.ProbeTitle = ""
+	host.ProbeHash = 0
+	host.SoftNotFound = false
+
+	probeURL := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/" + strings.ToLower(rand.Text())}
+	if utils.IsDisallowed(probeURL.Path, host.NotAllowedPaths) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(warc.AsProbe(ctx, warcProbe), probeFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL.String(), nil)
+	if err != nil {
+		return fmt.Errorf("create probe request: %w", err)
+	}
+	req.Header.Set("User-Agent", utils.UserAgent)
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("get probe: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	return s.applyProbe(host, res.StatusCode, res.Request.URL.String(), res.Body)
+}
+
+// applyProbe records in host the answer to a probe: its status, the URL it
+// ended at and, for a 2xx, the signature of the page served.
+func (s *Spider) applyProbe(host *entity.Host, status int, finalURL string, body io.Reader) error {
+	host.ProbeStatus = status
+	host.ProbeURL = finalURL
+	host.ProbeTitle = ""
+	host.ProbeHash = 0
+	host.SoftNotFound = false
+	if status < 200 || status >= 300 {
+		host.Parked = false
+		return nil
+	}
+
+	page, err := s.parser.ParseHTML(body, host.ProbeURL)
+	if err != nil {
+		return fmt.Errorf("parse probe: %w", err)
+	}
+	sig := soft404.Sign(page.Title, page.Text)
+	host.ProbeTitle = sig.Title
+	host.ProbeHash = sig.Hash
+	host.SoftNotFound = true
+	host.Parked = soft404.IsParked(page.Text, page.Embeds)
+	return nil
+}
+
+func (s *Spider) probeExpired(host *entity.Host, now time.Time) bool {
+	ttl := s.config.Soft404.ProbeTTL
+	return ttl > 0 && !host.DisallowAll && now.After(host.ProbedAt.Add(ttl))
+}
+
+// refreshProbe probes u's host again in the background, at most once at a
+// time per host.
+func (s *Spider) refreshProbe(u *url.URL) {
+	if _, busy := s.probeRefresh.LoadOrStore(u.Host, true); busy {
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.probeRefresh.Delete(u.Host)
+
+		logger := s.logger.With("component", "soft404", "host", u.Host)
+
+		probed, ok, err := s.store.GetHostMetaData(s.ctx, u.Host)
+		if err != nil || !ok {
+			return
+		}
+		if err := s.probe(s.ctx, probed, u); err != nil {
+			logger.Warn("Failed to probe a nonexistent path", "error", err)
+		}
+
+		// crawlers may have updated the host during the probe
+		host, ok, err := s.store.GetHostMetaData(s.ctx, u.Host)
+		if err != nil || !ok {
+			host = probed
+		}
+		host.MergeProbe(probed)
+		s.store.PersistHost(s.ctx, host)
+
+		logger.Info("Probed a nonexistent path",
+			"status", host.ProbeStatus, "soft_404", host.SoftNotFound, "parked", host.Parked)
+	}()
+}
+
+// softNotFound returns why a page is not real content, soft404.NotFound or
+// soft404.Parked, or "". A parking placeholder served as the home page
+// marks the whole host parked; elsewhere only the page is skipped. The
+// home page, and the page nonexistent paths redirect to, are not soft 404s.
+func (s *Spider) softNotFound(page *entity.Page, host *entity.Host) string {
+	home := isHomePage(page.URL)
+	if soft404.IsParked(page.Text, page.Embeds) {
+		if home {
+			host.Parked = true
+		}
+		return soft404.Parked
+	}
+
+	if soft404.IsNotFound(page.Title, page.Text) {
+		host.SoftNotFoundPages++
+		return soft404.NotFound
+	}
+
+	if !host.SoftNotFound || home || page.URL == host.ProbeURL {
+		return ""
+	}
+	probe := soft404.Signature{Title: host.ProbeTitle, Hash: host.ProbeHash}
+	if soft404.Similar(soft404.Sign(page.Title, page.Text), probe, s.config.Soft404.MaxDistance) {
+		host.SoftNotFoundPages++
+		return soft404.NotFound
+	}
+	return ""
+}
+
+func isHomePage(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Path == "" || u.Path == "/") && u.RawQuery == ""
+}
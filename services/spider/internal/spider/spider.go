@@ -1,20 +1,30 @@
 package spider
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"net/url"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Hassan-ach/boogle/services/spider/internal/admin"
 	"github.com/Hassan-ach/boogle/services/spider/internal/config"
 	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+	"github.com/Hassan-ach/boogle/services/spider/internal/fetchlog"
+	"github.com/Hassan-ach/boogle/services/spider/internal/focus"
+	"github.com/Hassan-ach/boogle/services/spider/internal/lang"
+	"github.com/Hassan-ach/boogle/services/spider/internal/metrics"
 	"github.com/Hassan-ach/boogle/services/spider/internal/parser"
+	"github.com/Hassan-ach/boogle/services/spider/internal/profile"
+	"github.com/Hassan-ach/boogle/services/spider/internal/soft404"
 	"github.com/Hassan-ach/boogle/services/spider/internal/store"
+	"github.com/Hassan-ach/boogle/services/spider/internal/trap"
 	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
+	"github.com/Hassan-ach/boogle/services/spider/internal/warc"
 )
 
 type Spider struct {
@@ -29,37 +39,157 @@ type Spider struct {
 	crawlerTimeout time.Duration
 	crawlerDelay   time.Duration
 
-	fetchpool chan struct{}
-	logger    *utils.Logger
+	// jobs holds the crawl jobs running in this process by name
+	mu     sync.Mutex
+	jobs   map[string]*job
+	paused atomic.Bool // pauses every job
+
+	// robotsRefresh holds the origins whose robots.txt is being refetched.
+	robotsRefresh sync.Map
+	// probeRefresh holds the hosts being probed for soft 404s.
+	probeRefresh sync.Map
+
+	traps      *trap.Detector
+	focus      *focus.Classifier // nil unless focused crawling is enabled
+	languages  []string          // normalized LANGUAGES, empty to crawl every language
+	fetchpool  *utils.Semaphore
+	hostErrors *hostErrorLog
+	logger     *utils.Logger
+	metrics    *metrics.Server
+	admin      *admin.Server
+	warc       *warc.Writer
 }
 
 func NewSpider(conf *config.Config) *Spider {
 	httpClient := &http.Client{Timeout: time.Duration(conf.App.HttpTimeout) * time.Second}
 	logger := utils.NewMultiLogger(conf.App.LogsPath)
+	utils.ConfigureCanonicalizer(conf.App.StripParams, conf.App.HTTPSHosts)
+
+	st := store.NewStore(conf.Store, logger)
+
+	profiles, err := profile.NewTransport(nil, conf.Profiles)
+	if err != nil {
+		log.Fatalf("Failed to load fetch profiles ERROR: %v", err)
+	}
+	if names := profiles.Names(); len(names) > 0 {
+		logger.Info("Fetch profiles loaded", "component", "spider", "profiles", names)
+	}
+
+	// every fetch, including robots.txt and sitemaps, is logged and
+	// archived as sent by the crawler, before profile credentials are added
+	httpClient.Transport = &fetchlog.Transport{
+		Base:     profiles,
+		Recorder: st,
+		Instance: conf.App.InstanceID,
+	}
+
+	var warcWriter *warc.Writer
+	if conf.App.WarcDir != "" {
+		w, err := warc.NewWriter(conf.App.WarcDir, conf.App.InstanceID, conf.App.WarcMaxSize)
+		if err != nil {
+			logger.Error("WARC archiving disabled", "component", "spider", "error", err)
+		} else {
+			warcWriter = w
+			httpClient.Transport = &warc.Transport{
+				Base:   httpClient.Transport,
+				Writer: w,
+				Log:    logger.With("component", "warc"),
+			}
+		}
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 
 	s := &Spider{
 		config:         conf,
 		httpClient:     httpClient,
-		parser:         parser.NewParser(httpClient, logger),
-		store:          store.NewStore(conf.Store, logger),
+		parser:         parser.NewParser(httpClient, conf.Parser, logger),
+		store:          st,
 		wg:             sync.WaitGroup{},
 		ctx:            ctx,
 		cancel:         cancel,
 		crawlerTimeout: time.Duration(conf.App.CrawlerTimeout) * time.Second,
 		crawlerDelay:   time.Duration(conf.App.ClawlerDelay) * time.Microsecond,
-		fetchpool:      make(chan struct{}, conf.App.MaxConcurrentFetch),
+		jobs:           map[string]*job{},
+		fetchpool:      utils.NewSemaphore(conf.App.MaxConcurrentFetch),
+		hostErrors:     newHostErrorLog(),
+		traps:          trap.NewDetector(conf.Trap),
+		languages:      normalizeLanguages(conf.App.Languages, logger),
 		logger:         logger,
+		warc:           warcWriter,
+	}
+
+	if len(conf.Focus.Keywords) > 0 || len(conf.Focus.Examples) > 0 {
+		c, err := focus.NewClassifier(conf.Focus)
+		if err != nil {
+			logger.Error("Focused crawling disabled", "component", "spider", "error", err)
+		} else {
+			s.focus = c
+			st.SetFocus(c, conf.Focus)
+		}
+	}
+
+	if conf.App.MetricsAddr != "" {
+		s.metrics = metrics.NewServer(conf.App.MetricsAddr, logger)
+		s.registerGauges()
+	}
+
+	if conf.App.AdminAddr != "" {
+		if conf.App.AdminToken == "" {
+			logger.Error("Admin API disabled: ADMIN_TOKEN is not set", "component", "spider")
+		} else {
+			s.admin = admin.NewServer(conf.App.AdminAddr, string(conf.App.AdminToken), s, logger)
+		}
 	}
 
 	fmt.Printf("Spider initialized: %+v\n", s)
 	return s
 }
 
+func (s *Spider) registerGauges() {
+	metrics.RegisterGauge("frontier_size", "URLs waiting in the frontier of every job.", func() float64 {
+		return float64(s.sumJobs(func(j *job) int64 { return j.store.GetCache().CountUrls(context.Background()) }))
+	})
+	metrics.RegisterGauge("visited_urls", "URLs marked as visited by every job.", func() float64 {
+		return float64(s.sumJobs(func(j *job) int64 { return j.store.GetCache().CountVisited(context.Background()) }))
+	})
+	metrics.RegisterGauge("fetchpool_in_use", "Fetch slots currently held by crawlers.", func() float64 {
+		return float64(s.fetchpool.InUse())
+	})
+	metrics.RegisterGauge("owned_partitions", "Frontier partitions leased by this instance, across jobs.", func() float64 {
+		return float64(s.sumJobs(func(j *job) int64 { return int64(len(j.cluster.Owned())) }))
+	})
+	metrics.RegisterGauge("fetchpool_capacity", "Maximum concurrent fetches.", func() float64 {
+		return float64(s.fetchpool.Limit())
+	})
+	metrics.RegisterGauge("persist_queue_length", "Pages waiting for the database batch writer.", func() float64 {
+		return float64(s.store.QueueLen())
+	})
+	metrics.RegisterGauge("running_jobs", "Crawl jobs running in this instance.", func() float64 {
+		return float64(len(s.runningJobs()))
+	})
+}
+
+func (s *Spider) sumJobs(fn func(j *job) int64) int64 {
+	var n int64
+	for _, j := range s.runningJobs() {
+		n += fn(j)
+	}
+	return n
+}
+
+// Start runs the crawl jobs registered in Postgres. The default job is
+// created with startUrls the first time.
 func (s *Spider) Start(startUrls []string) {
-	if err := s.store.Init(startUrls); err != nil {
+	if s.metrics != nil {
+		s.metrics.Start()
+	}
+	if s.admin != nil {
+		s.admin.Start()
+	}
+
+	if err := s.store.Init(); err != nil {
 		s.logger.Error(
-			"Failed to initialize store with start URLs",
+			"Failed to initialize store",
 			"component",
 			"store",
 			"error",
@@ -68,24 +198,84 @@ func (s *Spider) Start(startUrls []string) {
 		return
 	}
 
-	for i := 0; i < s.config.App.MaxCrawlers; i++ {
+	if err := s.ensureDefaultJob(s.ctx, startUrls); err != nil {
+		s.logger.Error("Failed to register the default job", "component", "jobs", "error", err)
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.runJobs(s.ctx)
+	}()
+
+	if s.config.Store.Events.Stream != "" {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.store.RelayEvents(s.ctx)
+		}()
+	}
+
+	if s.config.Feed.PollInterval > 0 {
 		s.wg.Add(1)
-		s.logger.Info("Starting worker", "component", "spider", "crawler_id", i)
-		go s.craller(i + 1)
+		go func() {
+			defer s.wg.Done()
+			s.runFeeds(s.ctx)
+		}()
+	}
+}
+
+// resizeCrawlers starts or cancels the job's crawler goroutines until n
+// are running.
+func (s *Spider) resizeCrawlers(j *job, n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for len(j.crawlers) < n {
+		id := len(j.crawlers) + 1
+		ctx, cancel := context.WithCancel(j.ctx)
+		j.crawlers = append(j.crawlers, cancel)
+
+		s.wg.Add(1)
+		j.log.Info("Starting worker", "crawler_id", id)
+		go s.craller(ctx, j, id)
+	}
+
+	for len(j.crawlers) > n {
+		last := len(j.crawlers) - 1
+		j.crawlers[last]()
+		j.crawlers = j.crawlers[:last]
+		j.log.Info("Stopping worker", "crawler_id", last+1)
 	}
 }
 
 func (s *Spider) Stop() {
 	s.cancel()
 	s.wg.Wait()
+	s.store.Flush()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if s.admin != nil {
+		s.admin.Shutdown(ctx)
+	}
+	if s.metrics != nil {
+		s.metrics.Shutdown(ctx)
+	}
 }
 
 func (s *Spider) Close() {
+	if s.warc != nil {
+		if err := s.warc.Close(); err != nil {
+			s.logger.Warn("close warc writer", "component", "spider", "error", err)
+		}
+	}
 	s.store.Close()
 	s.logger.Close()
 }
 
-func (s *Spider) craller(craller_id int) {
+func (s *Spider) craller(ctx context.Context, j *job, craller_id int) {
 	defer s.wg.Done()
 
 	ticker := time.NewTicker(s.crawlerDelay)
@@ -93,33 +283,42 @@ func (s *Spider) craller(craller_id int) {
 
 	for {
 		select {
-		case <-s.ctx.Done():
+		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			s.crawl(craller_id)
+			if s.paused.Load() || j.paused.Load() || j.exhausted(time.Now()) != "" {
+				continue
+			}
+			s.crawl(j, craller_id)
 		}
 	}
 }
 
-func (s *Spider) crawl(crawler_id int) {
-	ctx, cancel := context.WithTimeout(s.ctx, s.crawlerTimeout)
+func (s *Spider) crawl(j *job, crawler_id int) {
+	ctx, cancel := context.WithTimeout(j.ctx, s.crawlerTimeout)
 	defer cancel()
+	ctx = fetchlog.WithWorker(ctx, crawler_id)
 
-	logger := s.logger.With("component", "crawler", "crawler_id", crawler_id)
+	logger := s.logger.With("component", "crawler", "job", j.name, "crawler_id", crawler_id)
 
-	select {
-	case s.fetchpool <- struct{}{}:
-	case <-ctx.Done():
+	if err := s.fetchpool.Acquire(ctx); err != nil {
 		fmt.Println("Crawler timed out waiting for fetch slot")
 		return
 	}
-	defer func() { <-s.fetchpool }()
+	defer s.fetchpool.Release()
 
-	rawUrl, ok, err := s.store.GetNextUrl(ctx)
+	rawUrl, score, ok, err := j.store.GetNextUrl(ctx, j.cluster.Owned())
 	if err != nil || !ok {
 		// logger.Warn("Failed to fetch next URL from store", "error", err)
 		return
 	}
+	j.inFlight.Add(1)
+	defer j.inFlight.Add(-1)
+
+	published, _, err := j.store.GetCache().TakePublished(ctx, rawUrl)
+	if err != nil {
+		logger.Warn("Failed to read publication date", "url", rawUrl, "error", err)
+	}
 
 	logger.Info("Fetched URL from store",
 		"url", rawUrl)
@@ -131,6 +330,7 @@ func (s *Spider) crawl(crawler_id int) {
 		return
 	}
 
+	rules := s.robotsFor(ctx, u)
 	host, ok, err := s.store.GetHostMetaData(ctx, u.Host)
 	if err != nil {
 		s.logger.Warn("Failed to retrieve host metadata from store, will attempt to generate",
@@ -139,43 +339,70 @@ func (s *Spider) crawl(crawler_id int) {
 	if !ok {
 		logger.Info("Host metadata not found in store, generating new metadata",
 			"host", u.Host)
-		// Host metadata missing; generate using parser
-		host, err = s.newHostMetaData(ctx, u.Host)
-		if err != nil {
-			logger.Error("generate host metadata",
-				"host", u.Host, "error", err)
-
-			// use a safe default
-			host = &entity.Host{
-				MaxRetry:        5,
-				MaxPages:        10,
-				PagesCrawled:    0,
-				Delay:           5,
-				Name:            u.Host,
-				AllowedUrls:     []string{},
-				NotAllowedPaths: []string{},
-			}
+		host = s.newHostMetaData(ctx, j, u, rules)
+		logger.Info(
+			"Host metadata retrieved",
+			"host",
+			host.Name,
+			"delay",
+			host.Delay,
+			"max_retry",
+			host.MaxRetry,
+			"not_allowed_paths",
+			len(host.NotAllowedPaths),
+			"allowed_urls",
+			len(host.AllowedUrls),
+		)
+	} else {
+		host.ApplyRobots(rules)
+	}
+	if s.probeExpired(host, time.Now()) {
+		s.refreshProbe(u)
+	}
+
+	if host.DisallowAll {
+		// robots.txt is unreachable: keep the URL for later, behind the others
+		logger.Info("Host disallowed until robots.txt is reachable, requeueing URL",
+			"url", rawUrl, "robots_status", host.RobotsStatus)
+		if err := j.store.Requeue(ctx, rawUrl, score, published); err != nil {
+			logger.Warn("Failed to requeue URL", "url", rawUrl, "error", err)
+		}
+		return
+	}
+	if utils.IsDisallowed(u.Path, host.NotAllowedPaths) {
+		logger.Info("URL disallowed by robots.txt", "url", rawUrl)
+		return
+	}
+	if host.Parked {
+		logger.Info("Host is a parked domain, dropping URL", "url", rawUrl)
+		return
+	}
+
+	if err := s.claimHost(ctx, host, "page"); err != nil {
+		// free the fetch slot for another host rather than sleeping in it
+		var busy *hostBusyError
+		if errors.As(err, &busy) {
+			logger.Debug("Host crawl delay not expired, requeueing URL",
+				"url", rawUrl, "wait", busy.wait)
 		} else {
-			logger.Info(
-				"Host metadata retrieved",
-				"host",
-				host.Name,
-				"delay",
-				host.Delay,
-				"max_retry",
-				host.MaxRetry,
-				"not_allowed_paths",
-				len(host.NotAllowedPaths),
-				"allowed_urls",
-				len(host.AllowedUrls),
-			)
+			logger.Warn("Failed to claim host, requeueing URL",
+				"host", host.Name, "error", err)
 		}
+		if err := j.store.Requeue(ctx, rawUrl, score, published); err != nil {
+			logger.Warn("Failed to requeue URL", "url", rawUrl, "error", err)
+		}
+		return
 	}
 
-	page, err := s.fetchAndParse(rawUrl, host.MaxRetry, host.Delay)
+	page, err := s.fetchAndParse(ctx, rawUrl, host.MaxRetry, host.Delay)
 	if err != nil {
 		logger.Error("Failed to fetch and parse page",
 			"url", rawUrl, "error", err)
+		s.hostErrors.Add(host.Name, rawUrl, err)
+		host.ErrorCount++
+		host.LastError = err.Error()
+		host.LastErrorAt = time.Now()
+		s.store.PersistHost(ctx, host)
 		return
 	}
 
@@ -186,71 +413,199 @@ func (s *Spider) crawl(crawler_id int) {
 		"status_code",
 		page.StatusCode,
 		"links_found",
-		len(page.Links),
-		"image_count",
-		len(page.Images),
+		len(page.Outlinks),
 	)
 
+	page.Priority = score
+	page.PublishedAt = published
+	s.persist(ctx, j, page, host)
+	s.discoverFeeds(ctx, j, page.Feeds)
+
+	pages, err := j.store.GetCache().IncrPages(ctx)
+	if err != nil {
+		logger.Warn("Failed to count page towards the job budget", "error", err)
+		return
+	}
+	j.pages.Store(pages)
+}
+
+// persist routes the page's links, filters those to crawl against the host
+// rules and stores it in the job's namespace. Pages in a language not
+// crawled are not stored, and only their translations are followed. It is
+// shared by live crawling and WARC replay.
+func (s *Spider) persist(ctx context.Context, j *job, page *entity.Page, host *entity.Host) {
+	store.RouteLinks(page)
+	identifyLanguage(page)
+	excluded := !lang.Match(page.Language, s.languages)
+	if excluded {
+		page.Links = s.translationLinks(page)
+	}
+	s.filterLanguages(page)
 	normUrls := utils.ValidateLinks(page.Links, host.NotAllowedPaths)
-	page.Links = normUrls
+	page.Links, page.DemotedLinks = s.filterTraps(normUrls)
+
+	if excluded {
+		metrics.PagesSkipped.WithLabelValues("language").Inc()
+		s.logger.Debug("Skipped page in a language not crawled",
+			"component", "crawler", "url", page.URL, "language", page.Language)
+		host.PagesCrawled++
+		j.store.Skip(ctx, page, host)
+		return
+	}
+
+	if reason := s.softNotFound(page, host); reason != "" {
+		if reason == soft404.Parked {
+			// placeholder links lead to ads and domain marketplaces
+			page.Links, page.DemotedLinks = nil, nil
+		}
+		metrics.PagesSkipped.WithLabelValues(reason).Inc()
+		s.logger.Info("Skipped page that is not real content",
+			"component", "soft404", "url", page.URL, "reason", reason)
+		host.PagesCrawled++
+		j.store.Skip(ctx, page, host)
+		return
+	}
+
+	if s.focus != nil {
+		text := page.Title + " " + page.Description + " " + page.Text
+		s.focus.Learn(text)
+		page.Relevance = s.focus.Relevance(text)
+		s.logger.Debug("Scored page relevance",
+			"component", "focus", "url", page.URL, "relevance", page.Relevance)
+	}
+
+	page.ContentHash = utils.ContentHash(page.Text, page.HTML)
 
 	host.PagesCrawled++
-	s.store.Persist(ctx, page, host)
+	j.store.Persist(ctx, page, host)
 }
 
 func (s *Spider) fetchAndParse(
+	ctx context.Context,
 	u string,
 	maxRetry, delay int,
 ) (*entity.Page, error) {
-	body, statusCode, err := utils.GetReq(s.httpClient, u, maxRetry, delay)
+	ctx, loc := warc.WithLocation(ctx)
+
+	start := time.Now()
+	res, statusCode, err := utils.FetchContext(ctx, s.httpClient, u, maxRetry, delay)
 	if err != nil {
+		metrics.FetchLatency.WithLabelValues(metrics.StatusClass(statusCode)).
+			Observe(time.Since(start).Seconds())
 		// Failed to fetch page after retries
 		// Suggest logging the URL and retry parameters
 		return nil, fmt.Errorf("GET request failed: %w", err)
 	}
 
-	page, err := s.parser.ParseHTML(bytes.NewReader(body), u)
+	// the body is parsed as it downloads, against the URL it came from
+	final := res.Request.URL
+	page, err := s.parser.ParseHTML(res.Body, final.String())
+	_ = res.Body.Close() // records the WARC location
+	metrics.FetchLatency.WithLabelValues(metrics.StatusClass(statusCode)).
+		Observe(time.Since(start).Seconds())
+	if page != nil {
+		metrics.BytesDownloaded.Add(float64(len(page.HTML)))
+	}
 	if err != nil {
 		// Failed to parse HTML
+		metrics.ParseErrors.Inc()
 		return nil, fmt.Errorf("HTML parsing: %w", err)
 	}
+	metrics.PagesFetched.Inc()
 
-	if page.URL == "" {
-		// Ensure Page.Url is always set
-		page.URL = u
+	if final.Scheme == "https" {
+		// http links to this host can be upgraded from now on
+		utils.MarkHTTPS(final.Host)
 	}
+
 	page.StatusCode = statusCode // Store HTTP status code
-	page.HTML = body             // Store raw HTML
+	page.ContentLanguage = res.Header.Get("Content-Language")
+	page.WarcFile = loc.File
+	page.WarcOffset = loc.Offset
 
 	return page, nil
 }
 
-func (s *Spider) newHostMetaData(ctx context.Context, raw string) (host *entity.Host, err error) {
-	if !strings.HasPrefix(raw, "http://") && !strings.HasPrefix(raw, "https://") {
-		raw = "https://" + raw
-	}
+// filterTraps splits links into those to crawl normally and suspected trap
+// links to crawl last. Links that are certainly traps are dropped.
+func (s *Spider) filterTraps(links []string) (keep, demoted []string) {
+	for _, l := range links {
+		u, err := url.Parse(l)
+		if err != nil {
+			continue
+		}
 
-	u, err := url.Parse(strings.TrimPrefix(raw, "www."))
-	if err != nil {
-		return
+		r := s.traps.Check(u)
+		switch r.Verdict {
+		case trap.Allow:
+			keep = append(keep, l)
+			continue
+		case trap.Demote:
+			demoted = append(demoted, l)
+		}
+
+		metrics.TrapURLs.WithLabelValues(r.Reason, r.Verdict.String()).Inc()
+		if !r.First {
+			continue
+		}
+		s.logger.Warn("Crawler trap pattern detected",
+			"component", "trap", "url", l, "host", u.Host,
+			"reason", r.Reason, "pattern", r.Pattern, "action", r.Verdict.String())
 	}
+	return keep, demoted
+}
+
+// hostBusyError reports that a host's crawl delay from its previous fetch
+// has not expired.
+type hostBusyError struct {
+	host string
+	wait time.Duration
+}
 
-	r, err := s.newRobots(u)
+func (e *hostBusyError) Error() string {
+	return fmt.Sprintf("host %s busy for another %s", e.host, e.wait)
+}
+
+// claimHost reserves host for one fetch, or returns a *hostBusyError with
+// the time left on its crawl delay. kind labels the deferral metric; the
+// host's deferrals are counted in its statistics.
+func (s *Spider) claimHost(ctx context.Context, host *entity.Host, kind string) error {
+	wait, err := s.store.GetCache().ClaimHost(ctx, host.Name, time.Duration(host.Delay)*time.Second)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if wait > 0 {
+		metrics.PolitenessDeferrals.WithLabelValues(kind).Inc()
+		metrics.PolitenessWait.Add(wait.Seconds())
+		s.store.RecordDeferral(entity.Deferral{Host: host.Name, Wait: wait})
+		return &hostBusyError{host: host.Name, wait: wait}
 	}
+	return nil
+}
 
-	sitemaps := parser.FetchSitemaps(s.httpClient, r.SiteMaps, u)
+// newHost returns the metadata of a host seen for the first time, under
+// the robots.txt rules of the origin it was reached through.
+func newHost(name string, rules *entity.RobotsRules) *entity.Host {
+	host := &entity.Host{
+		MaxRetry:     5,
+		MaxPages:     10,
+		PagesCrawled: 0,
+		Name:         name,
+	}
+	host.ApplyRobots(rules)
+	return host
+}
 
-	// create Host object
-	host = &entity.Host{
-		MaxRetry:        5,
-		Delay:           r.CrawlDelay,
-		MaxPages:        10,
-		PagesCrawled:    0,
-		Name:            u.Host,
-		AllowedUrls:     r.Allow,
-		NotAllowedPaths: r.Disallow,
+// newHostMetaData builds the metadata of u's host from the robots.txt
+// rules of u's scheme and host, and queues the URLs of its sitemaps in the
+// job's frontier.
+func (s *Spider) newHostMetaData(ctx context.Context, j *job, u *url.URL, rules *entity.RobotsRules) *entity.Host {
+	host := newHost(u.Host, rules)
+	if s.config.Soft404.ProbeTTL > 0 {
+		if err := s.probe(ctx, host, u); err != nil {
+			s.logger.Warn("Failed to probe a nonexistent path",
+				"component", "soft404", "host", u.Host, "error", err)
+		}
 	}
 
 	s.logger.Info(
@@ -261,41 +616,27 @@ func (s *Spider) newHostMetaData(ctx context.Context, raw string) (host *entity.
 		host.Name,
 		"delay",
 		host.Delay,
+		"robots_status",
+		host.RobotsStatus,
+		"disallow_all",
+		host.DisallowAll,
+		"soft_404",
+		host.SoftNotFound,
+		"parked",
+		host.Parked,
 	)
 
 	// persist in store
-	cache := s.store.GetCache()
-	err = cache.AddHostMetaData(ctx, host.Name, host)
-	if err != nil {
-		s.logger.Error("Failed to store host metadata in cache", "error", err)
-	}
-	err = cache.AddUrls(ctx, sitemaps)
-	if err != nil {
-		s.logger.Error("Failed to add sitemap URLs to cache", "error", err)
-	}
+	s.store.PersistHost(ctx, host)
+	s.probeFeeds(ctx, j, u)
 
-	return host, nil
-}
-
-func (s *Spider) newRobots(u *url.URL) (*entity.Robots, error) {
-	h := strings.TrimPrefix(u.Host, "www.")
-
-	u.Scheme = "https"
-	u.Host = h
-	u.RawQuery = ""
-	u.Fragment = ""
-	u.Path = "/robots.txt"
-
-	robotsURL := u.String()
-
-	// fetch robots.txt
-	var body []byte
-	body, _, err := utils.GetReq(s.httpClient, robotsURL, 3, 5)
-	if err != nil {
-		return nil, fmt.Errorf("get robots.txt: %w", err)
+	if len(host.Sitemaps) > 0 {
+		sitemaps := parser.FetchSitemaps(s.httpClient, host.Sitemaps, u)
+		err := j.store.AddSitemapUrls(ctx, sitemaps)
+		if err != nil {
+			s.logger.Error("Failed to add sitemap URLs to cache", "error", err)
+		}
 	}
 
-	// parse robots.txt for rules and sitemaps
-	r := s.parser.ParseRobots(string(body), "*")
-	return r, nil
+	return host
 }
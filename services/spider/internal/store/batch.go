@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+)
+
+var errWriterStopped = errors.New("batch writer stopped")
+
+// flushTimeout bounds a single batch write, including the frontier updates
+// that follow it.
+const flushTimeout = time.Minute
+
+// persistJob is a page, skipped page, host snapshot, fetch log entry or
+// politeness deferral waiting to be written. Any of them may be nil.
+type persistJob struct {
+	page     *entity.Page
+	skipped  *entity.Page // left out of the index, its stored copy is deleted
+	host     *entity.Host
+	fetch    *entity.Fetch
+	deferral *entity.Deferral
+
+	owner *Store // the job whose frontier receives the page's links
+}
+
+// batchWriter collects jobs and hands them to flush in batches of size
+// jobs, or whatever has accumulated after interval. The queue holds two
+// batches: one being written and one filling up.
+type batchWriter struct {
+	size     int
+	interval time.Duration
+	flush    func(ctx context.Context, jobs []persistJob)
+
+	mu      sync.RWMutex
+	stopped bool
+	queue   chan persistJob
+	done    chan struct{}
+}
+
+func newBatchWriter(
+	size int,
+	interval time.Duration,
+	flush func(ctx context.Context, jobs []persistJob),
+) *batchWriter {
+	if size <= 0 {
+		size = 1
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	w := &batchWriter{
+		size:     size,
+		interval: interval,
+		flush:    flush,
+		queue:    make(chan persistJob, 2*size),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// enqueue blocks until the job is queued, ctx is done or the writer stops.
+func (w *batchWriter) enqueue(ctx context.Context, job persistJob) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.stopped {
+		return errWriterStopped
+	}
+	select {
+	case w.queue <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *batchWriter) len() int {
+	return len(w.queue)
+}
+
+// stop flushes the queued jobs and waits for the last batch to be written.
+func (w *batchWriter) stop() {
+	w.mu.Lock()
+	if !w.stopped {
+		w.stopped = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	<-w.done
+}
+
+func (w *batchWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	batch := make([]persistJob, 0, w.size)
+	write := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		w.flush(ctx, batch)
+		cancel()
+		for _, j := range batch {
+			if j.owner != nil {
+				j.owner.pending.Add(-1)
+			}
+		}
+		batch = make([]persistJob, 0, w.size)
+	}
+
+	for {
+		select {
+		case job, ok := <-w.queue:
+			if !ok {
+				write()
+				return
+			}
+			batch = append(batch, job)
+			if len(batch) >= w.size {
+				write()
+			}
+		case <-ticker.C:
+			write()
+		}
+	}
+}
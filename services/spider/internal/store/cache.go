@@ -4,30 +4,39 @@ import (
 	"bytes"
 	"context"
 	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"log"
+	"math/rand/v2"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 
 	"github.com/Hassan-ach/boogle/services/spider/internal/config"
 	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+	"github.com/Hassan-ach/boogle/services/spider/internal/frontier"
 )
 
 type RedisClient struct {
-	conn     *redis.Client
-	delay    int
-	maxRetry int
+	conn       *redis.Client
+	delay      int
+	maxRetry   int
+	partitions int
+
+	// ns prefixes the frontier, visited set and cluster keys of a crawl
+	// job. Host metadata and politeness keys are shared by every job.
+	ns string
 }
 
 // NewRedisClient initializes and returns a Redis client and wrapper.
-// Registers entity.Host type with gob for serialization.
 func NewRedisClient(conf config.RedisConfig) *RedisClient {
 	port := strconv.Itoa(conf.Port)
 	client := redis.NewClient(&redis.Options{
 		Addr:         conf.Addr + ":" + port,
-		Password:     conf.Password,
+		Password:     string(conf.Password),
 		DB:           conf.DB,
 		Protocol:     2,
 		DialTimeout:  5 * time.Second,
@@ -40,14 +49,18 @@ func NewRedisClient(conf config.RedisConfig) *RedisClient {
 		log.Fatalf("Failed to connected to redis ERROR: %v", err)
 	}
 
-	// Required for gob encoding/decoding of Host structs
-	gob.Register(entity.Host{})
 	fmt.Println("Cache Connected")
 
+	partitions := conf.Partitions
+	if partitions < 1 {
+		partitions = 1
+	}
+
 	return &RedisClient{
-		conn:     client,
-		delay:    conf.Delay,
-		maxRetry: conf.MaxRetry,
+		conn:       client,
+		delay:      conf.Delay,
+		maxRetry:   conf.MaxRetry,
+		partitions: partitions,
 	}
 }
 
@@ -55,18 +68,48 @@ func (c *RedisClient) Close() {
 	_ = c.conn.Close()
 }
 
-// AddHostMetaData serializes a Host struct with gob and stores it in Redis.
+// WithNamespace returns a client sharing c's connection whose job keys are
+// prefixed with ns. The empty namespace uses the unprefixed keys.
+func (c *RedisClient) WithNamespace(ns string) Cache {
+	n := *c
+	n.ns = ns
+	return &n
+}
+
+func (c *RedisClient) Namespace() string {
+	return c.ns
+}
+
+// key returns the namespaced name of a job key.
+func (c *RedisClient) key(name string) string {
+	if c.ns == "" {
+		return name
+	}
+	return c.ns + ":" + name
+}
+
+// hostCacheVersion is the version of the JSON host encoding. Entries with
+// another version are treated as cache misses and reloaded from Postgres.
+const hostCacheVersion = 1
+
+// hostRecord is the versioned envelope of a host in the "hosts" hash.
+type hostRecord struct {
+	Version int          `json:"v"`
+	Host    *entity.Host `json:"host"`
+}
+
+// AddHostMetaData stores host as versioned JSON in Redis.
 func (c *RedisClient) AddHostMetaData(ctx context.Context, h string, host *entity.Host) error {
 	if h == "" || host == nil {
 		return fmt.Errorf("invalid host metadata: host key and Host struct cannot be empty")
 	}
 
-	var buf bytes.Buffer
-	if err := gob.NewEncoder(&buf).Encode(host); err != nil {
+	b, err := json.Marshal(hostRecord{Version: hostCacheVersion, Host: host})
+	if err != nil {
 		return fmt.Errorf("encode metadata: %w", err)
 	}
 
-	err := c.conn.HSet(ctx, "hosts", h, buf.Bytes()).Err()
+	err = c.conn.HSet(ctx, "hosts", h, b).Err()
 	if err != nil {
 		return fmt.Errorf("store metadata: %w", err)
 	}
@@ -74,7 +117,8 @@ func (c *RedisClient) AddHostMetaData(ctx context.Context, h string, host *entit
 	return nil
 }
 
-// GetHostMetaData retrieves and decodes a Host struct from Redis.
+// GetHostMetaData retrieves and decodes a Host from Redis. Entries in a
+// legacy or unknown encoding are reported as missing.
 func (c *RedisClient) GetHostMetaData(ctx context.Context, h string) (*entity.Host, bool, error) {
 	val, err := c.conn.HGet(ctx, "hosts", h).Bytes()
 	if err == redis.Nil {
@@ -85,50 +129,158 @@ func (c *RedisClient) GetHostMetaData(ctx context.Context, h string) (*entity.Ho
 		return nil, false, fmt.Errorf("retrieve host metadata: %w", err)
 	}
 
-	var host entity.Host
-	if err := gob.NewDecoder(bytes.NewReader(val)).Decode(&host); err != nil {
-		return nil, false, fmt.Errorf("decode host metadata: %w", err)
+	host, ok := decodeHost(val)
+	return host, ok, nil
+}
+
+// SetRobots stores the robots.txt rules of an origin in the "robots" hash.
+func (c *RedisClient) SetRobots(ctx context.Context, r *entity.RobotsRules) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encode robots rules: %w", err)
 	}
+	if err := c.conn.HSet(ctx, "robots", r.Origin, b).Err(); err != nil {
+		return fmt.Errorf("store robots rules: %w", err)
+	}
+	return nil
+}
 
-	return &host, true, nil
+// GetRobots returns the cached robots.txt rules of origin.
+func (c *RedisClient) GetRobots(ctx context.Context, origin string) (*entity.RobotsRules, bool, error) {
+	val, err := c.conn.HGet(ctx, "robots", origin).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("retrieve robots rules: %w", err)
+	}
+
+	var r entity.RobotsRules
+	if err := json.Unmarshal(val, &r); err != nil {
+		return nil, false, nil
+	}
+	return &r, true, nil
 }
 
-func (c *RedisClient) GetUrl(ctx context.Context) (string, bool, error) {
-	script := redis.NewScript(`
-	local res = redis.call("zpopmax", KEYS[1])
-	if not res[1] then
-		return false
-	end
-	local url = res[1]
-	local score = res[2]
+func decodeHost(val []byte) (*entity.Host, bool) {
+	var rec hostRecord
+	if err := json.Unmarshal(val, &rec); err != nil {
+		return nil, false
+	}
+	if rec.Version != hostCacheVersion || rec.Host == nil {
+		return nil, false
+	}
+	return rec.Host, true
+}
 
-	if redis.call("sismember", KEYS[2], url) == 1 then
-		return false
+// LegacyHosts returns the hosts still stored gob-encoded, as written by
+// earlier versions of the spider, once each, and the fields whose value
+// is neither JSON nor a gob-encoded host.
+func (c *RedisClient) LegacyHosts(ctx context.Context) ([]*entity.Host, []string, error) {
+	var (
+		hosts  []*entity.Host
+		failed []string
+	)
+	// HSCAN may return a field more than once
+	seen := map[string]bool{}
+
+	iter := c.conn.HScan(ctx, "hosts", 0, "", 500).Iterator()
+	for iter.Next(ctx) {
+		name := iter.Val()
+		if !iter.Next(ctx) { // HSCAN yields field and value in turn
+			break
+		}
+		val := []byte(iter.Val())
+		if len(val) > 0 && val[0] == '{' {
+			continue
+		}
+
+		var host entity.Host
+		if err := gob.NewDecoder(bytes.NewReader(val)).Decode(&host); err != nil {
+			failed = append(failed, name)
+			continue
+		}
+		if host.Name == "" {
+			host.Name = name
+		}
+		if seen[host.Name] {
+			continue
+		}
+		seen[host.Name] = true
+		hosts = append(hosts, &host)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, nil, fmt.Errorf("scan hosts: %w", err)
+	}
+	return hosts, failed, nil
+}
+
+// getUrlScript pops URLs from the partitions KEYS[2:], tried in turn from
+// the ARGV[1]-th, and returns the first one not in the visited set
+// KEYS[1] with its score, after adding it there. It gives up after
+// ARGV[2] visited URLs.
+var getUrlScript = redis.NewScript(`
+local n = #KEYS - 1
+local start = tonumber(ARGV[1])
+local budget = tonumber(ARGV[2])
+for i = 0, n - 1 do
+	local key = KEYS[2 + (start + i) % n]
+	while budget > 0 do
+		local res = redis.call("zpopmax", key)
+		if not res[1] then
+			break
+		end
+		budget = budget - 1
+		if redis.call("sadd", KEYS[1], res[1]) == 1 then
+			return res
+		end
 	end
+end
+return false
+`)
+
+// maxVisitedPops bounds the visited URLs GetUrl discards in one call.
+const maxVisitedPops = 100
+
+// GetUrl pops the highest-scored unvisited URL of the first non-empty
+// partition among partitions, starting from a random one so crawlers
+// spread over them. It marks the URL visited so it is not queued again
+// while it is crawled, and returns it with its score.
+func (c *RedisClient) GetUrl(ctx context.Context, partitions []int) (string, float64, bool, error) {
+	if len(partitions) == 0 {
+		return "", 0, false, nil
+	}
 
-	return url
-	`)
+	keys := make([]string, 0, len(partitions)+1)
+	keys = append(keys, c.key("visitedUrls"))
+	for _, p := range partitions {
+		keys = append(keys, c.frontierKey(p))
+	}
 
 	var err error
-	var val any
-	for i := 0; i < c.maxRetry; i++ {
-		val, err = script.Run(ctx, c.conn, []string{"urls", "visitedUrls"}).Result()
+	for range c.maxRetry {
+		var val any
+		val, err = getUrlScript.Run(ctx, c.conn, keys, rand.IntN(len(partitions)), maxVisitedPops).Result()
+		if err == redis.Nil {
+			return "", 0, false, nil
+		}
 		if err != nil {
 			// on error, wait and retry
-			time.Sleep(10 * time.Millisecond)
+			time.Sleep(time.Duration(c.delay) * time.Millisecond)
 			continue
 		}
 
-		if valStr, ok := val.(string); ok && valStr != "" {
-			return valStr, true, nil
-		} else {
-			err = fmt.Errorf("script returned non-string or empty value: %v", val)
+		res, ok := val.([]any)
+		if !ok || len(res) != 2 {
+			return "", 0, false, fmt.Errorf("script returned unexpected value: %v", val)
 		}
-
-		time.Sleep(time.Duration(c.delay) * time.Millisecond)
+		u, _ := res[0].(string)
+		raw, _ := res[1].(string)
+		score, _ := strconv.ParseFloat(raw, 64)
+		return u, score, true, nil
 	}
 
-	return "", false, fmt.Errorf("no valid URL after %d retries err: %w", c.maxRetry, err)
+	return "", 0, false, fmt.Errorf("pop URL after %d retries: %w", c.maxRetry, err)
 }
 
 // AddUrls adds multiple URLs to Redis sorted set.
@@ -151,16 +303,29 @@ func (c *RedisClient) GetUrl(ctx context.Context) (string, bool, error) {
 // 	return nil
 // }
 
+// AddUrls adds unvisited URLs to the frontier, incrementing their score by 1.
 func (c *RedisClient) AddUrls(ctx context.Context, urls []string) error {
-	if len(urls) == 0 {
+	entries := make([]frontier.Entry, len(urls))
+	for i, u := range urls {
+		entries[i] = frontier.Entry{URL: u, Score: 1, Mode: frontier.Incr}
+	}
+	return c.AddEntries(ctx, entries)
+}
+
+// AddEntries applies scored entries to their frontier partitions. Visited
+// URLs are skipped unless the entry asks for a recrawl, in which case the
+// URL is removed from the visited set. The publication dates of queued
+// entries are recorded for TakePublished.
+func (c *RedisClient) AddEntries(ctx context.Context, entries []frontier.Entry) error {
+	if len(entries) == 0 {
 		return nil
 	}
 
 	pipe := c.conn.Pipeline()
 
-	cmds := make([]*redis.BoolCmd, len(urls))
-	for i, u := range urls {
-		cmds[i] = pipe.SIsMember(ctx, "visitedUrls", u)
+	cmds := make([]*redis.BoolCmd, len(entries))
+	for i, e := range entries {
+		cmds[i] = pipe.SIsMember(ctx, c.key("visitedUrls"), e.URL)
 	}
 
 	if _, err := pipe.Exec(ctx); err != nil {
@@ -169,14 +334,35 @@ func (c *RedisClient) AddUrls(ctx context.Context, urls []string) error {
 
 	pipe = c.conn.Pipeline()
 
-	for i, u := range urls {
+	for i, e := range entries {
 		visited, err := cmds[i].Result()
 		if err != nil {
 			return err
 		}
 
-		if !visited {
-			pipe.ZIncrBy(ctx, "urls", 1, u)
+		if visited {
+			if !e.Recrawl {
+				continue
+			}
+			pipe.SRem(ctx, c.key("visitedUrls"), e.URL)
+		}
+
+		p, ok := c.urlPartition(e.URL)
+		if !ok {
+			continue
+		}
+		key := c.frontierKey(p)
+		if !e.Published.IsZero() {
+			pipe.HSet(ctx, c.key("published"), e.URL, e.Published.Unix())
+		}
+		z := redis.Z{Score: e.Score, Member: e.URL}
+		switch e.Mode {
+		case frontier.Max:
+			pipe.ZAddGT(ctx, key, z)
+		case frontier.SetIfNew:
+			pipe.ZAddNX(ctx, key, z)
+		default:
+			pipe.ZIncrBy(ctx, key, e.Score, e.URL)
 		}
 	}
 
@@ -184,14 +370,126 @@ func (c *RedisClient) AddUrls(ctx context.Context, urls []string) error {
 	return err
 }
 
-// AddToVisitedUrl adds a URL to the visitedUrls set.
-func (c *RedisClient) MarkVisited(ctx context.Context, u string) error {
-	if u == "" {
+// NextHostSeq increments the per-host counter of every URL's host and
+// returns the new values in order.
+func (c *RedisClient) NextHostSeq(ctx context.Context, urls []string) ([]int64, error) {
+	pipe := c.conn.Pipeline()
+	cmds := make([]*redis.IntCmd, len(urls))
+	for i, raw := range urls {
+		host := ""
+		if u, err := url.Parse(raw); err == nil {
+			host = u.Host
+		}
+		cmds[i] = pipe.HIncrBy(ctx, c.key("hostSeq"), host, 1)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("increment host sequence: %w", err)
+	}
+
+	seqs := make([]int64, len(urls))
+	for i, cmd := range cmds {
+		seqs[i] = cmd.Val()
+	}
+	return seqs, nil
+}
+
+// setHopsScript lowers the hop count of each URL in ARGV[2:] to ARGV[1].
+var setHopsScript = redis.NewScript(`
+	local hops = tonumber(ARGV[1])
+	for i = 2, #ARGV do
+		local cur = redis.call("hget", KEYS[1], ARGV[i])
+		if not cur or tonumber(cur) > hops then
+			redis.call("hset", KEYS[1], ARGV[i], hops)
+		end
+	end
+	return 0
+	`)
+
+// Hops returns the off-topic hop count recorded for u, 0 if none.
+func (c *RedisClient) Hops(ctx context.Context, u string) (int, error) {
+	hops, err := c.conn.HGet(ctx, c.key("focusHops"), u).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get focus hops: %w", err)
+	}
+	return hops, nil
+}
+
+// SetHops records the off-topic hop count of urls, keeping the lowest.
+func (c *RedisClient) SetHops(ctx context.Context, urls []string, hops int) error {
+	if len(urls) == 0 {
 		return nil
 	}
 
-	err := c.conn.SAdd(ctx, "visitedUrls", u).Err()
+	args := make([]any, 0, len(urls)+1)
+	args = append(args, hops)
+	for _, u := range urls {
+		args = append(args, u)
+	}
+	if err := setHopsScript.Run(ctx, c.conn, []string{c.key("focusHops")}, args...).Err(); err != nil && err != redis.Nil {
+		return fmt.Errorf("set focus hops: %w", err)
+	}
+	return nil
+}
+
+// LastCrawled returns the last crawl time of the URLs that were crawled.
+func (c *RedisClient) LastCrawled(ctx context.Context, urls []string) (map[string]time.Time, error) {
+	if len(urls) == 0 {
+		return map[string]time.Time{}, nil
+	}
+
+	vals, err := c.conn.HMGet(ctx, c.key("crawledAt"), urls...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get last crawl times: %w", err)
+	}
+
+	m := make(map[string]time.Time, len(urls))
+	for i, v := range vals {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+			m[urls[i]] = time.Unix(ts, 0)
+		}
+	}
+	return m, nil
+}
+
+// TakePublished returns and forgets the publication date recorded for u
+// when it was queued. Crawlers take it as soon as they pop u, so dates are
+// only kept for queued URLs.
+func (c *RedisClient) TakePublished(ctx context.Context, u string) (time.Time, bool, error) {
+	pipe := c.conn.TxPipeline()
+	get := pipe.HGet(ctx, c.key("published"), u)
+	pipe.HDel(ctx, c.key("published"), u)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return time.Time{}, false, fmt.Errorf("take publication date: %w", err)
+	}
+
+	ts, err := get.Int64()
 	if err != nil {
+		return time.Time{}, false, nil
+	}
+	return time.Unix(ts, 0).UTC(), true, nil
+}
+
+// MarkVisited adds a URL to the visitedUrls set and, with recordCrawl,
+// records now as its last crawl time for LastCrawled.
+func (c *RedisClient) MarkVisited(ctx context.Context, u string, recordCrawl bool) error {
+	if u == "" {
+		return nil
+	}
+
+	pipe := c.conn.TxPipeline()
+	pipe.SAdd(ctx, c.key("visitedUrls"), u)
+	if recordCrawl {
+		pipe.HSet(ctx, c.key("crawledAt"), u, time.Now().Unix())
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
 		return fmt.Errorf("add to visited URLs: %w", err)
 	}
 
@@ -211,11 +509,147 @@ func (c *RedisClient) AddToWaitedHost(ctx context.Context, h string, delay int)
 	return nil
 }
 
-// CountUrls returns the number of URLs in the sorted set.
+// CountUrls returns the number of URLs across all frontier partitions.
 func (c *RedisClient) CountUrls(ctx context.Context) int64 {
-	count, err := c.conn.ZCard(ctx, "urls").Result()
+	pipe := c.conn.Pipeline()
+	cmds := make([]*redis.IntCmd, c.partitions)
+	for p := range c.partitions {
+		cmds[p] = pipe.ZCard(ctx, c.frontierKey(p))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0
+	}
+
+	var count int64
+	for _, cmd := range cmds {
+		count += cmd.Val()
+	}
+	return count
+}
+
+// CountVisited returns the number of URLs in the visitedUrls set.
+func (c *RedisClient) CountVisited(ctx context.Context) int64 {
+	count, err := c.conn.SCard(ctx, c.key("visitedUrls")).Result()
 	if err != nil {
 		return 0
 	}
 	return count
 }
+
+// IncrPages counts a crawled page towards the job's page budget and
+// returns the new total.
+func (c *RedisClient) IncrPages(ctx context.Context) (int64, error) {
+	n, err := c.conn.Incr(ctx, c.key("pagesCrawled")).Result()
+	if err != nil {
+		return 0, fmt.Errorf("count crawled page: %w", err)
+	}
+	return n, nil
+}
+
+// CountPages returns how many pages the job crawled across all instances.
+func (c *RedisClient) CountPages(ctx context.Context) (int64, error) {
+	n, err := c.conn.Get(ctx, c.key("pagesCrawled")).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get crawled pages: %w", err)
+	}
+	return n, nil
+}
+
+// claimHostScript sets the waited-host key KEYS[1] for ARGV[1]
+// milliseconds unless it is already set, and returns how many
+// milliseconds it has left then, or 0 when the host was claimed.
+var claimHostScript = redis.NewScript(`
+local ttl = redis.call("pttl", KEYS[1])
+if ttl > 0 then
+	return ttl
+end
+redis.call("set", KEYS[1], 1, "px", ARGV[1])
+return 0
+`)
+
+// ClaimHost reserves host h for one fetch by starting its crawl delay, the
+// way AddToWaitedHost does, unless the delay of a previous fetch has not
+// expired: then it returns how long is left and claims nothing. Crawlers
+// of every instance go through the same key, so only one of them gets the
+// host per delay.
+func (c *RedisClient) ClaimHost(ctx context.Context, h string, delay time.Duration) (time.Duration, error) {
+	if h == "" {
+		return 0, fmt.Errorf("empty host cannot be claimed")
+	}
+	if delay < time.Millisecond {
+		return 0, nil
+	}
+
+	left, err := claimHostScript.Run(ctx, c.conn, []string{h}, delay.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("claim host: %w", err)
+	}
+	return time.Duration(left) * time.Millisecond, nil
+}
+
+// scanHostUrls calls fn with every frontier URL that belongs to host h.
+func (c *RedisClient) scanHostUrls(ctx context.Context, h string, fn func(u string) error) error {
+	match := "*://" + globEscape(h) + "*"
+	key := c.frontierKey(Partition(h, c.partitions))
+	iter := c.conn.ZScan(ctx, key, 0, match, 500).Iterator()
+
+	// ZSCAN yields member, score pairs
+	isMember := true
+	for iter.Next(ctx) {
+		if isMember {
+			raw := iter.Val()
+			if u, err := url.Parse(raw); err == nil && u.Host == h {
+				if err := fn(raw); err != nil {
+					return err
+				}
+			}
+		}
+		isMember = !isMember
+	}
+
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("scan frontier: %w", err)
+	}
+	return nil
+}
+
+// CountHostUrls returns the number of frontier URLs that belong to host h.
+func (c *RedisClient) CountHostUrls(ctx context.Context, h string) (int64, error) {
+	var n int64
+	err := c.scanHostUrls(ctx, h, func(string) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// PurgeHost removes every frontier URL that belongs to host h and returns
+// how many were removed.
+func (c *RedisClient) PurgeHost(ctx context.Context, h string) (int64, error) {
+	var urls []any
+	if err := c.scanHostUrls(ctx, h, func(u string) error {
+		urls = append(urls, u)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	if len(urls) == 0 {
+		return 0, nil
+	}
+
+	key := c.frontierKey(Partition(h, c.partitions))
+	n, err := c.conn.ZRem(ctx, key, urls...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("purge host urls: %w", err)
+	}
+	return n, nil
+}
+
+func globEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+	return r.Replace(s)
+}
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The frontier is split into partitions by host. Each partition is leased
+// by exactly one spider instance at a time, so a host is only ever crawled,
+// rate-limited and updated by a single instance.
+const (
+	instancesKey    = "instances"
+	partitionPrefix = "partition:"
+	frontierPrefix  = "urls:"
+	legacyFrontier  = "urls"
+)
+
+var (
+	renewLeaseScript = redis.NewScript(`
+	if redis.call("get", KEYS[1]) == ARGV[1] then
+		return redis.call("pexpire", KEYS[1], ARGV[2])
+	end
+	return 0
+	`)
+
+	releaseLeaseScript = redis.NewScript(`
+	if redis.call("get", KEYS[1]) == ARGV[1] then
+		return redis.call("del", KEYS[1])
+	end
+	return 0
+	`)
+)
+
+// Partition returns the frontier partition a host belongs to.
+func Partition(host string, partitions int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(host))
+	return int(h.Sum32() % uint32(partitions))
+}
+
+func (c *RedisClient) frontierKey(p int) string {
+	return c.key(frontierPrefix + strconv.Itoa(p))
+}
+
+func (c *RedisClient) partitionKey(p int) string {
+	return c.key(partitionPrefix + strconv.Itoa(p))
+}
+
+// urlPartition returns the partition of a URL's host, or false if the URL
+// cannot be parsed.
+func (c *RedisClient) urlPartition(raw string) (int, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return 0, false
+	}
+	return Partition(u.Host, c.partitions), true
+}
+
+func (c *RedisClient) Partitions() int {
+	return c.partitions
+}
+
+// Heartbeat records that the instance is alive and drops instances whose
+// last heartbeat is older than ttl. It returns the number of live instances.
+func (c *RedisClient) Heartbeat(ctx context.Context, id string, ttl time.Duration) (int64, error) {
+	now := time.Now()
+	pipe := c.conn.TxPipeline()
+	pipe.ZAdd(ctx, c.key(instancesKey), redis.Z{Score: float64(now.UnixMilli()), Member: id})
+	pipe.ZRemRangeByScore(ctx, c.key(instancesKey), "-inf",
+		strconv.FormatInt(now.Add(-ttl).UnixMilli(), 10))
+	count := pipe.ZCard(ctx, c.key(instancesKey))
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("heartbeat: %w", err)
+	}
+	return count.Val(), nil
+}
+
+// Deregister removes the instance from the live set.
+func (c *RedisClient) Deregister(ctx context.Context, id string) error {
+	if err := c.conn.ZRem(ctx, c.key(instancesKey), id).Err(); err != nil {
+		return fmt.Errorf("deregister instance: %w", err)
+	}
+	return nil
+}
+
+// AcquirePartition leases partition p to instance id if it is free.
+func (c *RedisClient) AcquirePartition(ctx context.Context, p int, id string, ttl time.Duration) (bool, error) {
+	ok, err := c.conn.SetNX(ctx, c.partitionKey(p), id, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("acquire partition %d: %w", p, err)
+	}
+	return ok, nil
+}
+
+// RenewPartition extends the lease on p. It returns false if the lease
+// expired and was taken by another instance.
+func (c *RedisClient) RenewPartition(ctx context.Context, p int, id string, ttl time.Duration) (bool, error) {
+	n, err := renewLeaseScript.Run(ctx, c.conn,
+		[]string{c.partitionKey(p)}, id, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("renew partition %d: %w", p, err)
+	}
+	return n == 1, nil
+}
+
+// ReleasePartition gives up the lease on p if instance id still holds it.
+func (c *RedisClient) ReleasePartition(ctx context.Context, p int, id string) error {
+	if err := releaseLeaseScript.Run(ctx, c.conn, []string{c.partitionKey(p)}, id).Err(); err != nil {
+		return fmt.Errorf("release partition %d: %w", p, err)
+	}
+	return nil
+}
+
+// MigrateLegacyFrontier moves URLs from the single pre-partitioning "urls"
+// zset into their partitions and returns how many it moved and how many it
+// left there because their host cannot be parsed. A URL already in its
+// partition keeps the higher of its two scores. Each batch is added to the
+// partitions and removed from the legacy zset in one transaction, so a
+// crash loses nothing.
+func (c *RedisClient) MigrateLegacyFrontier(ctx context.Context) (moved, kept int, err error) {
+	const batch = 500
+	for {
+		// the members left behind outrank the rest, skip them
+		res, err := c.conn.ZRevRangeWithScores(ctx, c.key(legacyFrontier), int64(kept), int64(kept+batch-1)).Result()
+		if err != nil {
+			return moved, kept, fmt.Errorf("migrate legacy frontier: %w", err)
+		}
+		if len(res) == 0 {
+			return moved, kept, nil
+		}
+
+		partitions := map[int][]redis.Z{}
+		var done []any
+		for _, z := range res {
+			raw, _ := z.Member.(string)
+			p, ok := c.urlPartition(raw)
+			if !ok {
+				kept++
+				continue
+			}
+			partitions[p] = append(partitions[p], z)
+			done = append(done, raw)
+		}
+		if len(done) == 0 {
+			continue
+		}
+
+		pipe := c.conn.TxPipeline()
+		for p, members := range partitions {
+			pipe.ZAddGT(ctx, c.frontierKey(p), members...)
+		}
+		pipe.ZRem(ctx, c.key(legacyFrontier), done...)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return moved, kept, fmt.Errorf("migrate legacy frontier: %w", err)
+		}
+		moved += len(done)
+	}
+}
@@ -6,9 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"strings"
+	"sort"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"github.com/Hassan-ach/boogle/services/spider/internal/config"
 	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
@@ -26,7 +27,7 @@ func NewDbClient(conf config.PSQLConfig) *SQLClient {
 		conf.Host,
 		conf.Port,
 		conf.User,
-		conf.Password,
+		string(conf.Password),
 		conf.DBname,
 	)
 
@@ -79,130 +80,640 @@ func (c *SQLClient) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error
 	return nil
 }
 
-// Page stores a crawled page in the "pages" table.
-func (c *SQLClient) InsertPage(ctx context.Context, tx *sql.Tx, page *entity.Page) error {
-	var url_id string
-	err := tx.QueryRowContext(ctx,
-		`WITH ins AS (
-		    INSERT INTO urls(url)
-		    VALUES ($1)
-		    ON CONFLICT (url) DO NOTHING
-		    RETURNING id
+// Batch is the set of rows written to Postgres in one transaction.
+type Batch struct {
+	Pages     []*entity.Page
+	Skipped   []*entity.Page // left out of the index: pages stored for their URLs are deleted
+	Hosts     []*entity.Host // at most one entry per host name
+	Fetches   []entity.Fetch
+	Deferrals []entity.Deferral // politeness deferrals, counted in host statistics
+
+	Events bool // record page and edge events in the outbox
+}
+
+// BatchResult counts the pages of a batch that were not stored again.
+type BatchResult struct {
+	Unchanged  int // recrawled with the content hash already stored
+	Duplicates int // new URLs recorded as aliases of a page with the same content
+}
+
+// InsertBatch writes pages, the URLs they link to, their graph edges, host
+// metadata, fetch log entries and host statistics in one transaction. Rows
+// are passed as arrays and expanded with unnest, so the whole batch takes a
+// handful of round trips whatever its size. Pages stored for the URLs of
+// b.Skipped are deleted, and b.Pages are deduplicated on their content hash,
+// see sortPages. With b.Events, the pages created, updated and deleted and
+// the edges added are recorded in the event outbox by the same transaction.
+func (c *SQLClient) InsertBatch(ctx context.Context, b Batch) (BatchResult, error) {
+	var res BatchResult
+	if len(b.Pages) == 0 && len(b.Skipped) == 0 && len(b.Hosts) == 0 && len(b.Fetches) == 0 && len(b.Deferrals) == 0 {
+		return res, nil
+	}
+
+	err := c.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := c.upsertHosts(ctx, tx, b.Hosts); err != nil {
+			return err
+		}
+		skippedIDs, deleted, err := c.deletePages(ctx, tx, b.Skipped)
+		if err != nil {
+			return err
+		}
+		var events []entity.Event
+		if b.Events {
+			events, err = pageEvents(entity.EventPageDeleted, b.Skipped, skippedIDs, deleted)
+			if err != nil {
+				return err
+			}
+		}
+
+		w, err := c.sortPages(ctx, tx, b.Pages)
+		if err != nil {
+			return err
+		}
+		res = BatchResult{Unchanged: len(w.unchanged), Duplicates: len(w.aliases)}
+		if err := c.upsertHostStats(ctx, tx, hostStatsDeltas(b.Fetches, b.Deferrals, w)); err != nil {
+			return err
+		}
+		b.Pages = w.stored()
+
+		urls := batchURLs(b)
+		if len(urls) == 0 {
+			if err := c.insertFetches(ctx, tx, b.Fetches); err != nil {
+				return err
+			}
+			return c.insertEvents(ctx, tx, events)
+		}
+		ids, err := c.upsertURLs(ctx, tx, urls)
+		if err != nil {
+			return err
+		}
+		created, err := c.insertPages(ctx, tx, w.added, ids)
+		if err != nil {
+			return err
+		}
+		updated, err := c.updatePages(ctx, tx, w.changed, ids)
+		if err != nil {
+			return err
+		}
+		if err := c.upsertAliases(ctx, tx, w.aliases, ids); err != nil {
+			return err
+		}
+		edges, err := c.insertEdges(ctx, tx, b.Pages, ids)
+		if err != nil {
+			return err
+		}
+		// after the pages, so their fetches are linked to their URLs
+		if err := c.insertFetches(ctx, tx, b.Fetches); err != nil {
+			return err
+		}
+		if !b.Events {
+			return nil
+		}
+
+		more, err := pageEvents(entity.EventPageCreated, w.added, ids, created)
+		if err != nil {
+			return err
+		}
+		events = append(events, more...)
+		more, err = pageEvents(entity.EventPageUpdated, w.changed, ids, updated)
+		if err != nil {
+			return err
+		}
+		events = append(events, more...)
+		if ev, ok, err := edgesEvent(b.Pages, ids, edges); err != nil {
+			return err
+		} else if ok {
+			events = append(events, ev)
+		}
+		return c.insertEvents(ctx, tx, events)
+	})
+	if err != nil {
+		return BatchResult{}, err
+	}
+	return res, nil
+}
+
+// batchURLs returns the distinct page and link URLs of a batch, sorted so
+// concurrent batches lock rows in the same order. Fetched URLs are left
+// out: those of pages are among them, the others are not pages.
+func batchURLs(b Batch) []string {
+	set := map[string]struct{}{}
+	for _, p := range b.Pages {
+		set[p.URL] = struct{}{}
+		for _, l := range p.Links {
+			set[l] = struct{}{}
+		}
+		for _, l := range p.DemotedLinks {
+			set[l] = struct{}{}
+		}
+	}
+
+	urls := make([]string, 0, len(set))
+	for u := range set {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// upsertURLs inserts missing URLs and returns the id of every URL.
+func (c *SQLClient) upsertURLs(ctx context.Context, tx *sql.Tx, urls []string) (map[string]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		WITH ins AS (
+			INSERT INTO urls (url)
+			SELECT unnest($1::text[])
+			ON CONFLICT (url) DO NOTHING
+			RETURNING id, url
 		)
-		SELECT id FROM ins
+		SELECT id, url FROM ins
 		UNION ALL
-		SELECT id FROM urls WHERE url = $1
-		LIMIT 1;`,
-		page.URL).Scan(&url_id)
+		SELECT id, url FROM urls WHERE url = ANY($1::text[])`,
+		pq.Array(urls))
 	if err != nil {
-		return fmt.Errorf("upsert url: %w", err)
+		return nil, fmt.Errorf("upsert urls: %w", err)
 	}
+	defer func() { _ = rows.Close() }()
 
-	metadata, err := json.Marshal(page.MetaData)
+	ids := make(map[string]string, len(urls))
+	for rows.Next() {
+		var id, u string
+		if err := rows.Scan(&id, &u); err != nil {
+			return nil, fmt.Errorf("scan url id: %w", err)
+		}
+		ids[u] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("upsert urls: %w", err)
+	}
+	return ids, nil
+}
+
+// insertPages inserts the pages of new URLs and returns the id of each
+// page inserted by URL id. Pages inserted meanwhile by another instance
+// are left alone.
+func (c *SQLClient) insertPages(
+	ctx context.Context,
+	tx *sql.Tx,
+	pages []*entity.Page,
+	ids map[string]string,
+) (map[string]string, error) {
+	if len(pages) == 0 {
+		return nil, nil
+	}
+
+	r, err := newPageRows(pages, ids)
 	if err != nil {
-		return fmt.Errorf("marshal metadata: %w", err)
+		return nil, err
 	}
 
-	_, err = tx.ExecContext(ctx,
-		`INSERT INTO pages(url_id, html, metadata) VALUES ($1,$2,$3)
-			ON CONFLICT (url_id) DO NOTHING`,
-		url_id,
-		page.HTML,
-		metadata,
+	rows, err := tx.QueryContext(ctx, `
+		INSERT INTO pages (url_id, html, metadata, content_hash, warc_file, warc_offset, language)
+		SELECT * FROM unnest($1::uuid[], $2::text[], $3::jsonb[], $4::text[], $5::text[], $6::bigint[], $7::text[])
+		ON CONFLICT (url_id) DO NOTHING
+		RETURNING url_id, id`,
+		pq.Array(r.urlIDs),
+		pq.Array(r.htmls),
+		pq.Array(r.metadata),
+		pq.Array(r.hashes),
+		pq.Array(r.warcFiles),
+		pq.Array(r.warcOffsets),
+		pq.Array(r.languages),
 	)
 	if err != nil {
-		return fmt.Errorf("insert page : %w", err)
+		return nil, fmt.Errorf("insert pages: %w", err)
+	}
+	pageIDs, err := scanPageIDs(rows)
+	if err != nil {
+		return nil, fmt.Errorf("insert pages: %w", err)
 	}
 
-	return nil
+	// a URL that was an alias has content of its own again, unless its
+	// page was not inserted
+	inserted := make([]string, 0, len(pageIDs))
+	for urlID := range pageIDs {
+		inserted = append(inserted, urlID)
+	}
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM page_aliases WHERE url_id = ANY($1::uuid[])`,
+		pq.Array(inserted))
+	if err != nil {
+		return nil, fmt.Errorf("delete page aliases: %w", err)
+	}
+	return pageIDs, nil
+}
+
+// scanPageIDs reads (url_id, id) rows into a map of page ids by URL id,
+// and closes rows.
+func scanPageIDs(rows *sql.Rows) (map[string]string, error) {
+	defer func() { _ = rows.Close() }()
+
+	ids := map[string]string{}
+	for rows.Next() {
+		var urlID, id string
+		if err := rows.Scan(&urlID, &id); err != nil {
+			return nil, err
+		}
+		ids[urlID] = id
+	}
+	return ids, rows.Err()
 }
 
-// InsertGraphEdges from page id → many page ids
-// - batch-inserts edges using IDs
-func (c *SQLClient) InsertGraphEdges(
+// deletePages removes the pages, and the aliases, stored for the URLs of
+// pages left out of the index, e.g. recrawls that became soft 404s. Their
+// words go with them. It returns the URL id of each URL with a page, and
+// the id of each page deleted by URL id.
+func (c *SQLClient) deletePages(
 	ctx context.Context,
 	tx *sql.Tx,
-	from_url_id string,
-	to_url_ids []string,
-) error {
-	if len(to_url_ids) == 0 {
-		return nil
+	pages []*entity.Page,
+) (map[string]string, map[string]string, error) {
+	if len(pages) == 0 {
+		return nil, nil, nil
 	}
 
-	var (
-		placeholders []string
-		args         []any
-	)
+	urls := make([]string, len(pages))
+	for i, p := range pages {
+		urls[i] = p.URL
+	}
+	rows, err := tx.QueryContext(ctx, `
+		WITH aliases AS (
+			DELETE FROM page_aliases a USING urls u
+			WHERE a.url_id = u.id AND u.url = ANY($1::text[])
+		)
+		DELETE FROM pages p USING urls u
+		WHERE p.url_id = u.id AND u.url = ANY($1::text[])
+		RETURNING u.url, u.id, p.id`,
+		pq.Array(urls))
+	if err != nil {
+		return nil, nil, fmt.Errorf("delete skipped pages: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
 
-	for _, to_url_id := range to_url_ids {
-		placeholders = append(placeholders, fmt.Sprintf("($%d, $%d)", len(args)+1, len(args)+2))
-		args = append(args, from_url_id, to_url_id)
+	ids, pageIDs := map[string]string{}, map[string]string{}
+	for rows.Next() {
+		var u, urlID, pageID string
+		if err := rows.Scan(&u, &urlID, &pageID); err != nil {
+			return nil, nil, fmt.Errorf("scan deleted page: %w", err)
+		}
+		ids[u] = urlID
+		pageIDs[urlID] = pageID
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("delete skipped pages: %w", err)
+	}
+	return ids, pageIDs, nil
+}
 
-	query := `INSERT INTO graph_edges (from_url, to_url) VALUES ` +
-		strings.Join(placeholders, ", ") +
-		` ON CONFLICT DO NOTHING`
+// updatePages replaces the content of recrawled pages and queues them for
+// indexing again. It returns the id of each page by URL id.
+func (c *SQLClient) updatePages(
+	ctx context.Context,
+	tx *sql.Tx,
+	pages []*entity.Page,
+	ids map[string]string,
+) (map[string]string, error) {
+	if len(pages) == 0 {
+		return nil, nil
+	}
 
-	_, err := tx.ExecContext(ctx, query, args...)
+	r, err := newPageRows(pages, ids)
 	if err != nil {
-		return fmt.Errorf("batch insert graph_edges: %w", err)
+		return nil, err
 	}
 
-	return nil
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE pages SET
+			html = v.html,
+			metadata = v.metadata,
+			content_hash = v.content_hash,
+			warc_file = v.warc_file,
+			warc_offset = v.warc_offset,
+			language = v.language,
+			indexed = FALSE,
+			updated_at = NOW()
+		FROM unnest($1::uuid[], $2::text[], $3::jsonb[], $4::text[], $5::text[], $6::bigint[], $7::text[])
+			AS v(url_id, html, metadata, content_hash, warc_file, warc_offset, language)
+		WHERE pages.url_id = v.url_id
+		RETURNING pages.url_id, pages.id`,
+		pq.Array(r.urlIDs),
+		pq.Array(r.htmls),
+		pq.Array(r.metadata),
+		pq.Array(r.hashes),
+		pq.Array(r.warcFiles),
+		pq.Array(r.warcOffsets),
+		pq.Array(r.languages),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("update pages: %w", err)
+	}
+	pageIDs, err := scanPageIDs(rows)
+	if err != nil {
+		return nil, fmt.Errorf("update pages: %w", err)
+	}
+	return pageIDs, nil
 }
 
-// InsertURLs inserts or gets existing IDs — returns []string [from_url_id, to_url_ids...]
-func (c *SQLClient) InsertURLs(ctx context.Context, tx *sql.Tx, urls []string) ([]string, error) {
-	if len(urls) == 0 {
-		return make([]string, 0), nil
-	}
+// pageRows holds the columns of pages, as arrays for unnest.
+type pageRows struct {
+	urlIDs      []string
+	htmls       []string
+	metadata    []string
+	hashes      []sql.NullString
+	warcFiles   []sql.NullString
+	warcOffsets []sql.NullInt64
+	languages   []sql.NullString
+}
 
-	var values []string
-	args := make([]any, 0, len(urls))
+func newPageRows(pages []*entity.Page, ids map[string]string) (pageRows, error) {
+	r := pageRows{
+		urlIDs:      make([]string, len(pages)),
+		htmls:       make([]string, len(pages)),
+		metadata:    make([]string, len(pages)),
+		hashes:      make([]sql.NullString, len(pages)),
+		warcFiles:   make([]sql.NullString, len(pages)),
+		warcOffsets: make([]sql.NullInt64, len(pages)),
+		languages:   make([]sql.NullString, len(pages)),
+	}
 
-	for i, u := range urls {
-		values = append(values, fmt.Sprintf("($%d)", i+1))
-		args = append(args, u)
+	for i, p := range pages {
+		m, err := json.Marshal(p.MetaData)
+		if err != nil {
+			return pageRows{}, fmt.Errorf("marshal metadata: %w", err)
+		}
+		r.urlIDs[i] = ids[p.URL]
+		r.htmls[i] = string(p.HTML)
+		r.metadata[i] = string(m)
+		r.hashes[i] = sql.NullString{String: p.ContentHash, Valid: p.ContentHash != ""}
+		r.warcFiles[i] = sql.NullString{String: p.WarcFile, Valid: p.WarcFile != ""}
+		r.warcOffsets[i] = sql.NullInt64{Int64: p.WarcOffset, Valid: p.WarcFile != ""}
+		r.languages[i] = sql.NullString{String: p.Language, Valid: p.Language != ""}
 	}
+	return r, nil
+}
 
-	query := fmt.Sprintf(`
-		WITH input(url) AS (
-			SELECT DISTINCT url FROM (VALUES %s) AS v(url)
-		),
-		ins AS (
-		    INSERT INTO urls (url)
-		    SELECT url FROM input
-			ON CONFLICT (url) DO NOTHING
-		    RETURNING id, url
-		)
-		SELECT u.id
-		FROM input i
-		JOIN urls u ON u.url = i.url
-		`, strings.Join(values, ","))
+// insertEdges inserts the graph edges of pages and returns how many were
+// new, by URL id of the page they start from.
+func (c *SQLClient) insertEdges(
+	ctx context.Context,
+	tx *sql.Tx,
+	pages []*entity.Page,
+	ids map[string]string,
+) (map[string]int, error) {
+	var from, to []string
+	for _, p := range pages {
+		for _, l := range graphLinks(p) {
+			from = append(from, ids[p.URL])
+			to = append(to, ids[l])
+		}
+	}
+	if len(from) == 0 {
+		return nil, nil
+	}
 
-	rows, err := tx.QueryContext(ctx, query, args...)
+	rows, err := tx.QueryContext(ctx, `
+		INSERT INTO graph_edges (from_url, to_url)
+		SELECT * FROM unnest($1::uuid[], $2::uuid[])
+		ON CONFLICT DO NOTHING
+		RETURNING from_url`,
+		pq.Array(from),
+		pq.Array(to),
+	)
 	if err != nil {
-		return nil, fmt.Errorf("batch upsert query failed: %w", err)
+		return nil, fmt.Errorf("insert graph edges: %w", err)
 	}
 	defer func() { _ = rows.Close() }()
 
-	m := make([]string, 0, len(urls))
-
+	added := map[string]int{}
 	for rows.Next() {
 		var id string
 		if err := rows.Scan(&id); err != nil {
-			return nil, fmt.Errorf("scan failed: %w", err)
+			return nil, fmt.Errorf("scan graph edge: %w", err)
 		}
-		m = append(m, id)
+		added[id]++
 	}
-
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("insert graph edges: %w", err)
 	}
+	return added, nil
+}
 
-	// if len(m) != len(urls) {
-	// 	return nil, fmt.Errorf("got %d ids back, expected %d", len(m), len(urls))
-	// }
+// upsertHosts inserts or replaces host metadata. hosts must not contain
+// the same name twice.
+func (c *SQLClient) upsertHosts(ctx context.Context, tx *sql.Tx, hosts []*entity.Host) error {
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	var (
+		names        = make([]string, len(hosts))
+		allow        = make([]string, len(hosts))
+		disallow     = make([]string, len(hosts))
+		sitemaps     = make([]string, len(hosts))
+		delays       = make([]int64, len(hosts))
+		maxRetries   = make([]int64, len(hosts))
+		maxPages     = make([]int64, len(hosts))
+		pagesCrawled = make([]int64, len(hosts))
+		errorCounts  = make([]int64, len(hosts))
+		lastErrors   = make([]sql.NullString, len(hosts))
+		lastErrorAt  = make([]sql.NullTime, len(hosts))
+		robotsAt     = make([]sql.NullTime, len(hosts))
+		robotsExp    = make([]sql.NullTime, len(hosts))
+		robotsStatus = make([]int64, len(hosts))
+		disallowAll  = make([]bool, len(hosts))
+		probedAt     = make([]sql.NullTime, len(hosts))
+		probeStatus  = make([]int64, len(hosts))
+		probeURLs    = make([]sql.NullString, len(hosts))
+		probeTitles  = make([]sql.NullString, len(hosts))
+		probeHashes  = make([]int64, len(hosts))
+		softNotFound = make([]bool, len(hosts))
+		soft404Pages = make([]int64, len(hosts))
+		parked       = make([]bool, len(hosts))
+	)
+
+	for i, h := range hosts {
+		names[i] = h.Name
+		allow[i] = jsonList(h.AllowedUrls)
+		disallow[i] = jsonList(h.NotAllowedPaths)
+		sitemaps[i] = jsonList(h.Sitemaps)
+		delays[i] = int64(h.Delay)
+		maxRetries[i] = int64(h.MaxRetry)
+		maxPages[i] = int64(h.MaxPages)
+		pagesCrawled[i] = int64(h.PagesCrawled)
+		errorCounts[i] = int64(h.ErrorCount)
+		lastErrors[i] = sql.NullString{String: h.LastError, Valid: h.LastError != ""}
+		lastErrorAt[i] = nullTime(h.LastErrorAt)
+		robotsAt[i] = nullTime(h.RobotsFetchedAt)
+		robotsExp[i] = nullTime(h.RobotsExpiresAt)
+		robotsStatus[i] = int64(h.RobotsStatus)
+		disallowAll[i] = h.DisallowAll
+		probedAt[i] = nullTime(h.ProbedAt)
+		probeStatus[i] = int64(h.ProbeStatus)
+		probeURLs[i] = sql.NullString{String: h.ProbeURL, Valid: h.ProbeURL != ""}
+		probeTitles[i] = sql.NullString{String: h.ProbeTitle, Valid: h.ProbeTitle != ""}
+		probeHashes[i] = int64(h.ProbeHash) // BIGINT holds the bits of the uint64
+		softNotFound[i] = h.SoftNotFound
+		soft404Pages[i] = int64(h.SoftNotFoundPages)
+		parked[i] = h.Parked
+	}
+
+	// Probe results are only replaced by newer ones: snapshots queued by
+	// crawlers may predate a background probe.
+	const newerProbe = `(hosts.probed_at IS NULL OR EXCLUDED.probed_at >= hosts.probed_at)`
+
+	// Rule lists travel as JSON arrays: unnest would flatten a 2-D text[].
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO hosts (
+			name, allow, disallow, sitemaps, crawl_delay, max_retry, max_pages,
+			pages_crawled, error_count, last_error, last_error_at, robots_fetched_at,
+			robots_expires_at, robots_status, disallow_all, probed_at, probe_status,
+			probe_url, probe_title, probe_hash, soft_404, soft_404_pages, parked
+		)
+		SELECT
+			h.name,
+			ARRAY(SELECT jsonb_array_elements_text(h.allow)),
+			ARRAY(SELECT jsonb_array_elements_text(h.disallow)),
+			ARRAY(SELECT jsonb_array_elements_text(h.sitemaps)),
+			h.crawl_delay, h.max_retry, h.max_pages,
+			h.pages_crawled, h.error_count, h.last_error, h.last_error_at, h.robots_fetched_at,
+			h.robots_expires_at, h.robots_status, h.disallow_all, h.probed_at, h.probe_status,
+			h.probe_url, h.probe_title, h.probe_hash, h.soft_404, h.soft_404_pages, h.parked
+		FROM unnest(
+			$1::text[], $2::jsonb[], $3::jsonb[], $4::jsonb[], $5::int[], $6::int[], $7::int[],
+			$8::int[], $9::int[], $10::text[], $11::timestamp[], $12::timestamp[],
+			$13::timestamp[], $14::int[], $15::boolean[], $16::timestamp[], $17::int[],
+			$18::text[], $19::text[], $20::bigint[], $21::boolean[], $22::int[], $23::boolean[]
+		) AS h(
+			name, allow, disallow, sitemaps, crawl_delay, max_retry, max_pages,
+			pages_crawled, error_count, last_error, last_error_at, robots_fetched_at,
+			robots_expires_at, robots_status, disallow_all, probed_at, probe_status,
+			probe_url, probe_title, probe_hash, soft_404, soft_404_pages, parked
+		)
+		ON CONFLICT (name) DO UPDATE SET
+			allow = EXCLUDED.allow,
+			disallow = EXCLUDED.disallow,
+			sitemaps = EXCLUDED.sitemaps,
+			crawl_delay = EXCLUDED.crawl_delay,
+			max_retry = EXCLUDED.max_retry,
+			max_pages = EXCLUDED.max_pages,
+			pages_crawled = EXCLUDED.pages_crawled,
+			error_count = EXCLUDED.error_count,
+			last_error = EXCLUDED.last_error,
+			last_error_at = EXCLUDED.last_error_at,
+			robots_fetched_at = EXCLUDED.robots_fetched_at,
+			robots_expires_at = EXCLUDED.robots_expires_at,
+			robots_status = EXCLUDED.robots_status,
+			disallow_all = EXCLUDED.disallow_all,
+			probed_at = GREATEST(hosts.probed_at, EXCLUDED.probed_at),
+			probe_status = CASE WHEN `+newerProbe+` THEN EXCLUDED.probe_status ELSE hosts.probe_status END,
+			probe_url = CASE WHEN `+newerProbe+` THEN EXCLUDED.probe_url ELSE hosts.probe_url END,
+			probe_title = CASE WHEN `+newerProbe+` THEN EXCLUDED.probe_title ELSE hosts.probe_title END,
+			probe_hash = CASE WHEN `+newerProbe+` THEN EXCLUDED.probe_hash ELSE hosts.probe_hash END,
+			soft_404 = CASE WHEN `+newerProbe+` THEN EXCLUDED.soft_404 ELSE hosts.soft_404 END,
+			soft_404_pages = EXCLUDED.soft_404_pages,
+			parked = CASE WHEN `+newerProbe+` THEN EXCLUDED.parked ELSE hosts.parked END,
+			updated_at = NOW()`,
+		pq.Array(names),
+		pq.Array(allow),
+		pq.Array(disallow),
+		pq.Array(sitemaps),
+		pq.Array(delays),
+		pq.Array(maxRetries),
+		pq.Array(maxPages),
+		pq.Array(pagesCrawled),
+		pq.Array(errorCounts),
+		pq.Array(lastErrors),
+		pq.Array(lastErrorAt),
+		pq.Array(robotsAt),
+		pq.Array(robotsExp),
+		pq.Array(robotsStatus),
+		pq.Array(disallowAll),
+		pq.Array(probedAt),
+		pq.Array(probeStatus),
+		pq.Array(probeURLs),
+		pq.Array(probeTitles),
+		pq.Array(probeHashes),
+		pq.Array(softNotFound),
+		pq.Array(soft404Pages),
+		pq.Array(parked),
+	)
+	if err != nil {
+		return fmt.Errorf("upsert hosts: %w", err)
+	}
+	return nil
+}
+
+// GetHost loads a host's metadata from the "hosts" table.
+func (c *SQLClient) GetHost(ctx context.Context, name string) (*entity.Host, bool, error) {
+	var (
+		h           = entity.Host{Name: name}
+		lastError   sql.NullString
+		lastErrorAt sql.NullTime
+		robotsAt    sql.NullTime
+		robotsExp   sql.NullTime
+		probedAt    sql.NullTime
+		probeURL    sql.NullString
+		probeTitle  sql.NullString
+		probeHash   int64
+	)
+
+	err := c.conn.QueryRowContext(ctx, `
+		SELECT allow, disallow, sitemaps, crawl_delay, max_retry, max_pages,
+			pages_crawled, error_count, last_error, last_error_at, robots_fetched_at,
+			robots_expires_at, robots_status, disallow_all, probed_at, probe_status,
+			probe_url, probe_title, probe_hash, soft_404, soft_404_pages, parked
+		FROM hosts WHERE name = $1`,
+		name,
+	).Scan(
+		pq.Array(&h.AllowedUrls),
+		pq.Array(&h.NotAllowedPaths),
+		pq.Array(&h.Sitemaps),
+		&h.Delay,
+		&h.MaxRetry,
+		&h.MaxPages,
+		&h.PagesCrawled,
+		&h.ErrorCount,
+		&lastError,
+		&lastErrorAt,
+		&robotsAt,
+		&robotsExp,
+		&h.RobotsStatus,
+		&h.DisallowAll,
+		&probedAt,
+		&h.ProbeStatus,
+		&probeURL,
+		&probeTitle,
+		&probeHash,
+		&h.SoftNotFound,
+		&h.SoftNotFoundPages,
+		&h.Parked,
+	)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("select host: %w", err)
+	}
+
+	h.LastError = lastError.String
+	h.LastErrorAt = lastErrorAt.Time
+	h.RobotsFetchedAt = robotsAt.Time
+	h.RobotsExpiresAt = robotsExp.Time
+	h.ProbedAt = probedAt.Time
+	h.ProbeURL = probeURL.String
+	h.ProbeTitle = probeTitle.String
+	h.ProbeHash = uint64(probeHash)
+	return &h, true, nil
+}
+
+func jsonList(l []string) string {
+	if l == nil {
+		return "[]"
+	}
+	b, _ := json.Marshal(l)
+	return string(b)
+}
 
-	return m, nil
+// nullTime stores times in UTC, as the schema uses TIMESTAMP columns.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
 }
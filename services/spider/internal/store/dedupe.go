@@ -0,0 +1,181 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+)
+
+// minAliasWords is the number of words of text a page needs to be taken
+// for a duplicate of another URL. Short texts such as "Page not found" or
+// "Loading..." are shared by unrelated pages across the corpus.
+const minAliasWords = 50
+
+// pageWrites is a batch's pages sorted by how they are stored.
+type pageWrites struct {
+	added     []*entity.Page // URLs without a page yet
+	changed   []*entity.Page // recrawled pages whose content changed
+	aliases   []*entity.Page // new URLs with the content of another page
+	unchanged []*entity.Page // recrawled pages left as they are
+}
+
+// stored returns the pages whose links and graph edges are written.
+func (w pageWrites) stored() []*entity.Page {
+	pages := make([]*entity.Page, 0, len(w.added)+len(w.changed)+len(w.aliases))
+	pages = append(pages, w.added...)
+	pages = append(pages, w.changed...)
+	return append(pages, w.aliases...)
+}
+
+// sortPages compares the content hash of each page with what is stored:
+//   - a recrawled page with the same hash, directly or through its alias,
+//     is left alone, so it is neither written nor indexed again;
+//   - a recrawled page with another hash is updated in place;
+//   - a new URL with at least minAliasWords words of text whose hash
+//     matches a stored page, or a page earlier in the batch, becomes an
+//     alias of that page;
+//   - any other URL gets a page of its own.
+//
+// A URL appearing twice in the batch is only stored once.
+func (c *SQLClient) sortPages(ctx context.Context, tx *sql.Tx, pages []*entity.Page) (pageWrites, error) {
+	var w pageWrites
+	if len(pages) == 0 {
+		return w, nil
+	}
+
+	urls := make([]string, len(pages))
+	hashes := make([]string, 0, len(pages))
+	for i, p := range pages {
+		urls[i] = p.URL
+		if p.ContentHash != "" {
+			hashes = append(hashes, p.ContentHash)
+		}
+	}
+
+	type stored struct {
+		hasPage   bool
+		pageHash  string // hash of the URL's own page
+		aliasHash string // hash of the page the URL is an alias of
+	}
+	known := map[string]stored{}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT u.url, p.id IS NOT NULL, COALESCE(p.content_hash, ''), COALESCE(ap.content_hash, '')
+		FROM urls u
+		LEFT JOIN pages p ON p.url_id = u.id
+		LEFT JOIN page_aliases a ON a.url_id = u.id
+		LEFT JOIN pages ap ON ap.id = a.page_id
+		WHERE u.url = ANY($1::text[])`,
+		pq.Array(urls))
+	if err != nil {
+		return w, fmt.Errorf("select stored pages: %w", err)
+	}
+	for rows.Next() {
+		var (
+			u string
+			s stored
+		)
+		if err := rows.Scan(&u, &s.hasPage, &s.pageHash, &s.aliasHash); err != nil {
+			_ = rows.Close()
+			return w, fmt.Errorf("scan stored page: %w", err)
+		}
+		known[u] = s
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return w, fmt.Errorf("select stored pages: %w", err)
+	}
+
+	taken := map[string]bool{}
+	rows, err = tx.QueryContext(ctx,
+		`SELECT DISTINCT content_hash FROM pages WHERE content_hash = ANY($1::text[])`,
+		pq.Array(hashes))
+	if err != nil {
+		return w, fmt.Errorf("select content hashes: %w", err)
+	}
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			_ = rows.Close()
+			return w, fmt.Errorf("scan content hash: %w", err)
+		}
+		taken[h] = true
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return w, fmt.Errorf("select content hashes: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for _, p := range pages {
+		if seen[p.URL] {
+			continue
+		}
+		seen[p.URL] = true
+
+		s := known[p.URL]
+		switch {
+		case s.hasPage && p.ContentHash != "" && s.pageHash == p.ContentHash:
+			w.unchanged = append(w.unchanged, p)
+		case s.hasPage:
+			w.changed = append(w.changed, p)
+		case p.ContentHash == "":
+			w.added = append(w.added, p)
+		case s.aliasHash == p.ContentHash:
+			w.unchanged = append(w.unchanged, p)
+		case taken[p.ContentHash] && len(strings.Fields(p.Text)) >= minAliasWords:
+			w.aliases = append(w.aliases, p)
+		default:
+			w.added = append(w.added, p)
+			taken[p.ContentHash] = true
+		}
+	}
+	return w, nil
+}
+
+// upsertAliases points each page's URL at the oldest page with the same
+// content hash. It runs after insertPages, so aliases may refer to pages
+// of the same batch.
+func (c *SQLClient) upsertAliases(
+	ctx context.Context,
+	tx *sql.Tx,
+	pages []*entity.Page,
+	ids map[string]string,
+) error {
+	if len(pages) == 0 {
+		return nil
+	}
+
+	urlIDs := make([]string, len(pages))
+	hashes := make([]string, len(pages))
+	for i, p := range pages {
+		urlIDs[i] = ids[p.URL]
+		hashes[i] = p.ContentHash
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO page_aliases (url_id, page_id)
+		SELECT a.url_id, p.id
+		FROM unnest($1::uuid[], $2::text[]) AS a(url_id, content_hash)
+		CROSS JOIN LATERAL (
+			SELECT id FROM pages
+			WHERE content_hash = a.content_hash
+			ORDER BY created_at, id
+			LIMIT 1
+		) p
+		ON CONFLICT (url_id) DO UPDATE SET
+			page_id = EXCLUDED.page_id,
+			updated_at = NOW()`,
+		pq.Array(urlIDs),
+		pq.Array(hashes),
+	)
+	if err != nil {
+		return fmt.Errorf("upsert page aliases: %w", err)
+	}
+	return nil
+}
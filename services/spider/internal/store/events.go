@@ -0,0 +1,357 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+	"github.com/Hassan-ach/boogle/services/spider/internal/metrics"
+)
+
+// pageEvents returns an event of type t for each page of pages stored
+// under a page id in pageIDs, keyed by URL id.
+func pageEvents(
+	t entity.EventType,
+	pages []*entity.Page,
+	ids map[string]string,
+	pageIDs map[string]string,
+) ([]entity.Event, error) {
+	var events []entity.Event
+	for _, p := range pages {
+		urlID := ids[p.URL]
+		pageID, ok := pageIDs[urlID]
+		if !ok {
+			continue
+		}
+		payload, err := json.Marshal(entity.PageEvent{
+			PageID:      pageID,
+			URLID:       urlID,
+			URL:         p.URL,
+			ContentHash: p.ContentHash,
+			Language:    p.Language,
+			CrawledAt:   p.CrawledAt,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("marshal page event: %w", err)
+		}
+		events = append(events, entity.Event{Type: t, Version: entity.EventVersion, Payload: payload})
+	}
+	return events, nil
+}
+
+// edgesEvent returns the edges.added event of a batch, given the number of
+// edges added by URL id of their source. It reports false when no edge was
+// added.
+func edgesEvent(pages []*entity.Page, ids map[string]string, added map[string]int) (entity.Event, bool, error) {
+	if len(added) == 0 {
+		return entity.Event{}, false, nil
+	}
+
+	var ev entity.EdgesEvent
+	seen := map[string]bool{} // a URL may appear twice in the batch
+	for _, p := range pages {
+		urlID := ids[p.URL]
+		n := added[urlID]
+		if n == 0 || seen[urlID] {
+			continue
+		}
+		seen[urlID] = true
+		ev.Edges += n
+		ev.Sources = append(ev.Sources, entity.EdgeSource{URLID: urlID, URL: p.URL, Edges: n})
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return entity.Event{}, false, fmt.Errorf("marshal edges event: %w", err)
+	}
+	return entity.Event{Type: entity.EventEdgesAdded, Version: entity.EventVersion, Payload: payload}, true, nil
+}
+
+// insertEvents adds events to the outbox, in order.
+func (c *SQLClient) insertEvents(ctx context.Context, tx *sql.Tx, events []entity.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	var (
+		types    = make([]string, len(events))
+		versions = make([]int64, len(events))
+		payloads = make([]string, len(events))
+	)
+	for i, e := range events {
+		types[i] = string(e.Type)
+		versions[i] = int64(e.Version)
+		payloads[i] = string(e.Payload)
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO event_outbox (type, version, payload)
+		SELECT e.type, e.version, e.payload
+		FROM unnest($1::text[], $2::int[], $3::jsonb[]) WITH ORDINALITY AS e(type, version, payload, n)
+		ORDER BY e.n`,
+		pq.Array(types),
+		pq.Array(versions),
+		pq.Array(payloads),
+	)
+	if err != nil {
+		return fmt.Errorf("insert events: %w", err)
+	}
+	return nil
+}
+
+// TakeEvents removes up to n of the oldest events from the outbox and
+// returns them in order. Events taken by another transaction are skipped,
+// so instances relay different events; they are back in the outbox if tx
+// rolls back. Relays of several instances therefore publish concurrently,
+// and a batch may reach the stream before an older one still being
+// published: stream order follows outbox ids within a batch only.
+func (c *SQLClient) TakeEvents(ctx context.Context, tx *sql.Tx, n int) ([]entity.Event, error) {
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM event_outbox
+		WHERE id IN (
+			SELECT id FROM event_outbox
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, type, version, payload, created_at`,
+		n)
+	if err != nil {
+		return nil, fmt.Errorf("take events: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var events []entity.Event
+	for rows.Next() {
+		var e entity.Event
+		if err := rows.Scan(&e.ID, &e.Type, &e.Version, &e.Payload, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("take events: %w", err)
+	}
+	slices.SortFunc(events, func(a, b entity.Event) int { return cmp.Compare(a.ID, b.ID) })
+	return events, nil
+}
+
+// PublishEvents appends events to stream. Each entry holds the event's outbox id, type, version, JSON payload and
+// creation time.
+func (c *RedisClient) PublishEvents(ctx context.Context, stream string, events []entity.Event) error {
+	pipe := c.conn.Pipeline()
+	for _, e := range events {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: stream,
+			Values: []any{
+				"id", strconv.FormatInt(e.ID, 10),
+				"type", string(e.Type),
+				"version", strconv.Itoa(e.Version),
+				"payload", string(e.Payload),
+				"createdAt", e.CreatedAt.UTC().Format(time.RFC3339Nano),
+			},
+		})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("publish events: %w", err)
+	}
+	return nil
+}
+
+// TrimEvents trims stream once it holds more than maxLen entries, down to
+// about maxLen when it has no consumer group, or else down to the oldest
+// entry a group has not read or acknowledged yet. A lagging group thus
+// keeps the stream from being trimmed rather than losing events.
+func (c *RedisClient) TrimEvents(ctx context.Context, stream string, maxLen int64) error {
+	if maxLen <= 0 {
+		return nil
+	}
+	n, err := c.conn.XLen(ctx, stream).Result()
+	if err != nil {
+		return fmt.Errorf("count events: %w", err)
+	}
+	if n <= maxLen {
+		return nil
+	}
+
+	groups, err := c.conn.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		return fmt.Errorf("list consumer groups: %w", err)
+	}
+	if len(groups) == 0 {
+		if err := c.conn.XTrimMaxLenApprox(ctx, stream, maxLen, 0).Err(); err != nil {
+			return fmt.Errorf("trim events: %w", err)
+		}
+		return nil
+	}
+
+	// the oldest entry still needed: the first pending one of a group,
+	// or the last it read when it has none pending
+	var floor string
+	for _, g := range groups {
+		keep := g.LastDeliveredID
+		if g.Pending > 0 {
+			p, err := c.conn.XPending(ctx, stream, g.Name).Result()
+			if err != nil {
+				return fmt.Errorf("get pending events of %s: %w", g.Name, err)
+			}
+			keep = p.Lower
+		}
+		if floor == "" || compareStreamIDs(keep, floor) < 0 {
+			floor = keep
+		}
+	}
+	if compareStreamIDs(floor, "0-1") < 0 {
+		// a group has not read anything yet
+		return nil
+	}
+	if err := c.conn.XTrimMinIDApprox(ctx, stream, floor, 0).Err(); err != nil {
+		return fmt.Errorf("trim events: %w", err)
+	}
+	return nil
+}
+
+// compareStreamIDs compares two stream ids of the form ms-seq.
+func compareStreamIDs(a, b string) int {
+	parse := func(id string) (uint64, uint64) {
+		ms, seq, _ := strings.Cut(id, "-")
+		m, _ := strconv.ParseUint(ms, 10, 64)
+		s, _ := strconv.ParseUint(seq, 10, 64)
+		return m, s
+	}
+	am, as := parse(a)
+	bm, bs := parse(b)
+	return cmp.Or(cmp.Compare(am, bm), cmp.Compare(as, bs))
+}
+
+// CreateGroups creates the consumer groups of stream that do not exist
+// yet, reading from the first event, and the stream itself if needed.
+func (c *RedisClient) CreateGroups(ctx context.Context, stream string, groups []string) error {
+	for _, g := range groups {
+		err := c.conn.XGroupCreateMkStream(ctx, stream, g, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return fmt.Errorf("create consumer group %s: %w", g, err)
+		}
+	}
+	return nil
+}
+
+// EventGroup is the state of a consumer group of the event stream.
+type EventGroup struct {
+	Name          string
+	Consumers     int64
+	Pending       int64  // delivered but not acknowledged
+	LastDelivered string // stream id of the last event delivered
+	Lag           int64  // events not delivered yet, -1 when unknown
+}
+
+// EventGroups returns the consumer groups of stream.
+func (c *RedisClient) EventGroups(ctx context.Context, stream string) ([]EventGroup, error) {
+	infos, err := c.conn.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		return nil, fmt.Errorf("list consumer groups: %w", err)
+	}
+	groups := make([]EventGroup, len(infos))
+	for i, g := range infos {
+		groups[i] = EventGroup{
+			Name:          g.Name,
+			Consumers:     g.Consumers,
+			Pending:       g.Pending,
+			LastDelivered: g.LastDeliveredID,
+			Lag:           g.Lag,
+		}
+	}
+	return groups, nil
+}
+
+// SetGroupOffset makes group read stream again from the events after
+// stream id offset ("0" for the start of the stream, "$" for its end),
+// creating the group if needed.
+func (c *RedisClient) SetGroupOffset(ctx context.Context, stream, group, offset string) error {
+	err := c.conn.XGroupCreateMkStream(ctx, stream, group, offset).Err()
+	if err == nil {
+		return nil
+	}
+	if !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("create consumer group %s: %w", group, err)
+	}
+	if err := c.conn.XGroupSetID(ctx, stream, group, offset).Err(); err != nil {
+		return fmt.Errorf("set consumer group %s offset: %w", group, err)
+	}
+	return nil
+}
+
+// RelayEvents moves events from the outbox to the event stream until ctx
+// is done. Delivery is at least once: an event published by a relay that
+// fails before committing is published again.
+func (s *Store) RelayEvents(ctx context.Context) {
+	conf := s.config.Events
+	if err := s.cache.CreateGroups(ctx, conf.Stream, conf.Groups); err != nil {
+		s.log.Warn("create event consumer groups", "stream", conf.Stream, "error", err)
+	}
+
+	interval, batch := conf.RelayInterval, conf.RelayBatch
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if batch <= 0 {
+		batch = 1
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				n, err := s.relayEvents(ctx, batch)
+				if err != nil {
+					s.log.Warn("relay events", "stream", conf.Stream, "error", err)
+					break
+				}
+				if n < batch {
+					break
+				}
+			}
+		}
+	}
+}
+
+// relayEvents publishes up to n events from the outbox and returns how
+// many it moved.
+func (s *Store) relayEvents(ctx context.Context, n int) (int, error) {
+	conf := s.config.Events
+	var events []entity.Event
+	err := s.db.WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		events, err = s.db.TakeEvents(ctx, tx, n)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		return s.cache.PublishEvents(ctx, conf.Stream, events)
+	})
+	if err != nil {
+		return 0, err
+	}
+	// outside the transaction: the events are published, a failed trim
+	// must not publish them again
+	if err := s.cache.TrimEvents(ctx, conf.Stream, conf.MaxLen); err != nil {
+		s.log.Warn("trim event stream", "stream", conf.Stream, "error", err)
+	}
+	for _, e := range events {
+		metrics.EventsPublished.WithLabelValues(string(e.Type)).Inc()
+	}
+	return len(events), nil
+}
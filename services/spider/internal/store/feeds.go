@@ -0,0 +1,183 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+)
+
+const feedColumns = `job, url, host, probe, interval_seconds, next_poll_at, last_polled_at,
+	last_item_at, seen_items, etag, last_modified, items_found, error_count, last_error`
+
+// AddFeeds registers feeds, due right away. A known feed keeps its
+// schedule; a probed feed found again through a <link> is confirmed.
+func (c *SQLClient) AddFeeds(ctx context.Context, feeds []*entity.Feed) error {
+	if len(feeds) == 0 {
+		return nil
+	}
+
+	var (
+		jobs      = make([]string, len(feeds))
+		urls      = make([]string, len(feeds))
+		hosts     = make([]string, len(feeds))
+		probes    = make([]bool, len(feeds))
+		intervals = make([]int64, len(feeds))
+	)
+	for i, f := range feeds {
+		jobs[i] = f.Job
+		urls[i] = f.URL
+		hosts[i] = f.Host
+		probes[i] = f.Probe
+		intervals[i] = int64(f.Interval / time.Second)
+	}
+
+	_, err := c.conn.ExecContext(ctx, `
+		INSERT INTO feeds (job, url, host, probe, interval_seconds, next_poll_at)
+		SELECT f.job, f.url, f.host, f.probe, f.interval_seconds, $6::timestamp
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::boolean[], $5::bigint[])
+			AS f(job, url, host, probe, interval_seconds)
+		ON CONFLICT (job, url) DO UPDATE SET
+			probe = feeds.probe AND EXCLUDED.probe,
+			updated_at = NOW()`,
+		pq.Array(jobs),
+		pq.Array(urls),
+		pq.Array(hosts),
+		pq.Array(probes),
+		pq.Array(intervals),
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert feeds: %w", err)
+	}
+	return nil
+}
+
+// ClaimFeeds returns up to n feeds of jobs due for a poll, and pushes their
+// next poll lease into the future so other instances skip them meanwhile.
+func (c *SQLClient) ClaimFeeds(ctx context.Context, jobs []string, n int, lease time.Duration) ([]*entity.Feed, error) {
+	now := time.Now().UTC()
+	rows, err := c.conn.QueryContext(ctx, `
+		UPDATE feeds SET next_poll_at = $3
+		WHERE (job, url) IN (
+			SELECT job, url FROM feeds
+			WHERE job = ANY($1::text[]) AND next_poll_at <= $4
+			ORDER BY next_poll_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+feedColumns,
+		pq.Array(jobs), n, now.Add(lease), now)
+	if err != nil {
+		return nil, fmt.Errorf("claim feeds: %w", err)
+	}
+	return scanFeeds(rows)
+}
+
+// UpdateFeed records the outcome of a poll and the feed's next poll time.
+func (c *SQLClient) UpdateFeed(ctx context.Context, f *entity.Feed) error {
+	_, err := c.conn.ExecContext(ctx, `
+		UPDATE feeds SET
+			probe = $3,
+			interval_seconds = $4,
+			next_poll_at = $5,
+			last_polled_at = $6,
+			last_item_at = $7,
+			etag = NULLIF($8, ''),
+			last_modified = NULLIF($9, ''),
+			items_found = $10,
+			error_count = $11,
+			last_error = NULLIF($12, ''),
+			seen_items = $13,
+			updated_at = NOW()
+		WHERE job = $1 AND url = $2`,
+		f.Job,
+		f.URL,
+		f.Probe,
+		int64(f.Interval/time.Second),
+		f.NextPollAt.UTC(),
+		nullTime(f.LastPolledAt),
+		nullTime(f.LastItemAt),
+		f.ETag,
+		f.LastModified,
+		f.ItemsFound,
+		f.ErrorCount,
+		f.LastError,
+		pq.Array(f.SeenItems),
+	)
+	if err != nil {
+		return fmt.Errorf("update feed: %w", err)
+	}
+	return nil
+}
+
+// DeleteFeed forgets a feed, e.g. a probed path that is not a feed.
+func (c *SQLClient) DeleteFeed(ctx context.Context, job, url string) error {
+	_, err := c.conn.ExecContext(ctx, `DELETE FROM feeds WHERE job = $1 AND url = $2`, job, url)
+	if err != nil {
+		return fmt.Errorf("delete feed: %w", err)
+	}
+	return nil
+}
+
+// HostFeeds returns the confirmed feeds of a host, in every job.
+func (c *SQLClient) HostFeeds(ctx context.Context, host string) ([]*entity.Feed, error) {
+	rows, err := c.conn.QueryContext(ctx, `
+		SELECT `+feedColumns+` FROM feeds
+		WHERE host = $1 AND NOT probe
+		ORDER BY job, url`,
+		host)
+	if err != nil {
+		return nil, fmt.Errorf("select host feeds: %w", err)
+	}
+	return scanFeeds(rows)
+}
+
+func scanFeeds(rows *sql.Rows) ([]*entity.Feed, error) {
+	defer func() { _ = rows.Close() }()
+
+	var feeds []*entity.Feed
+	for rows.Next() {
+		var (
+			f            entity.Feed
+			interval     int64
+			lastPolledAt sql.NullTime
+			lastItemAt   sql.NullTime
+			etag         sql.NullString
+			lastModified sql.NullString
+			lastError    sql.NullString
+		)
+		err := rows.Scan(
+			&f.Job,
+			&f.URL,
+			&f.Host,
+			&f.Probe,
+			&interval,
+			&f.NextPollAt,
+			&lastPolledAt,
+			&lastItemAt,
+			pq.Array(&f.SeenItems),
+			&etag,
+			&lastModified,
+			&f.ItemsFound,
+			&f.ErrorCount,
+			&lastError,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan feed: %w", err)
+		}
+
+		f.Interval = time.Duration(interval) * time.Second
+		f.LastPolledAt = lastPolledAt.Time
+		f.LastItemAt = lastItemAt.Time
+		f.ETag = etag.String
+		f.LastModified = lastModified.String
+		f.LastError = lastError.String
+		feeds = append(feeds, &f)
+	}
+	return feeds, rows.Err()
+}
@@ -0,0 +1,218 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+)
+
+// HostFetchStats summarizes the fetches of one host.
+type HostFetchStats struct {
+	Host       string
+	Fetches    int64
+	Errors     int64
+	AvgLatency time.Duration
+}
+
+func (h HostFetchStats) ErrorRate() float64 {
+	if h.Fetches == 0 {
+		return 0
+	}
+	return float64(h.Errors) / float64(h.Fetches)
+}
+
+// DailyStatus counts the fetches of one day ending with one outcome: an
+// HTTP status code, or the error class when no response was received.
+type DailyStatus struct {
+	Day     time.Time
+	Outcome string
+	Count   int64
+}
+
+// insertFetches logs fetches by URL, linked to the URL's row when it is a
+// known page or link. Robots.txt, sitemap, feed and probe URLs are not
+// added to urls.
+func (c *SQLClient) insertFetches(ctx context.Context, tx *sql.Tx, fetches []entity.Fetch) error {
+	if len(fetches) == 0 {
+		return nil
+	}
+
+	var (
+		urls         = make([]string, len(fetches))
+		hosts        = make([]string, len(fetches))
+		fetchedAt    = make([]time.Time, len(fetches))
+		statuses     = make([]sql.NullInt64, len(fetches))
+		latencies    = make([]int64, len(fetches))
+		sizes        = make([]int64, len(fetches))
+		contentTypes = make([]sql.NullString, len(fetches))
+		errorClasses = make([]sql.NullString, len(fetches))
+		workers      = make([]sql.NullInt64, len(fetches))
+		instances    = make([]string, len(fetches))
+	)
+
+	for i, f := range fetches {
+		urls[i] = f.URL
+		if u, err := url.Parse(f.URL); err == nil {
+			hosts[i] = u.Host
+		}
+		fetchedAt[i] = f.FetchedAt.UTC()
+		statuses[i] = sql.NullInt64{Int64: int64(f.Status), Valid: f.Status != 0}
+		latencies[i] = f.Latency.Milliseconds()
+		sizes[i] = f.Bytes
+		contentTypes[i] = sql.NullString{String: f.ContentType, Valid: f.ContentType != ""}
+		errorClasses[i] = sql.NullString{String: f.ErrorClass, Valid: f.ErrorClass != ""}
+		workers[i] = sql.NullInt64{Int64: int64(f.Worker), Valid: f.Worker != 0}
+		instances[i] = f.Instance
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO fetch_log (
+			url, url_id, host, fetched_at, status, latency_ms, bytes,
+			content_type, error_class, worker_id, instance
+		)
+		SELECT f.url, u.id, f.host, f.fetched_at, f.status, f.latency_ms, f.bytes,
+			f.content_type, f.error_class, f.worker_id, f.instance
+		FROM unnest(
+			$1::text[], $2::text[], $3::timestamp[], $4::int[], $5::int[], $6::bigint[],
+			$7::text[], $8::text[], $9::int[], $10::text[]
+		) AS f(url, host, fetched_at, status, latency_ms, bytes,
+			content_type, error_class, worker_id, instance)
+		LEFT JOIN urls u ON u.url = f.url`,
+		pq.Array(urls),
+		pq.Array(hosts),
+		pq.Array(fetchedAt),
+		pq.Array(statuses),
+		pq.Array(latencies),
+		pq.Array(sizes),
+		pq.Array(contentTypes),
+		pq.Array(errorClasses),
+		pq.Array(workers),
+		pq.Array(instances),
+	)
+	if err != nil {
+		return fmt.Errorf("insert fetch log: %w", err)
+	}
+	return nil
+}
+
+// PruneFetchLog deletes fetch log entries older than before.
+func (c *SQLClient) PruneFetchLog(ctx context.Context, before time.Time) (int64, error) {
+	res, err := c.conn.ExecContext(ctx,
+		`DELETE FROM fetch_log WHERE fetched_at < $1`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("prune fetch log: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// HostErrorRates returns the hosts with the highest error rate among those
+// fetched at least minFetches times since since.
+func (c *SQLClient) HostErrorRates(
+	ctx context.Context,
+	since time.Time,
+	minFetches, limit int,
+) ([]HostFetchStats, error) {
+	rows, err := c.conn.QueryContext(ctx, `
+		SELECT host,
+			count(*) AS fetches,
+			count(*) FILTER (WHERE error_class IS NOT NULL) AS errors,
+			avg(latency_ms)::bigint
+		FROM fetch_log
+		WHERE fetched_at >= $1
+		GROUP BY host
+		HAVING count(*) >= $2
+		ORDER BY count(*) FILTER (WHERE error_class IS NOT NULL)::float / count(*) DESC, fetches DESC
+		LIMIT $3`,
+		since.UTC(), minFetches, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query host error rates: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var stats []HostFetchStats
+	for rows.Next() {
+		var (
+			h  HostFetchStats
+			ms int64
+		)
+		if err := rows.Scan(&h.Host, &h.Fetches, &h.Errors, &ms); err != nil {
+			return nil, fmt.Errorf("scan host error rates: %w", err)
+		}
+		h.AvgLatency = time.Duration(ms) * time.Millisecond
+		stats = append(stats, h)
+	}
+	return stats, rows.Err()
+}
+
+// StatusByDay returns the distribution of fetch outcomes per day since since.
+func (c *SQLClient) StatusByDay(ctx context.Context, since time.Time) ([]DailyStatus, error) {
+	rows, err := c.conn.QueryContext(ctx, `
+		SELECT date_trunc('day', fetched_at) AS day,
+			COALESCE(status::text, error_class, 'unknown') AS outcome,
+			count(*)
+		FROM fetch_log
+		WHERE fetched_at >= $1
+		GROUP BY 1, 2
+		ORDER BY 1, 2`,
+		since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("query status by day: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var stats []DailyStatus
+	for rows.Next() {
+		var d DailyStatus
+		if err := rows.Scan(&d.Day, &d.Outcome, &d.Count); err != nil {
+			return nil, fmt.Errorf("scan status by day: %w", err)
+		}
+		stats = append(stats, d)
+	}
+	return stats, rows.Err()
+}
+
+// URLFetches returns the most recent fetch attempts of u, newest first.
+func (c *SQLClient) URLFetches(ctx context.Context, u string, limit int) ([]entity.Fetch, error) {
+	rows, err := c.conn.QueryContext(ctx, `
+		SELECT f.fetched_at, f.status, f.latency_ms, f.bytes,
+			f.content_type, f.error_class, f.worker_id, f.instance
+		FROM fetch_log f
+		WHERE f.url = $1
+		ORDER BY f.fetched_at DESC
+		LIMIT $2`,
+		u, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query url fetches: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var fetches []entity.Fetch
+	for rows.Next() {
+		var (
+			f           = entity.Fetch{URL: u}
+			status      sql.NullInt64
+			ms          int64
+			contentType sql.NullString
+			errorClass  sql.NullString
+			worker      sql.NullInt64
+		)
+		err := rows.Scan(&f.FetchedAt, &status, &ms, &f.Bytes,
+			&contentType, &errorClass, &worker, &f.Instance)
+		if err != nil {
+			return nil, fmt.Errorf("scan url fetches: %w", err)
+		}
+		f.Status = int(status.Int64)
+		f.Latency = time.Duration(ms) * time.Millisecond
+		f.ContentType = contentType.String
+		f.ErrorClass = errorClass.String
+		f.Worker = int(worker.Int64)
+		fetches = append(fetches, f)
+	}
+	return fetches, rows.Err()
+}
@@ -0,0 +1,328 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+)
+
+// HostStats are the running totals of a host's crawl, kept in the
+// host_stats table.
+type HostStats struct {
+	Host    string `json:"host"`
+	Fetches int64  `json:"fetches"` // requests, robots.txt and feeds included
+	Bytes   int64  `json:"bytes"`
+
+	Status2xx int64 `json:"status_2xx"`
+	Status3xx int64 `json:"status_3xx"`
+	Status4xx int64 `json:"status_4xx"`
+	Status5xx int64 `json:"status_5xx"`
+	Errors    int64 `json:"errors"` // fetches without a response
+
+	Pages      int64 `json:"pages"`      // crawled, duplicates and unchanged included
+	Duplicates int64 `json:"duplicates"` // new URLs with the content of another page
+	Unchanged  int64 `json:"unchanged"`  // recrawled pages with the same content
+	Outlinks   int64 `json:"outlinks"`   // links found on the host's pages
+
+	Deferrals   int64   `json:"deferrals"`    // fetches put off by the crawl delay
+	WaitSeconds float64 `json:"wait_seconds"` // crawl delay left at those deferrals, summed
+
+	AvgLatencyMs   int64   `json:"avg_latency_ms"`
+	DuplicateRatio float64 `json:"duplicate_ratio"` // duplicates per page
+
+	LastSuccessAt time.Time `json:"last_success_at"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Failures returns the fetches answered with an error status or not
+// answered at all.
+func (h HostStats) Failures() int64 {
+	return h.Status4xx + h.Status5xx + h.Errors
+}
+
+// HostStatsOrders are the orders TopHosts accepts, by name.
+var HostStatsOrders = map[string]string{
+	"pages":      "pages",
+	"fetches":    "fetches",
+	"bytes":      "bytes",
+	"failures":   "status_4xx + status_5xx + errors",
+	"duplicates": "duplicates",
+	"latency":    "latency_ms / GREATEST(fetches, 1)",
+	"outlinks":   "outlinks",
+	"deferrals":  "deferrals",
+	"wait":       "wait_ms",
+}
+
+// hostStatsDelta is what a batch adds to the statistics of one host.
+type hostStatsDelta struct {
+	host                                       string
+	fetches, bytes, latencyMs                  int64
+	status2xx, status3xx, status4xx, status5xx int64
+	errors                                     int64
+	pages, duplicates, unchanged, outlinks     int64
+	deferrals, waitMs                          int64
+	lastSuccess, lastFailure                   time.Time
+}
+
+// hostStatsDeltas sums the fetches, deferrals and pages of a batch per
+// host, sorted by host so concurrent batches lock rows in the same order.
+// A fetch fails when it has an error class.
+func hostStatsDeltas(fetches []entity.Fetch, deferrals []entity.Deferral, w pageWrites) []hostStatsDelta {
+	byHost := map[string]*hostStatsDelta{}
+	getHost := func(host string) *hostStatsDelta {
+		d, ok := byHost[host]
+		if !ok {
+			d = &hostStatsDelta{host: host}
+			byHost[host] = d
+		}
+		return d
+	}
+	get := func(rawURL string) *hostStatsDelta {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Host == "" {
+			return nil
+		}
+		return getHost(u.Host)
+	}
+
+	for _, f := range fetches {
+		d := get(f.URL)
+		if d == nil {
+			continue
+		}
+		d.fetches++
+		d.bytes += f.Bytes
+		d.latencyMs += f.Latency.Milliseconds()
+		switch {
+		case f.Status == 0:
+			d.errors++
+		case f.Status < 300:
+			d.status2xx++
+		case f.Status < 400:
+			d.status3xx++
+		case f.Status < 500:
+			d.status4xx++
+		default:
+			d.status5xx++
+		}
+		if f.ErrorClass == "" && f.FetchedAt.After(d.lastSuccess) {
+			d.lastSuccess = f.FetchedAt
+		}
+		if f.ErrorClass != "" && f.FetchedAt.After(d.lastFailure) {
+			d.lastFailure = f.FetchedAt
+		}
+	}
+
+	for _, def := range deferrals {
+		if def.Host == "" {
+			continue
+		}
+		d := getHost(def.Host)
+		d.deferrals++
+		d.waitMs += def.Wait.Milliseconds()
+	}
+
+	count := func(pages []*entity.Page, field func(d *hostStatsDelta) *int64) {
+		for _, p := range pages {
+			d := get(p.URL)
+			if d == nil {
+				continue
+			}
+			d.pages++
+			d.outlinks += int64(len(p.Links) + len(p.DemotedLinks))
+			if field != nil {
+				*field(d)++
+			}
+		}
+	}
+	count(w.added, nil)
+	count(w.changed, nil)
+	count(w.aliases, func(d *hostStatsDelta) *int64 { return &d.duplicates })
+	count(w.unchanged, func(d *hostStatsDelta) *int64 { return &d.unchanged })
+
+	deltas := make([]hostStatsDelta, 0, len(byHost))
+	for _, d := range byHost {
+		deltas = append(deltas, *d)
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].host < deltas[j].host })
+	return deltas
+}
+
+// upsertHostStats adds the deltas of a batch to the statistics of their
+// hosts.
+func (c *SQLClient) upsertHostStats(ctx context.Context, tx *sql.Tx, deltas []hostStatsDelta) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	var (
+		hosts       = make([]string, len(deltas))
+		fetches     = make([]int64, len(deltas))
+		bytes       = make([]int64, len(deltas))
+		latencies   = make([]int64, len(deltas))
+		status2xx   = make([]int64, len(deltas))
+		status3xx   = make([]int64, len(deltas))
+		status4xx   = make([]int64, len(deltas))
+		status5xx   = make([]int64, len(deltas))
+		errors      = make([]int64, len(deltas))
+		pages       = make([]int64, len(deltas))
+		duplicates  = make([]int64, len(deltas))
+		unchanged   = make([]int64, len(deltas))
+		outlinks    = make([]int64, len(deltas))
+		deferrals   = make([]int64, len(deltas))
+		waits       = make([]int64, len(deltas))
+		lastSuccess = make([]sql.NullTime, len(deltas))
+		lastFailure = make([]sql.NullTime, len(deltas))
+	)
+	for i, d := range deltas {
+		hosts[i] = d.host
+		fetches[i] = d.fetches
+		bytes[i] = d.bytes
+		latencies[i] = d.latencyMs
+		status2xx[i] = d.status2xx
+		status3xx[i] = d.status3xx
+		status4xx[i] = d.status4xx
+		status5xx[i] = d.status5xx
+		errors[i] = d.errors
+		pages[i] = d.pages
+		duplicates[i] = d.duplicates
+		unchanged[i] = d.unchanged
+		outlinks[i] = d.outlinks
+		deferrals[i] = d.deferrals
+		waits[i] = d.waitMs
+		lastSuccess[i] = sql.NullTime{Time: d.lastSuccess.UTC(), Valid: !d.lastSuccess.IsZero()}
+		lastFailure[i] = sql.NullTime{Time: d.lastFailure.UTC(), Valid: !d.lastFailure.IsZero()}
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO host_stats (
+			host, fetches, bytes, latency_ms,
+			status_2xx, status_3xx, status_4xx, status_5xx, errors,
+			pages, duplicates, unchanged, outlinks,
+			deferrals, wait_ms,
+			last_success_at, last_failure_at
+		)
+		SELECT * FROM unnest(
+			$1::text[], $2::bigint[], $3::bigint[], $4::bigint[],
+			$5::bigint[], $6::bigint[], $7::bigint[], $8::bigint[], $9::bigint[],
+			$10::bigint[], $11::bigint[], $12::bigint[], $13::bigint[],
+			$14::bigint[], $15::bigint[],
+			$16::timestamp[], $17::timestamp[]
+		)
+		ON CONFLICT (host) DO UPDATE SET
+			fetches = host_stats.fetches + EXCLUDED.fetches,
+			bytes = host_stats.bytes + EXCLUDED.bytes,
+			latency_ms = host_stats.latency_ms + EXCLUDED.latency_ms,
+			status_2xx = host_stats.status_2xx + EXCLUDED.status_2xx,
+			status_3xx = host_stats.status_3xx + EXCLUDED.status_3xx,
+			status_4xx = host_stats.status_4xx + EXCLUDED.status_4xx,
+			status_5xx = host_stats.status_5xx + EXCLUDED.status_5xx,
+			errors = host_stats.errors + EXCLUDED.errors,
+			pages = host_stats.pages + EXCLUDED.pages,
+			duplicates = host_stats.duplicates + EXCLUDED.duplicates,
+			unchanged = host_stats.unchanged + EXCLUDED.unchanged,
+			outlinks = host_stats.outlinks + EXCLUDED.outlinks,
+			deferrals = host_stats.deferrals + EXCLUDED.deferrals,
+			wait_ms = host_stats.wait_ms + EXCLUDED.wait_ms,
+			last_success_at = GREATEST(host_stats.last_success_at, EXCLUDED.last_success_at),
+			last_failure_at = GREATEST(host_stats.last_failure_at, EXCLUDED.last_failure_at),
+			updated_at = NOW()`,
+		pq.Array(hosts),
+		pq.Array(fetches),
+		pq.Array(bytes),
+		pq.Array(latencies),
+		pq.Array(status2xx),
+		pq.Array(status3xx),
+		pq.Array(status4xx),
+		pq.Array(status5xx),
+		pq.Array(errors),
+		pq.Array(pages),
+		pq.Array(duplicates),
+		pq.Array(unchanged),
+		pq.Array(outlinks),
+		pq.Array(deferrals),
+		pq.Array(waits),
+		pq.Array(lastSuccess),
+		pq.Array(lastFailure),
+	)
+	if err != nil {
+		return fmt.Errorf("upsert host stats: %w", err)
+	}
+	return nil
+}
+
+const hostStatsColumns = `host, fetches, bytes,
+	status_2xx, status_3xx, status_4xx, status_5xx, errors,
+	pages, duplicates, unchanged, outlinks,
+	deferrals, wait_ms / 1000.0,
+	latency_ms / GREATEST(fetches, 1),
+	duplicates::float / GREATEST(pages, 1),
+	last_success_at, last_failure_at, updated_at`
+
+func scanHostStats(row interface{ Scan(...any) error }) (HostStats, error) {
+	var (
+		h                        HostStats
+		lastSuccess, lastFailure sql.NullTime
+	)
+	err := row.Scan(
+		&h.Host, &h.Fetches, &h.Bytes,
+		&h.Status2xx, &h.Status3xx, &h.Status4xx, &h.Status5xx, &h.Errors,
+		&h.Pages, &h.Duplicates, &h.Unchanged, &h.Outlinks,
+		&h.Deferrals, &h.WaitSeconds,
+		&h.AvgLatencyMs, &h.DuplicateRatio,
+		&lastSuccess, &lastFailure, &h.UpdatedAt,
+	)
+	h.LastSuccessAt = lastSuccess.Time
+	h.LastFailureAt = lastFailure.Time
+	return h, err
+}
+
+// HostStats returns the statistics of host, or false if it was never
+// crawled.
+func (c *SQLClient) HostStats(ctx context.Context, host string) (*HostStats, bool, error) {
+	row := c.conn.QueryRowContext(ctx,
+		`SELECT `+hostStatsColumns+` FROM host_stats WHERE host = $1`, host)
+	h, err := scanHostStats(row)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("get host stats: %w", err)
+	}
+	return &h, true, nil
+}
+
+// TopHosts returns the limit hosts ranking first by order, one of the keys
+// of HostStatsOrders.
+func (c *SQLClient) TopHosts(ctx context.Context, order string, limit int) ([]HostStats, error) {
+	expr, ok := HostStatsOrders[order]
+	if !ok {
+		return nil, fmt.Errorf("unknown host stats order %q", order)
+	}
+
+	rows, err := c.conn.QueryContext(ctx,
+		`SELECT `+hostStatsColumns+` FROM host_stats ORDER BY `+expr+` DESC, host LIMIT $1`,
+		limit)
+	if err != nil {
+		return nil, fmt.Errorf("query top hosts: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var stats []HostStats
+	for rows.Next() {
+		h, err := scanHostStats(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan host stats: %w", err)
+		}
+		stats = append(stats, h)
+	}
+	return stats, rows.Err()
+}
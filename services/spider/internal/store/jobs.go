@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+)
+
+var (
+	ErrJobExists   = errors.New("job already exists")
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobFinished = errors.New("job already finished")
+	ErrInvalidJob  = errors.New("invalid job")
+)
+
+const jobColumns = `name, namespace, seeds, scope, max_pages, time_limit_seconds, crawlers,
+	status, finish_reason, pages_crawled, created_at, started_at, finished_at`
+
+// CreateJob inserts a new job. It fails with ErrJobExists when the name or
+// namespace is taken.
+func (c *SQLClient) CreateJob(ctx context.Context, j *entity.Job) error {
+	err := c.insertJob(ctx, j, "")
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+		return fmt.Errorf("%w: %s", ErrJobExists, j.Name)
+	}
+	return err
+}
+
+// EnsureJob inserts j unless a job with the same name exists.
+func (c *SQLClient) EnsureJob(ctx context.Context, j *entity.Job) error {
+	return c.insertJob(ctx, j, "ON CONFLICT (name) DO NOTHING")
+}
+
+func (c *SQLClient) insertJob(ctx context.Context, j *entity.Job, onConflict string) error {
+	status := j.Status
+	if status == "" {
+		status = entity.JobRunning
+	}
+
+	_, err := c.conn.ExecContext(ctx, `
+		INSERT INTO crawl_jobs (
+			name, namespace, seeds, scope, max_pages, time_limit_seconds, crawlers, status
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) `+onConflict,
+		j.Name,
+		j.Namespace,
+		pq.Array(j.Seeds),
+		pq.Array(j.Scope),
+		j.MaxPages,
+		int64(j.TimeLimit/time.Second),
+		j.Crawlers,
+		status,
+	)
+	if err != nil {
+		return fmt.Errorf("insert job: %w", err)
+	}
+	return nil
+}
+
+// GetJob loads a job by name.
+func (c *SQLClient) GetJob(ctx context.Context, name string) (*entity.Job, bool, error) {
+	row := c.conn.QueryRowContext(ctx,
+		`SELECT `+jobColumns+` FROM crawl_jobs WHERE name = $1`, name)
+	j, err := scanJob(row)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("select job: %w", err)
+	}
+	return j, true, nil
+}
+
+// ListJobs returns the jobs in one of statuses, or every job when none is
+// given, oldest first.
+func (c *SQLClient) ListJobs(ctx context.Context, statuses ...entity.JobStatus) ([]*entity.Job, error) {
+	filter := make([]string, len(statuses))
+	for i, s := range statuses {
+		filter[i] = string(s)
+	}
+
+	rows, err := c.conn.QueryContext(ctx, `
+		SELECT `+jobColumns+` FROM crawl_jobs
+		WHERE cardinality($1::text[]) = 0 OR status = ANY($1::text[])
+		ORDER BY created_at, name`,
+		pq.Array(filter))
+	if err != nil {
+		return nil, fmt.Errorf("list jobs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var jobs []*entity.Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+func scanJob(row interface{ Scan(dest ...any) error }) (*entity.Job, error) {
+	var (
+		j          entity.Job
+		timeLimit  int64
+		reason     sql.NullString
+		startedAt  sql.NullTime
+		finishedAt sql.NullTime
+	)
+	err := row.Scan(
+		&j.Name,
+		&j.Namespace,
+		pq.Array(&j.Seeds),
+		pq.Array(&j.Scope),
+		&j.MaxPages,
+		&timeLimit,
+		&j.Crawlers,
+		&j.Status,
+		&reason,
+		&j.PagesCrawled,
+		&j.CreatedAt,
+		&startedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	j.TimeLimit = time.Duration(timeLimit) * time.Second
+	j.FinishReason = reason.String
+	j.StartedAt = startedAt.Time
+	j.FinishedAt = finishedAt.Time
+	return &j, nil
+}
+
+// SetJobStatus moves a job to status. Finished jobs keep their status and
+// ErrJobFinished is returned.
+func (c *SQLClient) SetJobStatus(ctx context.Context, name string, status entity.JobStatus, reason string) error {
+	res, err := c.conn.ExecContext(ctx, `
+		UPDATE crawl_jobs SET
+			status = $2,
+			finish_reason = NULLIF($3, ''),
+			finished_at = CASE WHEN $2 IN ('completed', 'cancelled') THEN $4::timestamp END,
+			updated_at = NOW()
+		WHERE name = $1 AND status NOT IN ('completed', 'cancelled')`,
+		name, status, reason, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("update job status: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	if _, ok, err := c.GetJob(ctx, name); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	return fmt.Errorf("%w: %s", ErrJobFinished, name)
+}
+
+// StartJob records when the job first started and returns that time.
+func (c *SQLClient) StartJob(ctx context.Context, name string) (time.Time, error) {
+	var startedAt time.Time
+	err := c.conn.QueryRowContext(ctx, `
+		UPDATE crawl_jobs SET started_at = COALESCE(started_at, $2), updated_at = NOW()
+		WHERE name = $1
+		RETURNING started_at`,
+		name, time.Now().UTC(),
+	).Scan(&startedAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("start job: %w", err)
+	}
+	return startedAt, nil
+}
+
+// SetJobProgress records how many pages the job crawled so far.
+func (c *SQLClient) SetJobProgress(ctx context.Context, name string, pages int64) error {
+	_, err := c.conn.ExecContext(ctx, `
+		UPDATE crawl_jobs SET pages_crawled = $2, updated_at = NOW()
+		WHERE name = $1`,
+		name, pages)
+	if err != nil {
+		return fmt.Errorf("update job progress: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+)
+
+// linkRoute is where the links of a source go.
+type linkRoute struct {
+	frontier bool // crawled
+	graph    bool // recorded in graph_edges, which ranking is computed on
+	image    bool // listed in the page's images
+}
+
+// linkRoutes routes links by source. Navigation links feed both the
+// frontier and the link graph. <link rel> targets, hreflang alternates
+// included, are crawled but, being declared by the site rather than linked
+// to, cast no vote in the graph.
+var linkRoutes = map[entity.LinkSource]linkRoute{
+	entity.LinkAnchor:   {frontier: true, graph: true},
+	entity.LinkArea:     {frontier: true, graph: true},
+	entity.LinkFrame:    {frontier: true, graph: true},
+	entity.LinkRefresh:  {frontier: true, graph: true},
+	entity.LinkRel:      {frontier: true},
+	entity.LinkHreflang: {frontier: true},
+	entity.LinkImage:    {image: true},
+	entity.LinkSrcset:   {image: true},
+}
+
+// RouteLinks fills page.Links with the outlinks to crawl and page.Images
+// with its images, each URL once.
+func RouteLinks(page *entity.Page) {
+	links := map[string]bool{}
+	images := map[string]bool{}
+	page.Links, page.Images = nil, nil
+
+	for _, l := range page.Outlinks {
+		r := linkRoutes[l.Source]
+		if r.frontier && !links[l.URL] {
+			links[l.URL] = true
+			page.Links = append(page.Links, l.URL)
+		}
+		if r.image && !images[l.URL] {
+			images[l.URL] = true
+			page.Images = append(page.Images, l.URL)
+		}
+	}
+}
+
+// graphLinks returns the page's links recorded in the link graph: those
+// kept for crawling, demoted or not, found in a source that feeds the
+// graph.
+func graphLinks(page *entity.Page) []string {
+	graph := map[string]bool{}
+	for _, l := range page.Outlinks {
+		if linkRoutes[l.Source].graph {
+			graph[l.URL] = true
+		}
+	}
+
+	var out []string
+	for _, links := range [][]string{page.Links, page.DemotedLinks} {
+		for _, l := range links {
+			if graph[l] {
+				out = append(out, l)
+			}
+		}
+	}
+	return out
+}
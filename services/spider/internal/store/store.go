@@ -4,140 +4,533 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log"
 	"log/slog"
+	"maps"
+	"slices"
+	"sync/atomic"
+	"time"
 
 	"github.com/Hassan-ach/boogle/services/spider/internal/config"
 	"github.com/Hassan-ach/boogle/services/spider/internal/entity"
+	"github.com/Hassan-ach/boogle/services/spider/internal/frontier"
+	"github.com/Hassan-ach/boogle/services/spider/internal/metrics"
 	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
 )
 
 type Cache interface {
+	WithNamespace(ns string) Cache
+	Namespace() string
 	AddHostMetaData(ctx context.Context, h string, host *entity.Host) error
 	GetHostMetaData(ctx context.Context, h string) (*entity.Host, bool, error)
-	GetUrl(ctx context.Context) (string, bool, error)
+	SetRobots(ctx context.Context, r *entity.RobotsRules) error
+	GetRobots(ctx context.Context, origin string) (*entity.RobotsRules, bool, error)
+	LegacyHosts(ctx context.Context) ([]*entity.Host, []string, error)
+	GetUrl(ctx context.Context, partitions []int) (string, float64, bool, error)
 	AddUrls(ctx context.Context, urls []string) error
-	MarkVisited(ctx context.Context, u string) error
+	AddEntries(ctx context.Context, entries []frontier.Entry) error
+	NextHostSeq(ctx context.Context, urls []string) ([]int64, error)
+	LastCrawled(ctx context.Context, urls []string) (map[string]time.Time, error)
+	Hops(ctx context.Context, u string) (int, error)
+	SetHops(ctx context.Context, urls []string, hops int) error
+	MarkVisited(ctx context.Context, u string, recordCrawl bool) error
+	TakePublished(ctx context.Context, u string) (time.Time, bool, error)
 	AddToWaitedHost(ctx context.Context, h string, delay int) error
 	CountUrls(ctx context.Context) int64
+	CountVisited(ctx context.Context) int64
+	IncrPages(ctx context.Context) (int64, error)
+	CountPages(ctx context.Context) (int64, error)
+	ClaimHost(ctx context.Context, h string, delay time.Duration) (time.Duration, error)
+	CountHostUrls(ctx context.Context, h string) (int64, error)
+	PurgeHost(ctx context.Context, h string) (int64, error)
+	Partitions() int
+	Heartbeat(ctx context.Context, id string, ttl time.Duration) (int64, error)
+	Deregister(ctx context.Context, id string) error
+	AcquirePartition(ctx context.Context, p int, id string, ttl time.Duration) (bool, error)
+	RenewPartition(ctx context.Context, p int, id string, ttl time.Duration) (bool, error)
+	ReleasePartition(ctx context.Context, p int, id string) error
+	MigrateLegacyFrontier(ctx context.Context) (moved, kept int, err error)
+	PublishEvents(ctx context.Context, stream string, events []entity.Event) error
+	TrimEvents(ctx context.Context, stream string, maxLen int64) error
+	CreateGroups(ctx context.Context, stream string, groups []string) error
 	Close()
 }
 type DB interface {
-	InsertPage(ctx context.Context, tx *sql.Tx, page *entity.Page) error
-	InsertGraphEdges(ctx context.Context, tx *sql.Tx, from_url_id string, to_url_ids []string) error
-	InsertURLs(ctx context.Context, tx *sql.Tx, urls []string) ([]string, error)
+	InsertBatch(ctx context.Context, b Batch) (BatchResult, error)
+	GetHost(ctx context.Context, name string) (*entity.Host, bool, error)
+	CreateJob(ctx context.Context, j *entity.Job) error
+	EnsureJob(ctx context.Context, j *entity.Job) error
+	GetJob(ctx context.Context, name string) (*entity.Job, bool, error)
+	ListJobs(ctx context.Context, statuses ...entity.JobStatus) ([]*entity.Job, error)
+	SetJobStatus(ctx context.Context, name string, status entity.JobStatus, reason string) error
+	StartJob(ctx context.Context, name string) (time.Time, error)
+	SetJobProgress(ctx context.Context, name string, pages int64) error
+	AddFeeds(ctx context.Context, feeds []*entity.Feed) error
+	ClaimFeeds(ctx context.Context, jobs []string, n int, lease time.Duration) ([]*entity.Feed, error)
+	UpdateFeed(ctx context.Context, f *entity.Feed) error
+	DeleteFeed(ctx context.Context, job, url string) error
+	HostFeeds(ctx context.Context, host string) ([]*entity.Feed, error)
+	HostStats(ctx context.Context, host string) (*HostStats, bool, error)
+	TopHosts(ctx context.Context, order string, limit int) ([]HostStats, error)
+	TakeEvents(ctx context.Context, tx *sql.Tx, n int) ([]entity.Event, error)
 	WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error
 	Close()
 }
 
+// demotePenalty is subtracted from the frontier score of links that look
+// like crawler traps, so they are only crawled once nothing better is left.
+const demotePenalty = 2
+
+// Store reads and writes crawl state. The Store returned by NewStore works
+// on the default job's Redis keys; Namespace returns a view on another
+// job's keys sharing the same connections and batch writer.
 type Store struct {
-	db     DB
-	cache  Cache
-	config *config.StoreConfig
-	log    *slog.Logger
+	db       DB
+	cache    Cache
+	frontier frontier.Prioritizer
+	writer   *batchWriter
+	config   *config.StoreConfig
+	log      *slog.Logger
+
+	// focus is set when focused crawling replaces the configured strategy
+	focus     frontier.Classifier
+	focusConf config.FocusConfig
+
+	// inScope filters the links and sitemap URLs entering the frontier;
+	// nil lets every URL in
+	inScope func(u string) bool
+
+	// pending counts the pages of this namespace queued for the batch
+	// writer whose links are not in the frontier yet
+	pending *atomic.Int64
 }
 
-func NewStore(conf config.StoreConfig, log *utils.Logger) *Store {
+func NewStore(conf config.StoreConfig, logger *utils.Logger) *Store {
 	db := NewDbClient(conf.DB)
 	rd := NewRedisClient(conf.Cache)
 
-	return &Store{
-		db:     db,
-		cache:  rd,
-		config: &conf,
-		log:    log.With("component", "store"),
+	prioritizer, err := frontier.New(conf.Frontier, rd)
+	if err != nil {
+		log.Fatalf("Failed to create frontier prioritizer ERROR: %v", err)
+	}
+
+	s := &Store{
+		db:       db,
+		cache:    rd,
+		frontier: prioritizer,
+		config:   &conf,
+		log:      logger.With("component", "store"),
+		pending:  new(atomic.Int64),
+	}
+	s.writer = newBatchWriter(conf.DB.BatchSize, conf.DB.FlushInterval, s.persistBatch)
+	return s
+}
+
+// SetFocus switches the frontier to focused crawling with classifier c,
+// replacing the configured strategy.
+func (s *Store) SetFocus(c frontier.Classifier, conf config.FocusConfig) {
+	s.focus, s.focusConf = c, conf
+	s.frontier = frontier.Focused(c, conf, s.cache)
+}
+
+// Namespace returns a Store on the Redis keys of the job namespace ns,
+// with its own frontier state. Discovered URLs for which inScope returns
+// false are stored in the link graph but never queued.
+func (s *Store) Namespace(ns string, inScope func(u string) bool) (*Store, error) {
+	n := *s
+	n.cache = s.cache.WithNamespace(ns)
+	n.log = s.log.With("namespace", ns)
+	n.inScope = inScope
+	n.pending = new(atomic.Int64)
+
+	if s.focus != nil {
+		n.frontier = frontier.Focused(s.focus, s.focusConf, n.cache)
+		return &n, nil
+	}
+	p, err := frontier.New(s.config.Frontier, n.cache)
+	if err != nil {
+		return nil, fmt.Errorf("create frontier prioritizer: %w", err)
 	}
+	n.frontier = p
+	return &n, nil
 }
 
 func (s *Store) GetCache() Cache {
 	return s.cache
 }
 
+func (s *Store) GetDB() DB {
+	return s.db
+}
+
+// Persist updates the host metadata in Redis right away and queues the
+// page and a host snapshot for the batch writer. It blocks while the queue
+// is full, which slows crawlers down to the speed of the database.
 func (s *Store) Persist(ctx context.Context, page *entity.Page, host *entity.Host) {
 	s.log.Info("Persisting page and host metadata", "url", page.URL, "host", host.Name)
 	s.persistHost(ctx, host)
-	err := s.persistPage(ctx, page)
-	if err != nil {
-		s.log.Error("persist page data", "url", page.URL, "error", err)
-		return
+	s.pending.Add(1)
+	if err := s.writer.enqueue(ctx, persistJob{page: page, host: snapshot(host), owner: s}); err != nil {
+		s.pending.Add(-1)
+		metrics.PersistErrors.Inc()
+		s.log.Error("queue page for persistence", "url", page.URL, "error", err)
+	}
+}
+
+// Skip marks a page visited and queues its links without storing the page,
+// for pages left out of the index. A page stored by an earlier crawl of the
+// URL is deleted by the batch writer.
+func (s *Store) Skip(ctx context.Context, page *entity.Page, host *entity.Host) {
+	s.persistHost(ctx, host)
+	if err := s.writer.enqueue(ctx, persistJob{skipped: page, host: snapshot(host)}); err != nil {
+		s.log.Warn("queue skipped page for deletion", "url", page.URL, "error", err)
+	}
+	s.enqueueLinks(ctx, page)
+}
+
+// PersistHost stores host metadata without a page, e.g. after a failed
+// fetch.
+func (s *Store) PersistHost(ctx context.Context, host *entity.Host) {
+	s.persistHost(ctx, host)
+	if err := s.writer.enqueue(ctx, persistJob{host: snapshot(host)}); err != nil {
+		s.log.Warn("queue host for persistence", "host", host.Name, "error", err)
+	}
+}
+
+// RecordFetch queues a fetch log entry. It implements fetchlog.Recorder.
+func (s *Store) RecordFetch(f entity.Fetch) {
+	if err := s.writer.enqueue(context.Background(), persistJob{fetch: &f}); err != nil {
+		s.log.Warn("queue fetch log entry", "url", f.URL, "error", err)
 	}
 }
 
-func (s *Store) persistPage(ctx context.Context, page *entity.Page) error {
-	s.log.Info("Persisting page data", "url", page.URL)
+// RecordDeferral queues a politeness deferral for the host statistics.
+func (s *Store) RecordDeferral(d entity.Deferral) {
+	if err := s.writer.enqueue(context.Background(), persistJob{deferral: &d}); err != nil {
+		s.log.Warn("queue politeness deferral", "host", d.Host, "error", err)
+	}
+}
 
-	if err := s.db.WithTx(ctx, func(tx *sql.Tx) error {
-		if err := s.db.InsertPage(ctx, tx, page); err != nil {
-			s.log.Error("insert page into database", "url", page.URL, "err", err)
-			return fmt.Errorf("insert page: %w", err)
+func snapshot(host *entity.Host) *entity.Host {
+	h := *host
+	return &h
+}
+
+// persistBatch writes a batch of pages, hosts and fetch log entries to the
+// database, then marks the pages visited and pushes their links into the
+// frontier, including pages left unchanged by deduplication. When the
+// batch fails its jobs are retried one by one so a single bad page is not
+// fatal to the others.
+func (s *Store) persistBatch(ctx context.Context, jobs []persistJob) {
+	var (
+		pages     []*entity.Page
+		owners    []*Store
+		skipped   []*entity.Page
+		fetches   []entity.Fetch
+		deferrals []entity.Deferral
+	)
+	hosts := map[string]*entity.Host{}
+	for _, j := range jobs {
+		if j.page != nil {
+			pages = append(pages, j.page)
+			owners = append(owners, j.owner)
 		}
-		return nil
-	}); err != nil {
-		s.log.Warn("failed to persist page", "url", page.URL, "err", err)
-		return fmt.Errorf("persist page in database: %w", err)
-	}
-
-	if err := s.db.WithTx(ctx, func(tx *sql.Tx) error {
-		ids, err := s.db.InsertURLs(
-			ctx,
-			tx,
-			append([]string{page.URL}, page.Links...),
-		)
-		if err != nil {
-			return fmt.Errorf("insert URLs into database: %w", err)
+		if j.skipped != nil {
+			skipped = append(skipped, j.skipped)
 		}
-		err = s.db.InsertGraphEdges(ctx, tx, ids[0], ids[1:])
-		if err != nil {
-			return fmt.Errorf("insert graph edges into database: %w", err)
+		if j.host != nil {
+			hosts[j.host.Name] = j.host // the latest snapshot wins
 		}
-		return nil
-	}); err != nil {
-		s.log.Warn("", "url", page.URL, "err", err)
-		return err
+		if j.fetch != nil {
+			fetches = append(fetches, *j.fetch)
+		}
+		if j.deferral != nil {
+			deferrals = append(deferrals, *j.deferral)
+		}
+	}
+
+	start := time.Now()
+	res, err := s.db.InsertBatch(ctx, Batch{
+		Pages:     pages,
+		Skipped:   skipped,
+		Hosts:     slices.Collect(maps.Values(hosts)),
+		Fetches:   fetches,
+		Deferrals: deferrals,
+		Events:    s.config.Events.Stream != "",
+	})
+	if err != nil && len(jobs) > 1 {
+		s.log.Warn("persist batch, retrying jobs one by one", "jobs", len(jobs), "error", err)
+		for _, j := range jobs {
+			s.persistBatch(ctx, []persistJob{j})
+		}
+		return
 	}
-	err := s.cache.MarkVisited(ctx, page.URL)
+	if err != nil {
+		switch {
+		case len(pages) > 0:
+			metrics.PersistErrors.Inc()
+			s.log.Error("persist page data", "url", pages[0].URL, "error", err)
+		case len(fetches) > 0:
+			s.log.Error("persist fetch log entry", "url", fetches[0].URL, "error", err)
+		default:
+			s.log.Error("persist host data", "error", err)
+		}
+		return
+	}
+	metrics.PagesDeduplicated.WithLabelValues("unchanged").Add(float64(res.Unchanged))
+	metrics.PagesDeduplicated.WithLabelValues("duplicate").Add(float64(res.Duplicates))
+	s.log.Info("Persisted batch",
+		"pages", len(pages), "skipped", len(skipped), "unchanged", res.Unchanged, "duplicates", res.Duplicates,
+		"hosts", len(hosts), "fetches", len(fetches), "duration", time.Since(start))
+
+	for i, page := range pages {
+		owners[i].enqueueLinks(ctx, page)
+	}
+}
+
+// enqueueLinks queues the links of a stored page. The popped URL is
+// visited already; the page's URL, which differs after a redirect, is
+// marked visited too. Crawl times are only recorded for the freshness
+// strategy, the only one reading them.
+func (s *Store) enqueueLinks(ctx context.Context, page *entity.Page) {
+	err := s.cache.MarkVisited(ctx, page.URL, s.frontier.Name() == "freshness")
 	if err != nil {
 		s.log.Warn("add URL to visited set", "url", page.URL, "error", err)
-		return err
+		return
+	}
+	links := s.scoped(append(append([]string{}, page.Links...), page.DemotedLinks...))
+	parent := frontier.Parent{
+		URL:       page.URL,
+		Score:     page.Priority,
+		Relevance: page.Relevance,
+		Anchors:   page.Anchors,
 	}
-	err = s.cache.AddUrls(ctx, page.Links)
+	entries, err := s.frontier.Score(ctx, parent, links)
+	if err != nil {
+		s.log.Warn("score linked URLs", "url", page.URL, "error", err)
+		return
+	}
+	entries = frontier.Demote(entries, page.DemotedLinks, demotePenalty)
+	err = s.cache.AddEntries(ctx, entries)
 	if err != nil {
 		s.log.Warn("add linked URLs to cache", "url", page.URL, "error", err)
 	}
-	return nil
 }
 
+// scoped returns the URLs of urls that are in scope.
+func (s *Store) scoped(urls []string) []string {
+	if s.inScope == nil {
+		return urls
+	}
+	var in []string
+	for _, u := range urls {
+		if s.inScope(u) {
+			in = append(in, u)
+		}
+	}
+	return in
+}
+
+// persistHost writes host to the cache, keeping probe results written
+// there by a background probe since host was read.
 func (s *Store) persistHost(ctx context.Context, host *entity.Host) {
 	err := s.cache.AddToWaitedHost(ctx, host.Name, host.Delay)
 	if err != nil {
 		s.log.Warn("add host to waited set", "host", host.Name, "error", err)
 	}
+	if cached, ok, err := s.cache.GetHostMetaData(ctx, host.Name); err == nil && ok {
+		host.MergeProbe(cached)
+	}
 	err = s.cache.AddHostMetaData(ctx, host.Name, host)
 	if err != nil {
 		s.log.Warn("add host metadata to cache", "host", host.Name, "error", err)
 	}
 }
 
-func (s *Store) GetNextUrl(ctx context.Context) (string, bool, error) {
+// Requeue pushes a popped URL back into the frontier below its previous
+// score, for URLs that cannot be crawled yet, with the publication date
+// taken when it was popped. The URL is no longer visited.
+func (s *Store) Requeue(ctx context.Context, u string, score float64, published time.Time) error {
+	return s.cache.AddEntries(ctx, []frontier.Entry{
+		{URL: u, Score: score - demotePenalty, Mode: frontier.SetIfNew, Recrawl: true, Published: published},
+	})
+}
+
+// GetNextUrl pops the next URL to crawl along with its frontier score.
+func (s *Store) GetNextUrl(ctx context.Context, partitions []int) (string, float64, bool, error) {
 	// i need to handle err and fetching from db
-	return s.cache.GetUrl(ctx)
+	return s.cache.GetUrl(ctx, partitions)
 }
 
+// GetHostMetaData reads host metadata from the Redis cache, falling back to
+// Postgres and refilling the cache on a miss.
 func (s *Store) GetHostMetaData(ctx context.Context, h string) (*entity.Host, bool, error) {
-	return s.cache.GetHostMetaData(ctx, h)
+	host, ok, err := s.cache.GetHostMetaData(ctx, h)
+	if err == nil && ok {
+		return host, true, nil
+	}
+	if err != nil {
+		s.log.Warn("get host metadata from cache", "host", h, "error", err)
+	}
+
+	host, ok, err = s.db.GetHost(ctx, h)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	if err := s.cache.AddHostMetaData(ctx, h, host); err != nil {
+		s.log.Warn("add host metadata to cache", "host", h, "error", err)
+	}
+	return host, true, nil
 }
 
-func (s *Store) Init(starters []string) error {
-	if s.cache.CountUrls(context.Background()) > 0 {
-		return nil
+// GetRobots returns the cached robots.txt rules of origin, scheme://host.
+func (s *Store) GetRobots(ctx context.Context, origin string) (*entity.RobotsRules, bool, error) {
+	return s.cache.GetRobots(ctx, origin)
+}
+
+// SetRobots caches the robots.txt rules of an origin.
+func (s *Store) SetRobots(ctx context.Context, r *entity.RobotsRules) {
+	if err := s.cache.SetRobots(ctx, r); err != nil {
+		s.log.Warn("add robots rules to cache", "origin", r.Origin, "error", err)
 	}
-	err := s.cache.AddUrls(context.Background(), starters)
+}
+
+// migrateLegacyHosts copies gob-encoded hosts from Redis into Postgres and
+// rewrites them in the JSON encoding. Hosts that cannot be decoded are
+// left as they are.
+func (s *Store) migrateLegacyHosts(ctx context.Context) (int, error) {
+	hosts, failed, err := s.cache.LegacyHosts(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(failed) > 0 {
+		s.log.Warn("decode legacy hosts", "count", len(failed), "hosts", failed[:min(len(failed), 20)])
+	}
+	if len(hosts) == 0 {
+		return 0, nil
+	}
+
+	if _, err := s.db.InsertBatch(ctx, Batch{Hosts: hosts}); err != nil {
+		return 0, fmt.Errorf("migrate legacy hosts: %w", err)
+	}
+	for _, h := range hosts {
+		if err := s.cache.AddHostMetaData(ctx, h.Name, h); err != nil {
+			return 0, fmt.Errorf("migrate legacy hosts: %w", err)
+		}
+	}
+	return len(hosts), nil
+}
+
+// Init migrates data left in Redis by earlier versions of the spider.
+func (s *Store) Init() error {
+	moved, kept, err := s.cache.MigrateLegacyFrontier(context.Background())
 	if err != nil {
 		return err
 	}
+	if moved > 0 {
+		s.log.Info("Migrated legacy frontier into partitions", "urls", moved)
+	}
+	if kept > 0 {
+		s.log.Warn("legacy frontier URLs without a host left in place", "urls", kept)
+	}
+
+	migrated, err := s.migrateLegacyHosts(context.Background())
+	if err != nil {
+		return err
+	}
+	if migrated > 0 {
+		s.log.Info("Migrated gob-encoded hosts to Postgres", "hosts", migrated)
+	}
 	return nil
 }
 
+// SeedIfEmpty adds seeds when the frontier is empty, so a restarted job
+// resumes where it stopped.
+func (s *Store) SeedIfEmpty(ctx context.Context, seeds []string) error {
+	if s.cache.CountUrls(ctx) > 0 {
+		return nil
+	}
+	return s.AddSeeds(ctx, seeds)
+}
+
+// AddSeeds pushes parentless URLs into the frontier, scored by the
+// configured strategy.
+func (s *Store) AddSeeds(ctx context.Context, urls []string) error {
+	entries, err := s.frontier.Seed(ctx, urls)
+	if err != nil {
+		return fmt.Errorf("score seed URLs: %w", err)
+	}
+	return s.cache.AddEntries(ctx, entries)
+}
+
+// AddSitemapUrls seeds URLs found in sitemaps, boosted by their <priority>.
+func (s *Store) AddSitemapUrls(ctx context.Context, urls []entity.SitemapURL) error {
+	locs := make([]string, len(urls))
+	priorities := make(map[string]float64, len(urls))
+	for i, u := range urls {
+		locs[i] = u.Loc
+		priorities[u.Loc] = u.Priority
+	}
+	locs = s.scoped(locs)
+
+	entries, err := s.frontier.Seed(ctx, locs)
+	if err != nil {
+		return fmt.Errorf("score sitemap URLs: %w", err)
+	}
+	entries = frontier.WithSitemapPriority(entries, priorities, s.config.Frontier.SitemapWeight)
+	return s.cache.AddEntries(ctx, entries)
+}
+
+// AddFeedItems queues new feed items ahead of other URLs: weight is added
+// to their seed score, scaled down as they get older, and their
+// publication dates are kept for when they are crawled.
+func (s *Store) AddFeedItems(ctx context.Context, items []entity.FeedItem, weight float64) error {
+	dates := make(map[string]time.Time, len(items))
+	locs := make([]string, 0, len(items))
+	for _, it := range items {
+		locs = append(locs, it.URL)
+		dates[it.URL] = it.Published
+	}
+	locs = s.scoped(locs)
+	if len(locs) == 0 {
+		return nil
+	}
+
+	published := make(map[string]time.Time, len(locs))
+	for _, u := range locs {
+		if t := dates[u]; !t.IsZero() {
+			published[u] = t
+		}
+	}
+
+	entries, err := s.frontier.Seed(ctx, locs)
+	if err != nil {
+		return fmt.Errorf("score feed items: %w", err)
+	}
+	entries = frontier.WithPublished(entries, published, weight, time.Now())
+	return s.cache.AddEntries(ctx, entries)
+}
+
+// Flush writes every queued page and host and stops the batch writer,
+// which is shared by every namespace.
+// Pages persisted afterwards are rejected.
+func (s *Store) Flush() {
+	s.writer.stop()
+}
+
+// PendingWrites returns how many pages of this namespace wait for the
+// batch writer, or for their links to enter the frontier.
+func (s *Store) PendingWrites() int64 {
+	return s.pending.Load()
+}
+
+// QueueLen returns how many page and host writes wait for the batch writer.
+func (s *Store) QueueLen() int {
+	return s.writer.len()
+}
+
 func (s *Store) Close() {
+	s.Flush()
 	s.db.Close()
 	s.cache.Close()
 }
@@ -0,0 +1,286 @@
+package trap
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/config"
+)
+
+type Verdict int
+
+const (
+	Allow  Verdict = iota
+	Demote         // keep, but push to the back of the frontier
+	Drop           // never enqueue
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Demote:
+		return "demote"
+	case Drop:
+		return "drop"
+	default:
+		return "allow"
+	}
+}
+
+type Result struct {
+	Verdict Verdict
+	Reason  string // e.g. "repeated_segments"
+	Pattern string // what matched, e.g. "/a/b" or "/events/{n}/{n}"
+	First   bool   // first time this host, reason and pattern was flagged
+}
+
+// Report aggregates the URLs flagged for one host, reason and pattern.
+type Report struct {
+	Host     string    `json:"host"`
+	Reason   string    `json:"reason"`
+	Pattern  string    `json:"pattern"`
+	Verdict  string    `json:"verdict"`
+	Count    int       `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+var (
+	digitsRE = regexp.MustCompile(`\d+`)
+	// a year followed by a month, as in /2150/03/ or /2150-03-14
+	pathDateRE = regexp.MustCompile(`(?:^|/)((?:19|20|21)\d{2})[/-](?:0?[1-9]|1[0-2])(?:[/-]|$)`)
+	// a year or date query parameter, as in year=2150 or date=2150-03-14
+	queryDateRE = regexp.MustCompile(`(?i)(?:^|&)(?:[a-z_]*year|[a-z_]*date|y)=((?:19|20|21)\d{2})(?:\D|$)`)
+)
+
+// maxTrackedKeys bounds the memory used by variant counters. When it is
+// exceeded the counters start over.
+const maxTrackedKeys = 100_000
+
+// Detector flags URLs that look like crawler traps: calendars, faceted
+// navigation, session loops and other generators of infinite URL spaces.
+// Structural checks only look at the URL; variant checks count how many
+// distinct URLs share a path or numeric template per host.
+type Detector struct {
+	conf config.TrapConfig
+
+	mu       sync.Mutex
+	variants map[string]map[string]struct{}
+	reports  map[string]*Report
+}
+
+func NewDetector(conf config.TrapConfig) *Detector {
+	return &Detector{
+		conf:     conf,
+		variants: map[string]map[string]struct{}{},
+		reports:  map[string]*Report{},
+	}
+}
+
+// Check classifies u and records it for variant counting and reporting.
+func (d *Detector) Check(u *url.URL) Result {
+	r := d.check(u)
+	if r.Verdict != Allow {
+		r.First = d.report(u.Host, r)
+	}
+	return r
+}
+
+func (d *Detector) check(u *url.URL) Result {
+	if d.conf.MaxURLLength > 0 && len(u.String()) > d.conf.MaxURLLength {
+		return Result{Verdict: Drop, Reason: "url_length", Pattern: strconv.Itoa(d.conf.MaxURLLength)}
+	}
+
+	segs := segments(u.Path)
+	if d.conf.MaxDepth > 0 && len(segs) > d.conf.MaxDepth {
+		return Result{Verdict: Drop, Reason: "path_depth", Pattern: strconv.Itoa(len(segs))}
+	}
+
+	if p, ok := repeatedSegments(segs, d.conf.MaxSegmentRepeats); ok {
+		return Result{Verdict: Drop, Reason: "repeated_segments", Pattern: p}
+	}
+
+	if y, ok := d.outOfRangeYear(u); ok {
+		return Result{Verdict: Demote, Reason: "calendar_range", Pattern: y}
+	}
+
+	if u.RawQuery != "" && d.conf.MaxQueryVariants > 0 {
+		key := "q|" + u.Host + u.Path
+		if d.exceeds(key, u.RawQuery, d.conf.MaxQueryVariants) {
+			return Result{Verdict: Demote, Reason: "query_variants", Pattern: u.Path}
+		}
+	}
+
+	if d.conf.MaxNumericVariants > 0 {
+		tmpl := numericTemplate(u)
+		if tmpl != "" {
+			key := "n|" + u.Host + tmpl
+			if d.exceeds(key, u.Path+"?"+u.RawQuery, d.conf.MaxNumericVariants) {
+				return Result{Verdict: Demote, Reason: "numeric_sequence", Pattern: tmpl}
+			}
+		}
+	}
+
+	return Result{Verdict: Allow}
+}
+
+// exceeds records variant under key and reports whether key already has
+// more than limit distinct variants. Only limit+1 variants are stored.
+func (d *Detector) exceeds(key, variant string, limit int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	set, ok := d.variants[key]
+	if !ok {
+		if len(d.variants) >= maxTrackedKeys {
+			d.variants = map[string]map[string]struct{}{}
+		}
+		set = map[string]struct{}{}
+		d.variants[key] = set
+	}
+
+	if _, seen := set[variant]; seen {
+		return false
+	}
+	if len(set) > limit {
+		return true
+	}
+	set[variant] = struct{}{}
+	return len(set) > limit
+}
+
+// outOfRangeYear returns the year of a date in u's path or date query
+// parameters that lies outside the configured range. Other numbers that
+// look like years, such as product IDs, are ignored.
+func (d *Detector) outOfRangeYear(u *url.URL) (string, bool) {
+	if d.conf.MaxYearsBack <= 0 && d.conf.MaxYearsAhead <= 0 {
+		return "", false
+	}
+
+	now := time.Now().Year()
+	var years [][]string
+	years = append(years, pathDateRE.FindAllStringSubmatch(u.Path, -1)...)
+	years = append(years, queryDateRE.FindAllStringSubmatch(u.RawQuery, -1)...)
+	for _, m := range years {
+		y, _ := strconv.Atoi(m[1])
+		if d.conf.MaxYearsBack > 0 && y < now-d.conf.MaxYearsBack {
+			return m[1], true
+		}
+		if d.conf.MaxYearsAhead > 0 && y > now+d.conf.MaxYearsAhead {
+			return m[1], true
+		}
+	}
+	return "", false
+}
+
+// report counts a flagged URL and returns true for a new host pattern.
+func (d *Detector) report(host string, r Result) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := host + "|" + r.Reason + "|" + r.Pattern
+	rep, ok := d.reports[key]
+	if !ok {
+		if len(d.reports) >= maxTrackedKeys {
+			d.reports = map[string]*Report{}
+		}
+		rep = &Report{
+			Host:    host,
+			Reason:  r.Reason,
+			Pattern: r.Pattern,
+			Verdict: r.Verdict.String(),
+		}
+		d.reports[key] = rep
+	}
+	rep.Count++
+	rep.LastSeen = time.Now()
+	return !ok
+}
+
+// Reports returns the flagged host patterns, most frequent first.
+func (d *Detector) Reports() []Report {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make([]Report, 0, len(d.reports))
+	for _, r := range d.reports {
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Count > out[j].Count
+	})
+	return out
+}
+
+func segments(path string) []string {
+	var segs []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segs = append(segs, s)
+		}
+	}
+	return segs
+}
+
+// repeatedSegments reports a run of one or more segments repeated more than
+// max times back to back, e.g. "/a/b/a/b/a/b", or else a single segment
+// that appears more than max times anywhere in the path.
+func repeatedSegments(segs []string, max int) (string, bool) {
+	if max <= 0 {
+		return "", false
+	}
+
+	for size := 1; size*(max+1) <= len(segs); size++ {
+		for start := 0; start+size*(max+1) <= len(segs); start++ {
+			reps := 1
+			for next := start + size; next+size <= len(segs); next += size {
+				if !slices.Equal(segs[start:start+size], segs[next:next+size]) {
+					break
+				}
+				reps++
+			}
+			if reps > max {
+				return "/" + strings.Join(segs[start:start+size], "/"), true
+			}
+		}
+	}
+
+	counts := map[string]int{}
+	for _, s := range segs {
+		counts[s]++
+		if counts[s] > max {
+			return "/" + s, true
+		}
+	}
+	return "", false
+}
+
+// numericTemplate replaces digit runs in the path and query values with
+// "{n}". It returns "" when the URL contains no digits.
+func numericTemplate(u *url.URL) string {
+	if !digitsRE.MatchString(u.Path) && !digitsRE.MatchString(u.RawQuery) {
+		return ""
+	}
+
+	tmpl := digitsRE.ReplaceAllString(u.Path, "{n}")
+	if u.RawQuery != "" {
+		q := u.Query()
+		keys := make([]string, 0, len(q))
+		for k := range q {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		tmpl += "?"
+		for i, k := range keys {
+			if i > 0 {
+				tmpl += "&"
+			}
+			tmpl += k + "=" + digitsRE.ReplaceAllString(q.Get(k), "{n}")
+		}
+	}
+	return tmpl
+}
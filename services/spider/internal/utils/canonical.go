@@ -0,0 +1,281 @@
+package utils
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// DefaultStripParams are tracking and session parameters removed from every
+// query string. A trailing "*" matches any parameter with that prefix.
+// Matching is case-insensitive.
+var DefaultStripParams = []string{
+	"utm_*", "fbclid", "gclid", "gclsrc", "dclid", "msclkid", "yclid",
+	"mc_cid", "mc_eid", "igshid", "_ga", "_gl", "_hsenc", "_hsmi",
+	"mkt_tok", "oly_anon_id", "oly_enc_id", "vero_id", "wickedid",
+	"sessionid", "session_id", "sid", "jsessionid", "phpsessid",
+	"aspsessionid*", "cfid", "cftoken",
+}
+
+// sessionPathParamRE matches session IDs embedded as path parameters,
+// e.g. "/cart;jsessionid=ABC123".
+var sessionPathParamRE = regexp.MustCompile(`(?i);(jsessionid|phpsessid|sid)=[^/]*`)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Canonicalizer rewrites URLs into a single canonical form so the same page
+// is not stored under several URLs.
+type Canonicalizer struct {
+	stripExact  map[string]bool
+	stripPrefix []string
+
+	mu         sync.RWMutex
+	httpsHosts map[string]bool
+}
+
+func NewCanonicalizer(stripParams, httpsHosts []string) *Canonicalizer {
+	c := &Canonicalizer{
+		stripExact: map[string]bool{},
+		httpsHosts: map[string]bool{},
+	}
+	for _, p := range stripParams {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			c.stripPrefix = append(c.stripPrefix, prefix)
+		} else {
+			c.stripExact[p] = true
+		}
+	}
+	for _, h := range httpsHosts {
+		c.MarkHTTPS(h)
+	}
+	return c
+}
+
+// canon is the canonicalizer used by NormalizeUrl.
+var canon = NewCanonicalizer(DefaultStripParams, nil)
+
+// ConfigureCanonicalizer replaces the canonicalizer used by NormalizeUrl.
+// extraStrip is added to DefaultStripParams. It must be called before
+// crawling starts.
+func ConfigureCanonicalizer(extraStrip, httpsHosts []string) {
+	strip := append(append([]string{}, DefaultStripParams...), extraStrip...)
+	canon = NewCanonicalizer(strip, httpsHosts)
+}
+
+// MarkHTTPS records that host serves content over https, so http links to
+// it are upgraded from now on.
+func MarkHTTPS(host string) {
+	canon.MarkHTTPS(host)
+}
+
+func (c *Canonicalizer) MarkHTTPS(host string) {
+	h := canonicalHost(host, "https")
+	if h == "" {
+		return
+	}
+	c.mu.Lock()
+	c.httpsHosts[h] = true
+	c.mu.Unlock()
+}
+
+func (c *Canonicalizer) SupportsHTTPS(host string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.httpsHosts[host]
+}
+
+// Canonicalize normalizes u in place: scheme and host case, default port,
+// IDN to punycode, dot-segments, percent-encoding, tracking parameters and
+// fragment. Relative URLs without a scheme default to https.
+func (c *Canonicalizer) Canonicalize(u *url.URL) {
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme == "" {
+		u.Scheme = "https"
+	}
+
+	u.Host = canonicalHost(u.Host, u.Scheme)
+	if u.Scheme == "http" && c.SupportsHTTPS(u.Host) {
+		u.Scheme = "https"
+	}
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	p := sessionPathParamRE.ReplaceAllString(u.EscapedPath(), "")
+	p = removeDotSegments(normalizePercentEncoding(p))
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		u.Path = unescaped
+		u.RawPath = p
+	}
+
+	u.RawQuery = c.canonicalQuery(u.RawQuery)
+	u.ForceQuery = false
+}
+
+// canonicalHost lowercases the host, converts IDN labels to punycode, drops
+// a trailing dot, the "www." prefix and the scheme's default port.
+func canonicalHost(host, scheme string) string {
+	hostname, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, p
+	}
+
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	if !isASCII(hostname) {
+		if ascii, err := idna.Lookup.ToASCII(hostname); err == nil {
+			hostname = ascii
+		}
+	}
+	hostname = strings.TrimPrefix(hostname, "www.")
+
+	if port == "" || port == defaultPorts[scheme] {
+		if strings.Contains(hostname, ":") {
+			return "[" + hostname + "]" // IPv6 literal
+		}
+		return hostname
+	}
+	return net.JoinHostPort(hostname, port)
+}
+
+func (c *Canonicalizer) canonicalQuery(raw string) string {
+	if raw == "" {
+		return ""
+	}
+
+	q, err := url.ParseQuery(raw)
+	if err != nil && len(q) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		if isValidQueryParam(k) && !c.shouldStrip(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	sorted := url.Values{}
+	for _, k := range keys {
+		vals := q[k]
+		sort.Strings(vals)
+		sorted[k] = vals
+	}
+	return sorted.Encode()
+}
+
+func (c *Canonicalizer) shouldStrip(param string) bool {
+	p := strings.ToLower(param)
+	if c.stripExact[p] {
+		return true
+	}
+	for _, prefix := range c.stripPrefix {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePercentEncoding uppercases percent-encoded triplets and decodes
+// those that encode unreserved characters (RFC 3986 section 6.2.2.2).
+// A stray "%" is encoded as "%25".
+func normalizePercentEncoding(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteString("%25")
+			continue
+		}
+
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+// removeDotSegments implements RFC 3986 section 5.2.4 for absolute paths.
+func removeDotSegments(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		return p
+	}
+
+	segs := strings.Split(p[1:], "/")
+	out := make([]string, 0, len(segs))
+	for i, s := range segs {
+		last := i == len(segs)-1
+		switch s {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, s)
+		}
+	}
+	return "/" + strings.Join(out, "/")
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
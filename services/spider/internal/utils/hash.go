@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// ContentHash returns the hex SHA-256 of a page's visible text, lowercased
+// with whitespace runs collapsed, so markup, script and formatting changes
+// do not count as new content. Pages without text are hashed on their raw
+// body instead, so they are not all taken for duplicates of each other.
+func ContentHash(text string, body []byte) string {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) == 0 {
+		sum := sha256.Sum256(body)
+		return hex.EncodeToString(sum[:])
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(words, " ")))
+	return hex.EncodeToString(sum[:])
+}
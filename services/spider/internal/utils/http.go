@@ -1,25 +1,52 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
 )
 
+// UserAgent is sent with every request.
+const UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.5993.118 Safari/537.36"
+
+// maxBodySize bounds the bodies read by GetReq.
+const maxBodySize = 10 << 20 // 10 MB
+
 func GetReq(
 	client *http.Client,
 	url string,
 	maxRetry, delay int,
 ) ([]byte, int, error) {
-	req, err := http.NewRequest("GET", url, nil)
+	res, statusCode, err := FetchContext(context.Background(), client, url, maxRetry, delay)
+	if err != nil {
+		return nil, statusCode, err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxBodySize))
+	if err != nil {
+		return nil, statusCode, fmt.Errorf("failed to read response: %w", err)
+	}
+	return body, statusCode, nil
+}
+
+// FetchContext sends a GET request, retrying failed requests, 5xx and 429
+// responses, and returns the response with its body unread, for the caller
+// to stream and close. The request context carries deadlines and
+// per-request values such as the WARC location slot.
+func FetchContext(
+	ctx context.Context,
+	client *http.Client,
+	url string,
+	maxRetry, delay int,
+) (*http.Response, int, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, 0, fmt.Errorf("request initialization failed: %w", err)
 	}
-	req.Header.Set(
-		"User-Agent",
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.5993.118 Safari/537.36",
-	)
+	req.Header.Set("User-Agent", UserAgent)
 	req.Header.Set("Accept", "text/html")
 	req.Header.Set("Accept-Language", "en-US")
 
@@ -37,21 +64,14 @@ func GetReq(
 		statusCode := res.StatusCode
 		if statusCode >= 500 || statusCode == 429 {
 			_ = res.Body.Close()
+			err = fmt.Errorf("server error: %d", statusCode)
 			continue
 		}
 		if statusCode >= 400 {
+			_ = res.Body.Close()
 			return nil, statusCode, fmt.Errorf("client error: %d", statusCode)
 		}
-
-		body, err := io.ReadAll(io.LimitReader(res.Body, 10<<20)) // 10 MB
-		_ = res.Body.Close()
-		if err != nil {
-			err = fmt.Errorf("failed to read response: %w", err)
-			continue
-		}
-
-		err = nil
-		return body, statusCode, nil
+		return res, statusCode, nil
 	}
 
 	return nil, 0, fmt.Errorf("all %d retries failed: %w", maxRetry, err)
@@ -6,7 +6,6 @@ import (
 	"net/url"
 	"regexp"
 	"slices"
-	"sort"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -33,11 +32,6 @@ var (
 		".css", ".js", ".ico",
 	}
 
-	langSubdomainDomains = []string{
-		"wikipedia.org",
-		"wikibooks.org",
-		"wikivoyage.org",
-	}
 	// Wiki-specific: blocks /Template:Foo/xx/, /Help:Bar/en/, etc.
 	wikiLangSubpageRE   = regexp.MustCompile(`(?i)/[a-z]{2,3}(-[a-z]{2,4})?/?$`)
 	wikiNoisyNamespaces = []string{"/Template:", "/Help:", "/Manual:", "/Extension:"}
@@ -49,7 +43,7 @@ func NormalizeUrl(raw string, baseHost string) (string, bool) {
 	}
 
 	u, err := url.Parse(raw)
-	if err != nil {
+	if err != nil || !IsSupportedScheme(u.Scheme) {
 		return "", false
 	}
 
@@ -70,6 +64,16 @@ func NormalizeUrl(raw string, baseHost string) (string, bool) {
 	return u.String(), true
 }
 
+// IsSupportedScheme reports whether links with this scheme can be crawled.
+// An empty scheme is a relative reference and is accepted.
+func IsSupportedScheme(scheme string) bool {
+	switch strings.ToLower(scheme) {
+	case "", "http", "https":
+		return true
+	}
+	return false
+}
+
 func shouldSkipByPath(path string) bool {
 	for _, prefix := range disallowPathPrefixes {
 		if path == prefix || strings.HasPrefix(path, prefix) {
@@ -106,46 +110,20 @@ func shouldSkipWikiLanguageSubpage(path string) bool {
 }
 
 func normalizeURLParts(u *url.URL, baseHost string) {
-	// Force HTTPS
-	u.Scheme = "https"
-
 	// Fill host if relative URL
 	if u.Host == "" && baseHost != "" {
 		u.Host = baseHost
 	}
 
-	// Clean host
-	u.Host = strings.TrimPrefix(strings.ToLower(u.Host), "www.")
-
-	forceEnglishSubdomain(u)
-
-	// Remove fragment
-	u.Fragment = ""
-
-	// Canonicalize query: sorted keys
-	if u.RawQuery != "" {
-		q := u.Query()
-		keys := make([]string, 0, len(q))
-		for k := range q {
-			if isValidQueryParam(k) {
-				keys = append(keys, k)
-			}
-		}
-		sort.Strings(keys)
-
-		sorted := url.Values{}
-		for _, k := range keys {
-			sorted[k] = q[k]
-		}
-		u.RawQuery = sorted.Encode()
-	}
+	canon.Canonicalize(u)
 
 	// Remove trailing slash
-	if len(u.Query()) == 0 &&
+	if u.RawQuery == "" &&
 		u.Path != "" &&
 		strings.HasSuffix(u.Path, "/") &&
 		!strings.Contains(u.Path, ".") {
 		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = strings.TrimSuffix(u.RawPath, "/")
 	}
 }
 
@@ -159,42 +137,6 @@ func NormalizeUrls(raws []string, baseHost string) []string {
 	return result
 }
 
-func forceEnglishSubdomain(u *url.URL) {
-	u.Host = strings.ToLower(u.Host)
-	u.Host = strings.TrimPrefix(u.Host, "www.")
-
-	// Only act on known wiki-family domains
-	isKnownLangDomain := false
-	for _, d := range langSubdomainDomains {
-		if strings.HasSuffix(u.Host, d) {
-			isKnownLangDomain = true
-			break
-		}
-	}
-	if !isKnownLangDomain {
-		return
-	}
-
-	hostParts := strings.Split(u.Host, ".")
-	if len(hostParts) < 3 {
-		return
-	}
-
-	potentialLang := hostParts[0]
-	rest := strings.Join(hostParts[1:], ".")
-
-	if potentialLang == "en" {
-		return // already English
-	}
-
-	isLang := len(potentialLang) >= 2 && len(potentialLang) <= 5 &&
-		regexp.MustCompile(`^[a-z]+(-[a-z]+)?$`).MatchString(potentialLang)
-
-	if isLang {
-		u.Host = "en." + rest
-	}
-}
-
 func CheckURLExists(rawURL string) bool {
 	client := &http.Client{
 		Timeout: 10 * time.Second,
@@ -219,7 +161,7 @@ func ValidateLinks(links []string, disallowed []string) []string {
 	normUrls := NewSet[string]()
 	for _, x := range links {
 		ur, err := url.Parse(x)
-		if err != nil || isDisallowed(ur.Path, disallowed) {
+		if err != nil || IsDisallowed(ur.Path, disallowed) {
 			continue
 		}
 		normUrls.Add(ur.String())
@@ -227,7 +169,9 @@ func ValidateLinks(links []string, disallowed []string) []string {
 	return normUrls.GetAll()
 }
 
-func isDisallowed(path string, disallowed []string) bool {
+// IsDisallowed reports whether path matches one of the robots.txt
+// disallow rules.
+func IsDisallowed(path string, disallowed []string) bool {
 	for _, d := range disallowed {
 		// detect if pattern looks like regex
 		if strings.ContainsAny(d, `.^$*+?[]|()`) {
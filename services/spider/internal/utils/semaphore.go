@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+// Semaphore limits concurrent access like a buffered channel, but its
+// limit can be changed while goroutines hold or wait for slots.
+type Semaphore struct {
+	mu    sync.Mutex
+	limit int
+	inUse int
+	wake  chan struct{}
+}
+
+func NewSemaphore(limit int) *Semaphore {
+	return &Semaphore{
+		limit: limit,
+		wake:  make(chan struct{}),
+	}
+}
+
+// Acquire blocks until a slot is free or ctx is done.
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		if s.inUse < s.limit {
+			s.inUse++
+			s.mu.Unlock()
+			return nil
+		}
+		wake := s.wake
+		s.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Semaphore) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inUse--
+	s.broadcast()
+}
+
+// SetLimit changes the number of slots. Lowering it does not revoke slots
+// already held; new acquirers wait until usage drops below the new limit.
+func (s *Semaphore) SetLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = n
+	s.broadcast()
+}
+
+func (s *Semaphore) InUse() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inUse
+}
+
+func (s *Semaphore) Limit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit
+}
+
+// broadcast wakes every waiter; callers must hold mu.
+func (s *Semaphore) broadcast() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
@@ -0,0 +1,156 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record is a single WARC record. Offset is the start of the gzip member
+// that contains it, matching the Location returned by Writer.
+type Record struct {
+	Header textproto.MIMEHeader
+	Block  []byte
+	Offset int64
+}
+
+func (r *Record) Type() string      { return r.Header.Get("WARC-Type") }
+func (r *Record) TargetURI() string { return r.Header.Get("WARC-Target-URI") }
+
+// Probe returns the kind of probe the exchange of the record was made for,
+// or "" for content. See AsProbe.
+func (r *Record) Probe() string { return r.Header.Get("WARC-Probe") }
+
+// Date returns the WARC-Date of the record, or the zero time if missing.
+func (r *Record) Date() time.Time {
+	t, _ := time.Parse(time.RFC3339, r.Header.Get("WARC-Date"))
+	return t
+}
+
+// Response parses the block of a response record into the HTTP response and
+// its body. A body shorter than its Content-Length (a truncated record) is
+// returned as-is.
+func (r *Record) Response() (*http.Response, []byte, error) {
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(r.Block)), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse http response: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, nil, fmt.Errorf("read http body: %w", err)
+	}
+	return res, body, nil
+}
+
+// Reader iterates over the records of a gzip-compressed WARC file.
+type Reader struct {
+	src  *countingReader
+	br   *bufio.Reader
+	gz   *gzip.Reader
+	rec  *bufio.Reader
+	base int64
+}
+
+func NewReader(r io.Reader) *Reader {
+	src := &countingReader{r: r}
+	return &Reader{src: src, br: bufio.NewReader(src)}
+}
+
+// Next returns the next record, or io.EOF after the last one.
+func (r *Reader) Next() (*Record, error) {
+	for {
+		if r.rec == nil {
+			if err := r.nextMember(); err != nil {
+				return nil, err
+			}
+		}
+
+		rec, err := readRecord(r.rec)
+		if errors.Is(err, io.EOF) {
+			// end of this gzip member
+			r.rec = nil
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rec.Offset = r.base
+		return rec, nil
+	}
+}
+
+func (r *Reader) nextMember() error {
+	// compressed bytes consumed so far, minus what bufio read ahead
+	r.base = r.src.n - int64(r.br.Buffered())
+
+	if _, err := r.br.Peek(1); err != nil {
+		return err
+	}
+
+	var err error
+	if r.gz == nil {
+		r.gz, err = gzip.NewReader(r.br)
+	} else {
+		err = r.gz.Reset(r.br)
+	}
+	if err != nil {
+		return fmt.Errorf("open gzip member at %d: %w", r.base, err)
+	}
+	r.gz.Multistream(false)
+	r.rec = bufio.NewReader(r.gz)
+	return nil
+}
+
+func readRecord(br *bufio.Reader) (*Record, error) {
+	tp := textproto.NewReader(br)
+
+	var line string
+	var err error
+	for line == "" {
+		// skip blank lines left between records
+		if line, err = tp.ReadLine(); err != nil {
+			return nil, err
+		}
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("invalid warc record: unexpected line %q", line)
+	}
+
+	h, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("read warc headers: %w", err)
+	}
+
+	n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid warc content length: %w", err)
+	}
+
+	block := make([]byte, n)
+	if _, err := io.ReadFull(br, block); err != nil {
+		return nil, fmt.Errorf("read warc block: %w", err)
+	}
+
+	return &Record{Header: h, Block: block}, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
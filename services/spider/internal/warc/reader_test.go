@@ -0,0 +1,128 @@
+package warc
+
+import (
+	"bytes"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/Hassan-ach/boogle/services/spider/internal/config"
+	"github.com/Hassan-ach/boogle/services/spider/internal/parser"
+	"github.com/Hassan-ach/boogle/services/spider/internal/utils"
+)
+
+// testdata/example.warc.gz holds the crawl of a small site: its robots.txt,
+// an index page, a redirect, a PDF and a page whose body was truncated.
+const fixture = "testdata/example.warc.gz"
+
+func TestReadFixture(t *testing.T) {
+	records := readAll(t, fixture)
+
+	var types, targets []string
+	for _, rec := range records {
+		types = append(types, rec.Type())
+		if rec.Type() == "response" {
+			targets = append(targets, rec.TargetURI())
+		}
+	}
+	wantTypes := []string{"warcinfo"}
+	for range 5 {
+		wantTypes = append(wantTypes, "response", "request")
+	}
+	if !slices.Equal(types, wantTypes) {
+		t.Errorf("types = %v, want %v", types, wantTypes)
+	}
+	wantTargets := []string{
+		"https://example.com/robots.txt",
+		"https://example.com/articles/",
+		"https://example.com/old",
+		"https://example.com/report.pdf",
+		"https://example.com/articles/first",
+	}
+	if !slices.Equal(targets, wantTargets) {
+		t.Errorf("targets = %v, want %v", targets, wantTargets)
+	}
+
+	for _, rec := range records {
+		if at := readAt(t, fixture, rec.Offset); at.Header.Get("WARC-Record-ID") != rec.Header.Get("WARC-Record-ID") {
+			t.Errorf("record at offset %d is %s, want %s", rec.Offset,
+				at.Header.Get("WARC-Record-ID"), rec.Header.Get("WARC-Record-ID"))
+		}
+		if got, want := rec.Header.Get("WARC-Block-Digest"), digest(rec.Block); rec.Type() != "warcinfo" && got != want {
+			t.Errorf("%s: block digest = %s, want %s", rec.TargetURI(), got, want)
+		}
+	}
+}
+
+// TestReplayFixture parses the archived responses the way the replay
+// command does.
+func TestReplayFixture(t *testing.T) {
+	p := parser.NewParser(nil, config.ParserConfig{MaxBodySize: 10 << 20}, &utils.Logger{Logger: slog.New(slog.DiscardHandler)})
+
+	type page struct {
+		title string
+		links []string
+	}
+	pages := map[string]page{}
+	var robots string
+
+	for _, rec := range readAll(t, fixture) {
+		if rec.Type() != "response" {
+			continue
+		}
+		res, body, err := rec.Response()
+		if err != nil {
+			t.Fatalf("%s: %v", rec.TargetURI(), err)
+		}
+		if rec.Header.Get("WARC-Payload-Digest") != digest(body) {
+			t.Errorf("%s: payload digest = %s, want %s", rec.TargetURI(), rec.Header.Get("WARC-Payload-Digest"), digest(body))
+		}
+
+		if rec.TargetURI() == "https://example.com/robots.txt" {
+			robots = string(body)
+			continue
+		}
+		mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+		if res.StatusCode != http.StatusOK || mediaType != "text/html" {
+			continue
+		}
+
+		parsed, err := p.ParseHTML(bytes.NewReader(body), rec.TargetURI())
+		if err != nil {
+			t.Fatalf("%s: %v", rec.TargetURI(), err)
+		}
+		var links []string
+		for _, l := range parsed.Outlinks {
+			links = append(links, l.URL)
+		}
+		pages[rec.TargetURI()] = page{title: parsed.Title, links: links}
+	}
+
+	r := p.ParseRobots(robots, "*")
+	if !slices.Equal(r.Disallow, []string{"/private/"}) || r.CrawlDelay != 2 ||
+		!slices.Equal(r.SiteMaps, []string{"https://example.com/sitemap.xml"}) {
+		t.Errorf("robots = %+v", r)
+	}
+
+	want := map[string]page{
+		"https://example.com/articles/": {
+			title: "Articles",
+			links: []string{"https://example.com/articles/first", "https://other.example"},
+		},
+		"https://example.com/articles/first": {
+			title: "First article",
+			links: []string{"https://example.com/articles/second"},
+		},
+	}
+	if len(pages) != len(want) {
+		t.Errorf("parsed %d pages, want %d", len(pages), len(want))
+	}
+	for u, w := range want {
+		got := pages[u]
+		if got.title != w.title || !slices.Equal(got.links, w.links) {
+			t.Errorf("%s: title %q, links %v, want %q, %v", u, got.title, got.links, w.title, w.links)
+		}
+	}
+}
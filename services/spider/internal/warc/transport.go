@@ -0,0 +1,104 @@
+package warc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type (
+	locationKey struct{}
+	probeKey    struct{}
+)
+
+// WithLocation returns a context that collects where the response of a
+// request made with it was archived. After the response body is closed,
+// *Location holds the last recorded response (retries overwrite it).
+func WithLocation(ctx context.Context) (context.Context, *Location) {
+	loc := &Location{}
+	return context.WithValue(ctx, locationKey{}, loc), loc
+}
+
+// AsProbe returns a context whose exchanges are archived with a WARC-Probe
+// header naming kind: they test how a site answers, such as a request for a
+// nonexistent path, and are not content to replay as pages.
+func AsProbe(ctx context.Context, kind string) context.Context {
+	return context.WithValue(ctx, probeKey{}, kind)
+}
+
+// Transport archives every exchange passing through it. The response body
+// is recorded as the caller reads it and written out when it is closed, so
+// callers that only read part of the body produce a truncated record.
+type Transport struct {
+	Base   http.RoundTripper
+	Writer *Writer
+	Log    *slog.Logger
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	fetchedAt := time.Now()
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Body = &recordingBody{
+		ReadCloser: res.Body,
+		t:          t,
+		req:        req,
+		res:        res,
+		fetchedAt:  fetchedAt,
+	}
+	return res, nil
+}
+
+type recordingBody struct {
+	io.ReadCloser
+	t         *Transport
+	req       *http.Request
+	res       *http.Response
+	fetchedAt time.Time
+
+	buf    bytes.Buffer
+	eof    bool
+	closed bool
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if errors.Is(err, io.EOF) {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.closed {
+		return err
+	}
+	b.closed = true
+
+	loc, werr := b.t.Writer.WriteExchange(b.req, b.res, b.buf.Bytes(), !b.eof, b.fetchedAt)
+	if werr != nil {
+		if b.t.Log != nil {
+			b.t.Log.Warn("write warc record", "url", b.req.URL.String(), "error", werr)
+		}
+		return err
+	}
+
+	if dst, ok := b.req.Context().Value(locationKey{}).(*Location); ok {
+		*dst = loc
+	}
+	return err
+}
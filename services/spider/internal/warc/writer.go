@@ -0,0 +1,224 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const version = "WARC/1.1"
+
+// Location points at a record inside a WARC file. Offset is the start of
+// the record's gzip member, so the record can be read back with a seek and
+// a fresh gzip reader.
+type Location struct {
+	File   string
+	Offset int64
+}
+
+// Writer appends request/response pairs to gzip-compressed WARC 1.1 files,
+// one gzip member per record, rotating to a new file once MaxSize is reached.
+type Writer struct {
+	dir      string
+	prefix   string
+	maxSize  int64
+	software string
+
+	mu   sync.Mutex
+	file *os.File
+	name string
+	size int64
+	seq  int
+}
+
+func NewWriter(dir, prefix string, maxSize int64) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create warc dir: %w", err)
+	}
+	return &Writer{
+		dir:      dir,
+		prefix:   prefix,
+		maxSize:  maxSize,
+		software: "boogle-spider",
+	}, nil
+}
+
+// WriteExchange records the request and response of one fetch and returns
+// the location of the response record. truncated marks a body that was not
+// read to the end. The response of a request made with AsProbe is marked as
+// a probe.
+func (w *Writer) WriteExchange(
+	req *http.Request,
+	res *http.Response,
+	body []byte,
+	truncated bool,
+	fetchedAt time.Time,
+) (Location, error) {
+	resBlock, err := responseBlock(res, body)
+	if err != nil {
+		return Location{}, err
+	}
+	reqBlock, err := httputil.DumpRequestOut(req, false)
+	if err != nil {
+		return Location{}, fmt.Errorf("dump request: %w", err)
+	}
+
+	target := req.URL.String()
+	responseID := newRecordID()
+
+	resHeader := header{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", responseID},
+		{"WARC-Date", fetchedAt.UTC().Format(time.RFC3339)},
+		{"WARC-Target-URI", target},
+		{"WARC-Payload-Digest", digest(body)},
+		{"WARC-Block-Digest", digest(resBlock)},
+		{"Content-Type", "application/http; msgtype=response"},
+	}
+	if truncated {
+		resHeader = append(resHeader, field{"WARC-Truncated", "length"})
+	}
+	if kind, ok := req.Context().Value(probeKey{}).(string); ok {
+		resHeader = append(resHeader, field{"WARC-Probe", kind})
+	}
+
+	reqHeader := header{
+		{"WARC-Type", "request"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", fetchedAt.UTC().Format(time.RFC3339)},
+		{"WARC-Target-URI", target},
+		{"WARC-Concurrent-To", responseID},
+		{"WARC-Block-Digest", digest(reqBlock)},
+		{"Content-Type", "application/http; msgtype=request"},
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.rotate(); err != nil {
+		return Location{}, err
+	}
+
+	loc := Location{File: w.name, Offset: w.size}
+	if err := w.writeRecord(resHeader, resBlock); err != nil {
+		return Location{}, err
+	}
+	if err := w.writeRecord(reqHeader, reqBlock); err != nil {
+		return Location{}, err
+	}
+
+	return loc, nil
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// rotate opens a new file if none is open or the current one is full.
+// Callers must hold mu.
+func (w *Writer) rotate() error {
+	if w.file != nil && w.size < w.maxSize {
+		return nil
+	}
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return fmt.Errorf("close warc file: %w", err)
+		}
+	}
+
+	w.seq++
+	w.name = fmt.Sprintf("%s-%s-%05d.warc.gz",
+		w.prefix, time.Now().UTC().Format("20060102150405"), w.seq)
+
+	f, err := os.OpenFile(filepath.Join(w.dir, w.name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open warc file: %w", err)
+	}
+	w.file = f
+	w.size = 0
+
+	info := []byte("software: " + w.software + "\r\nformat: WARC File Format 1.1\r\n")
+	return w.writeRecord(header{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", time.Now().UTC().Format(time.RFC3339)},
+		{"WARC-Filename", w.name},
+		{"Content-Type", "application/warc-fields"},
+	}, info)
+}
+
+// writeRecord writes one record as its own gzip member. Callers must hold mu.
+func (w *Writer) writeRecord(h header, block []byte) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+
+	_, _ = gz.Write([]byte(version + "\r\n"))
+	for _, f := range h {
+		_, _ = gz.Write([]byte(f.name + ": " + f.value + "\r\n"))
+	}
+	_, _ = gz.Write([]byte("Content-Length: " + strconv.Itoa(len(block)) + "\r\n\r\n"))
+	_, _ = gz.Write(block)
+	_, _ = gz.Write([]byte("\r\n\r\n"))
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("compress warc record: %w", err)
+	}
+
+	n, err := w.file.Write(buf.Bytes())
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("write warc record: %w", err)
+	}
+	return nil
+}
+
+type field struct {
+	name  string
+	value string
+}
+
+type header []field
+
+// responseBlock serializes the status line, headers and body as they were
+// received. Go's transport may have decoded a gzip transfer already, in
+// which case the Content-Encoding header is gone as well.
+func responseBlock(res *http.Response, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s\r\n", res.Proto, res.Status)
+	if err := res.Header.Write(&buf); err != nil {
+		return nil, fmt.Errorf("write response headers: %w", err)
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes(), nil
+}
+
+func digest(b []byte) string {
+	sum := sha1.Sum(b)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+func newRecordID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
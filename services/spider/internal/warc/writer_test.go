@@ -0,0 +1,265 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exchange builds a request and a response for u, as received with body.
+func exchange(u string, body []byte) (*http.Request, *http.Response) {
+	req, _ := http.NewRequest(http.MethodGet, u, nil)
+	req.Header.Set("User-Agent", "boogle-spider")
+	res := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header: http.Header{
+			"Content-Type":   {"text/html; charset=utf-8"},
+			"Content-Length": {strconv.Itoa(len(body))},
+		},
+	}
+	return req, res
+}
+
+// readAll returns the records of the WARC file at path.
+func readAll(t *testing.T, path string) []*Record {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var records []*Record
+	r := NewReader(f)
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return records
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+}
+
+// readAt reads the record whose gzip member starts at offset.
+func readAt(t *testing.T, path string, offset int64) *Record {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := NewReader(f).Next()
+	if err != nil {
+		t.Fatalf("read record at %d: %v", offset, err)
+	}
+	return rec
+}
+
+func TestRoundTrip(t *testing.T) {
+	fetchedAt := time.Date(2026, 3, 14, 9, 26, 53, 0, time.UTC)
+	full := []byte(`<html><head><title>Page</title></head><body>` +
+		strings.Repeat("<p>Some text of the page.</p>", 100) + `</body></html>`)
+
+	tests := []struct {
+		name      string
+		url       string
+		body      []byte
+		truncated bool
+	}{
+		{"complete", "https://example.com/page?q=1", full, false},
+		{"empty body", "https://example.com/empty", nil, false},
+		{"truncated", "https://example.com/long", full[:200], true},
+	}
+
+	dir := t.TempDir()
+	w, err := NewWriter(dir, "test", 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locs := make([]Location, len(tests))
+	for i, tt := range tests {
+		req, res := exchange(tt.url, full)
+		if locs[i], err = w.WriteExchange(req, res, tt.body, tt.truncated, fetchedAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, locs[0].File)
+	records := readAll(t, path)
+	if n := 1 + 2*len(tests); len(records) != n {
+		t.Fatalf("read %d records, want %d", len(records), n)
+	}
+	if records[0].Type() != "warcinfo" || records[0].Header.Get("WARC-Filename") != locs[0].File {
+		t.Errorf("first record = %s for %q, want warcinfo for %q",
+			records[0].Type(), records[0].Header.Get("WARC-Filename"), locs[0].File)
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, req := records[1+2*i], records[2+2*i]
+
+			if locs[i].File != locs[0].File {
+				t.Errorf("file = %q, want %q", locs[i].File, locs[0].File)
+			}
+			if res.Offset != locs[i].Offset {
+				t.Errorf("offset = %d, want %d", res.Offset, locs[i].Offset)
+			}
+			if at := readAt(t, path, locs[i].Offset); at.Header.Get("WARC-Record-ID") != res.Header.Get("WARC-Record-ID") {
+				t.Errorf("record at offset %d is %s, want %s", locs[i].Offset,
+					at.Header.Get("WARC-Record-ID"), res.Header.Get("WARC-Record-ID"))
+			}
+
+			if res.Type() != "response" || req.Type() != "request" {
+				t.Errorf("types = %s, %s, want response, request", res.Type(), req.Type())
+			}
+			if res.TargetURI() != tt.url || req.TargetURI() != tt.url {
+				t.Errorf("target URIs = %q, %q, want %q", res.TargetURI(), req.TargetURI(), tt.url)
+			}
+			if !res.Date().Equal(fetchedAt) || !req.Date().Equal(fetchedAt) {
+				t.Errorf("dates = %v, %v, want %v", res.Date(), req.Date(), fetchedAt)
+			}
+			if got := req.Header.Get("WARC-Concurrent-To"); got != res.Header.Get("WARC-Record-ID") {
+				t.Errorf("request concurrent to %s, want %s", got, res.Header.Get("WARC-Record-ID"))
+			}
+			if got := res.Header.Get("Content-Type"); got != "application/http; msgtype=response" {
+				t.Errorf("response content type = %q", got)
+			}
+			if got := req.Header.Get("Content-Type"); got != "application/http; msgtype=request" {
+				t.Errorf("request content type = %q", got)
+			}
+			if got, want := res.Header.Get("WARC-Payload-Digest"), digest(tt.body); got != want {
+				t.Errorf("payload digest = %s, want %s", got, want)
+			}
+			for _, rec := range []*Record{res, req} {
+				if got, want := rec.Header.Get("WARC-Block-Digest"), digest(rec.Block); got != want {
+					t.Errorf("%s block digest = %s, want %s", rec.Type(), got, want)
+				}
+			}
+			if got := res.Header.Get("WARC-Truncated"); (got == "length") != tt.truncated {
+				t.Errorf("WARC-Truncated = %q, want truncated %v", got, tt.truncated)
+			}
+
+			httpRes, body, err := res.Response()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if httpRes.StatusCode != http.StatusOK || httpRes.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+				t.Errorf("response = %d %q", httpRes.StatusCode, httpRes.Header.Get("Content-Type"))
+			}
+			if !bytes.Equal(body, tt.body) {
+				t.Errorf("body = %d bytes, want %d", len(body), len(tt.body))
+			}
+
+			httpReq, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(req.Block)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := "https://" + httpReq.Host + httpReq.RequestURI; got != tt.url {
+				t.Errorf("request for %q, want %q", got, tt.url)
+			}
+			if got := httpReq.Header.Get("User-Agent"); got != "boogle-spider" {
+				t.Errorf("User-Agent = %q", got)
+			}
+		})
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(dir, "test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte("<html><body>page</body></html>")
+	var locs []Location
+	for _, u := range []string{"https://example.com/a", "https://example.com/b"} {
+		req, res := exchange(u, body)
+		loc, err := w.WriteExchange(req, res, body, false, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		locs = append(locs, loc)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if locs[0].File == locs[1].File {
+		t.Fatalf("both exchanges written to %s", locs[0].File)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("files = %v, want 2", files)
+	}
+	for i, loc := range locs {
+		records := readAll(t, filepath.Join(dir, loc.File))
+		if len(records) != 3 || records[0].Type() != "warcinfo" {
+			t.Fatalf("%s: %d records, want warcinfo, response and request", loc.File, len(records))
+		}
+		if records[1].Offset != loc.Offset {
+			t.Errorf("%s: offset = %d, want %d", loc.File, records[1].Offset, loc.Offset)
+		}
+		if want := []string{"https://example.com/a", "https://example.com/b"}[i]; records[1].TargetURI() != want {
+			t.Errorf("%s: target URI = %q, want %q", loc.File, records[1].TargetURI(), want)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(dir, "test", 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte("<html><body>page</body></html>")
+	req, res := exchange("https://example.com/page", body)
+	loc, err := w.WriteExchange(req, res, body, false, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, res = exchange("https://example.com/x7k2q9", body)
+	req = req.WithContext(AsProbe(req.Context(), "soft-404"))
+	if _, err := w.WriteExchange(req, res, body, false, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var probes []string
+	for _, rec := range readAll(t, filepath.Join(dir, loc.File)) {
+		if rec.Type() == "response" {
+			probes = append(probes, rec.Probe())
+		}
+	}
+	if len(probes) != 2 || probes[0] != "" || probes[1] != "soft-404" {
+		t.Errorf("probes = %q, want none for the page and soft-404", probes)
+	}
+}